@@ -0,0 +1,48 @@
+package fakeserver
+
+import (
+  "encoding/json"
+  "flag"
+  "fmt"
+  "io"
+  "io/ioutil"
+)
+
+// Command implements the fakeserver subcommand of the provider
+// binary: a fake API for configurations to be applied against by
+// hand. It serves until the process is stopped and returns the
+// process exit code.
+func Command(args []string, out io.Writer, errout io.Writer) int {
+  flags := flag.NewFlagSet("fakeserver", flag.ContinueOnError)
+  flags.SetOutput(errout)
+  port := flags.Int("port", 8082, "The port to listen on (on 127.0.0.1)")
+  objects_file := flags.String("objects", "", "A JSON file of the objects to start with, by id")
+  auth_header := flags.String("auth-header", "", "Refuse requests without this Authorization header, such as 'Bearer test'")
+  provisioning_reads := flags.Int("provisioning-reads", 0, "Created objects have a status of provisioning for this many reads")
+  page_key := flags.String("page-key", "", "Return this list of each object a page at a time")
+  page_size := flags.Int("page-size", 2, "With -page-key, the items on each page")
+  debug := flags.Bool("debug", false, "Log every request")
+  if err := flags.Parse(args); err != nil { return 2 }
+
+  objects := make(map[string]map[string]interface{})
+  if *objects_file != "" {
+    b, err := ioutil.ReadFile(*objects_file)
+    if err == nil { err = json.Unmarshal(b, &objects) }
+    if err != nil {
+      fmt.Fprintf(errout, "fakeserver: Cannot load -objects: %s\n", err)
+      return 1
+    }
+  }
+
+  svr := NewFakeServer(*port, objects, false, *debug)
+  if *auth_header != "" { svr.RequireAuth(*auth_header) }
+  svr.SetProvisioningReads(*provisioning_reads)
+  if *page_key != "" { svr.Paginate(*page_key, *page_size) }
+
+  fmt.Fprintf(out, "fakeserver: Serving %d objects at http://%s/api/objects\n", len(objects), svr.server.Addr)
+  if err := svr.server.ListenAndServe(); err != nil {
+    fmt.Fprintf(errout, "fakeserver: %s\n", err)
+    return 1
+  }
+  return 0
+}
@@ -7,13 +7,30 @@ import (
   "encoding/json"
   "fmt"
   "io/ioutil"
+  "sort"
+  "strconv"
   "strings"
+  "sync"
 )
 
+/* A hook that has written a response returns true, and the
+   request is not handled any further */
+type Hook func(w http.ResponseWriter, r *http.Request) bool
+
 type fakeserver struct {
   server   *http.Server
   objects  map[string]map[string]interface{}
   debug    bool
+
+  /* Everything below is set through the methods of the same name
+     and is off by default */
+  mutex              sync.Mutex
+  hooks              []Hook
+  auth_header        string
+  provisioning_reads int
+  provisioning       map[string]int
+  page_key           string
+  page_size          int
 }
 
 func NewFakeServer(i_port int, i_objects map[string]map[string]interface{}, i_start bool, i_debug bool) *fakeserver {
@@ -22,6 +39,7 @@ func NewFakeServer(i_port int, i_objects map[string]map[string]interface{}, i_st
   svr := &fakeserver{
     debug: i_debug,
     objects: i_objects,
+    provisioning: make(map[string]int),
   }
 
   serverMux.HandleFunc("/", svr.handle_api_object)
@@ -49,12 +67,61 @@ func(svr *fakeserver)Shutdown() {
   svr.server.Close()
 }
 
+/* Hooks run in the order added, before anything else, so a test
+   can answer some requests itself (slowly, with errors...) */
+func(svr *fakeserver)AddHook(hook Hook) {
+  svr.mutex.Lock()
+  defer svr.mutex.Unlock()
+  svr.hooks = append(svr.hooks, hook)
+}
+
+/* Requests whose Authorization header is not exactly this (such as
+   "Bearer test") are answered with a 401 */
+func(svr *fakeserver)RequireAuth(header string) {
+  svr.mutex.Lock()
+  defer svr.mutex.Unlock()
+  svr.auth_header = header
+}
+
+/* Objects created from now on have a status of "provisioning" for
+   this many reads, and "ready" after */
+func(svr *fakeserver)SetProvisioningReads(reads int) {
+  svr.mutex.Lock()
+  defer svr.mutex.Unlock()
+  svr.provisioning_reads = reads
+}
+
+/* Reads of an object return the list under key size items at a
+   time, with a Link header to the next page */
+func(svr *fakeserver)Paginate(key string, size int) {
+  svr.mutex.Lock()
+  defer svr.mutex.Unlock()
+  svr.page_key = key
+  svr.page_size = size
+}
+
 
 func (svr *fakeserver)handle_api_object (w http.ResponseWriter, r *http.Request) {
   var obj map[string]interface{}
   var id string
   var ok bool
-  svr.debug = true
+
+  svr.mutex.Lock()
+  hooks := svr.hooks
+  svr.mutex.Unlock()
+  /* Run without the lock, so a hook that answers slowly only holds
+     up its own request */
+  for _, hook := range hooks {
+    if hook(w, r) { return }
+  }
+
+  svr.mutex.Lock()
+  defer svr.mutex.Unlock()
+  if svr.auth_header != "" && r.Header.Get("Authorization") != svr.auth_header {
+    w.Header().Set("WWW-Authenticate", `Bearer realm="fakeserver"`)
+    http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+    return
+  }
 
   /* Assume this will never fail */
   b, _ := ioutil.ReadAll(r.Body)
@@ -68,7 +135,8 @@ func (svr *fakeserver)handle_api_object (w http.ResponseWriter, r *http.Request)
     }
   }
 
-  parts := strings.Split(r.RequestURI, "/")
+  /* Query strings (such as ?page=2) are not part of the id */
+  parts := strings.Split(r.URL.Path, "/")
   if svr.debug {log.Printf("fakeserver.go: Split request up into %d parts: %v\n", len(parts), parts) }
   /* If it was a valid request, there will be three parts
      and the ID will exist */
@@ -81,7 +149,7 @@ func (svr *fakeserver)handle_api_object (w http.ResponseWriter, r *http.Request)
       http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
       return
     }
-  } else if r.RequestURI != "/api/objects" {
+  } else if r.URL.Path != "/api/objects" {
     /* How did something get to this handler with the wrong number of args??? */
     http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
     return
@@ -90,6 +158,7 @@ func (svr *fakeserver)handle_api_object (w http.ResponseWriter, r *http.Request)
   if r.Method == "DELETE" {
     /* Get rid of this one */
     delete(svr.objects, id)
+    delete(svr.provisioning, id)
     if svr.debug { log.Printf("fakeserver.go: Object deleted.\n") }
     return
   }
@@ -124,18 +193,27 @@ func (svr *fakeserver)handle_api_object (w http.ResponseWriter, r *http.Request)
       if svr.debug {
         log.Printf("fakeserver.go: Overwriting %s with new data:%+v\n", id, obj)
       }
+      if _, exists := svr.objects[id]; !exists && svr.provisioning_reads > 0 { svr.provisioning[id] = svr.provisioning_reads }
       svr.objects[id] = obj
 
       /* Coax the data we were sent back to JSON and send it to the user */
-      b, _ := json.Marshal(obj)
-      w.Write(b)
+      svr.write_object(w, r, id, obj)
       return
     }
+  } else if id == "" {
+    /* The whole collection, in id order */
+    ids := make([]string, 0, len(svr.objects))
+    for id := range svr.objects { ids = append(ids, id) }
+    sort.Strings(ids)
+    list := make([]interface{}, len(ids))
+    for i, id := range ids { list[i] = svr.objects[id] }
+    b, _ := json.Marshal(list)
+    w.Write(b)
+    return
   } else {
     /* No data was sent... must be just a retrieval */
     if svr.debug { log.Printf("fakeserver.go: Returning object.\n") }
-    b, _ := json.Marshal(obj)
-    w.Write(b)
+    svr.write_object(w, r, id, obj)
     return
   }
 
@@ -143,3 +221,35 @@ func (svr *fakeserver)handle_api_object (w http.ResponseWriter, r *http.Request)
   http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
   return
 }
+
+/* Sends obj as it is stored, but for the status of objects still
+   provisioning and the page asked for of a paginated list */
+func (svr *fakeserver)write_object(w http.ResponseWriter, r *http.Request, id string, obj map[string]interface{}) {
+  out := make(map[string]interface{})
+  for k, v := range obj { out[k] = v }
+
+  if remaining, ok := svr.provisioning[id]; ok {
+    out["status"] = "ready"
+    if remaining > 0 {
+      out["status"] = "provisioning"
+      if r.Method == "GET" { svr.provisioning[id] = remaining - 1 }
+    }
+  }
+
+  if list, ok := out[svr.page_key].([]interface{}); ok && r.Method == "GET" && svr.page_size > 0 {
+    page, err := strconv.Atoi(r.URL.Query().Get("page"))
+    if err != nil || page < 1 { page = 1 }
+    start := (page - 1) * svr.page_size
+    if start > len(list) { start = len(list) }
+    end := start + svr.page_size
+    if end >= len(list) {
+      end = len(list)
+    } else {
+      w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page + 1))
+    }
+    out[svr.page_key] = list[start:end]
+  }
+
+  b, _ := json.Marshal(out)
+  w.Write(b)
+}
@@ -0,0 +1,78 @@
+package fakeserver
+
+import (
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+)
+
+func request(t *testing.T, handler http.HandlerFunc, method string, path string, body string, auth string) *httptest.ResponseRecorder {
+  r := httptest.NewRequest(method, path, strings.NewReader(body))
+  if auth != "" { r.Header.Set("Authorization", auth) }
+  w := httptest.NewRecorder()
+  handler(w, r)
+  return w
+}
+
+func TestHooks(t *testing.T) {
+  svr := NewFakeServer(0, map[string]map[string]interface{}{}, false, false)
+  handler := svr.handle_api_object
+  svr.RequireAuth("Bearer test")
+  svr.SetProvisioningReads(1)
+  svr.Paginate("members", 2)
+
+  if w := request(t, handler, "GET", "/api/objects", "", "Bearer wrong"); w.Code != 401 {
+    t.Fatalf("fakeserver_test.go: Expected a 401 without the right Authorization but got %d", w.Code)
+  }
+
+  w := request(t, handler, "POST", "/api/objects", `{ "id": "1", "members": [ "a", "b", "c" ] }`, "Bearer test")
+  if !strings.Contains(w.Body.String(), `"status":"provisioning"`) { t.Fatalf("fakeserver_test.go: Expected a new object to be provisioning but got %s", w.Body) }
+
+  w = request(t, handler, "GET", "/api/objects/1", "", "Bearer test")
+  if w.Header().Get("Link") != `</api/objects/1?page=2>; rel="next"` { t.Fatalf("fakeserver_test.go: Expected a Link to page 2 but got '%s'", w.Header().Get("Link")) }
+  obj := make(map[string]interface{})
+  json.Unmarshal(w.Body.Bytes(), &obj)
+  if obj["status"] != "provisioning" || len(obj["members"].([]interface{})) != 2 { t.Fatalf("fakeserver_test.go: Unexpected first read %v", obj) }
+
+  w = request(t, handler, "GET", "/api/objects/1?page=2", "", "Bearer test")
+  json.Unmarshal(w.Body.Bytes(), &obj)
+  if obj["status"] != "ready" || len(obj["members"].([]interface{})) != 1 || w.Header().Get("Link") != "" { t.Fatalf("fakeserver_test.go: Unexpected last page %v", obj) }
+
+  svr.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+    if r.Method != "DELETE" { return false }
+    w.WriteHeader(409)
+    return true
+  })
+  if w := request(t, handler, "DELETE", "/api/objects/1", "", "Bearer test"); w.Code != 409 { t.Fatalf("fakeserver_test.go: The hook did not answer the delete (got %d)", w.Code) }
+
+  w = request(t, handler, "GET", "/api/objects", "", "Bearer test")
+  b, _ := ioutil.ReadAll(w.Body)
+  if !strings.HasPrefix(string(b), `[{"id":"1"`) { t.Fatalf("fakeserver_test.go: Expected the collection to list the object but got %s", b) }
+}
+
+func TestSlowHook(t *testing.T) {
+  svr := NewFakeServer(0, map[string]map[string]interface{}{}, false, false)
+  handler := svr.handle_api_object
+  release := make(chan struct{})
+  svr.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+    if r.URL.Path != "/api/objects/slow" { return false }
+    <-release
+    return true
+  })
+  defer close(release)
+  go request(t, handler, "GET", "/api/objects/slow", "", "")
+  time.Sleep(100 * time.Millisecond)
+
+  done := make(chan int)
+  go func() { done <- request(t, handler, "GET", "/api/objects", "", "").Code }()
+  select {
+  case code := <-done:
+    if code != 200 { t.Fatalf("fakeserver_test.go: Expected the collection but got %d", code) }
+  case <-time.After(2 * time.Second):
+    t.Fatalf("fakeserver_test.go: A slow hook held up another request")
+  }
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+  "os"
   "github.com/hashicorp/terraform/plugin"
   "github.com/hashicorp/terraform/terraform"
+  "github.com/TrurlMcByte/terraform-provider-restapi/fakeserver"
   "github.com/TrurlMcByte/terraform-provider-restapi/restapi"
 )
 
 func main() {
+  /* Helpers for adopting existing objects, run outside of terraform */
+  if len(os.Args) > 1 && os.Args[1] == "import-ids" {
+    os.Exit(restapi.ImportIDsCommand(os.Args[2:], os.Stdout, os.Stderr))
+  }
+  /* A fake API for configurations to be applied against by hand */
+  if len(os.Args) > 1 && os.Args[1] == "fakeserver" {
+    os.Exit(fakeserver.Command(os.Args[2:], os.Stdout, os.Stderr))
+  }
+
   plugin.Serve(&plugin.ServeOpts{
     ProviderFunc: func() terraform.ResourceProvider {
       return restapi.Provider()
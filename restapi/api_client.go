@@ -1,168 +1,1099 @@
 package restapi
 
 import (
-  "log"
+  "context"
   "net/http"
-  "crypto/tls"
   "errors"
   "fmt"
   "io/ioutil"
   "strings"
+  "strconv"
+  "sort"
+  "regexp"
+  "sync"
   "bytes"
+  "encoding/json"
+  "compress/gzip"
+  "compress/zlib"
+  "io"
+  "mime"
   "time"
+  "golang.org/x/time/rate"
 )
 
-type api_client struct {
+// APIClientOpt holds the settings used to construct an APIClient.
+// The zero value of every field is a usable default.
+type APIClientOpt struct {
+  URI                     string
+  Insecure                bool
+  Username                string
+  Password                string
+  AuthHeader              string
+  Timeout                 int
+  IDAttribute             string
+  CopyKeys                []string
+  WriteReturnsObject      bool
+  CreateReturnsObject     bool
+  MaxRetryAfter           int
+  RateLimit               float64
+  RateLimitBurst          int
+  ReadRateLimit           float64
+  WriteRateLimit          float64
+  CircuitBreakerThreshold int
+  ProxyURL                string
+  ProxyUsername           string
+  ProxyPassword           string
+  MaxAPIDataSize          int
+  UnixSocketBaseURL       string
+  ReadOnly                bool
+  HTTP2                   string
+  MaxIdleConns            int
+  MaxIdleConnsPerHost     int
+  MaxConnsPerHost         int
+  IdleConnTimeout         int
+  KeepAlive               int
+  DisableKeepAlives       bool
+  RetryBodyPatterns       []string
+  RetryBodyAttempts       int
+  RetryBodyInterval       int
+  FairQueueing            bool
+  CompressRequests        bool
+  AcceptEncoding          string
+  HostOverrides           map[string]string
+  TLSServerName           string
+  HostHeader              string
+  FollowRedirects         *bool
+  MaxRedirects            int
+  RedirectAuthAcrossHosts bool
+  PrettyJSON              bool
+  PreserveKeyOrder        bool
+  EscapeHTML              *bool
+  EscapeUnicode           bool
+  ContentTypeCharset      string
+  CorrelationIDHeader     string
+  /* The response header holding the API's id for a request, for
+     LastOperation. Default is X-Request-Id */
+  RequestIDHeader         string
+  CorrelationIDTemplate   string
+  OTLPEndpoint            string
+  OTLPHeaders             map[string]string
+  TracingServiceName      string
+  SkipExistsCheck         bool
+  SkipRefresh             string
+  LogRedactPatterns       []string
+  CacheTTL                int
+  DeleteRetryStatuses     []int
+  DeleteRetryBodyPatterns []string
+  DeleteRetryTimeout      int
+  DeleteRetryInterval     int
+  /* For eventually consistent APIs: how many times (and how many
+     seconds apart) the read following a create is retried when it
+     answers 404 */
+  CreateReadRetries       int
+  CreateReadRetryInterval int
+  /* How many times (starting this many seconds apart, and doubling)
+     a request is retried when the network failed it in a way that
+     may pass, such as a connection reset or a DNS server that did
+     not answer. Creates and other non-idempotent requests are only
+     retried when they cannot have reached the server */
+  TransportRetries        int
+  TransportRetryInterval  int
+  ConditionalReads        bool
+  TimestampFormats        []string
+  TimestampTimezone       string
+  NumberEpsilon           float64
+  MaxResponseSize         int64
+  NullEqualsAbsent        bool
+  ValueAliases            map[string]string
+  WriteOnlyFields         []string
+  MaxConcurrentRequests   int
+  IPFamily                string
+  LocalAddress            string
+  CreateMethod            string
+  ReadMethod              string
+  UpdateMethod            string
+  DestroyMethod           string
+  LogCategories           []string
+  EnvInterpolation        bool
+  /* When set, successful responses with a body must be of this
+     media type (or, for application/json, a +json one) */
+  ExpectContentType       string
+  VCRMode                 string
+  VCRCassette             string
+  Debug                   bool
+}
+
+// APIClient sends requests to a REST API and holds the settings
+// shared by every APIObject managed through it. It is safe for
+// concurrent use.
+type APIClient struct {
   http_client           *http.Client
   uri                   string
   insecure              bool
   username              string
   password              string
   auth_header           string
+  host_header           string
+  follow_redirects      bool
   redirects             int
+  redirect_auth         bool
   timeout               int
+  max_retry_after       time.Duration
+  rate_limiter          *rate.Limiter
+  read_limiter          *rate.Limiter
+  write_limiter         *rate.Limiter
+  fair_queue            *fair_queue
+  request_slots         chan struct{}
+  path_locks            path_locks
+  create_method         string
+  read_method           string
+  update_method         string
+  destroy_method        string
+  log_categories        map[string]bool
+  env_interpolation     bool
+  expect_content_type   string
+  breaker_threshold     int
+  breaker_mutex         sync.Mutex
+  breaker_failures      int
+  breaker_last_error    error
   id_attribute          string
   copy_keys             []string
   write_returns_object  bool
   create_returns_object bool
+  max_api_data_size     int
+  read_only             bool
+  retry_body_patterns   []*regexp.Regexp
+  retry_body_attempts   int
+  retry_body_interval   time.Duration
+  compress_requests     bool
+  accept_encoding       string
+  pretty_json           bool
+  preserve_key_order    bool
+  escape_html           bool
+  escape_unicode        bool
+  content_type          string
+  correlation_header    string
+  request_id_header     string
+  correlation_template  *correlation_template
+  run_id                string
+  tracer                *tracer
+  skip_exists_check     bool
+  skip_refresh          string
+  response_cache        *response_cache
+  delete_retry_statuses []int
+  delete_retry_patterns []*regexp.Regexp
+  delete_retry_timeout  time.Duration
+  delete_retry_interval time.Duration
+  create_read_retries   int
+  create_read_retry_interval time.Duration
+  transport_retries     int
+  transport_retry_interval time.Duration
+  conditional_reads     bool
+  name_templates        template_cache
+  location_patterns     regexp_cache
+  comparer              *value_comparer
+  max_response_size     int64
   debug                 bool
 }
 
 
-// Make a new api client for RESTful calls
-func NewAPIClient (i_uri string, i_insecure bool, i_username string, i_password string, i_auth_header string, i_timeout int, i_id_attribute string, i_copy_keys []string, i_wro bool, i_cro bool, i_debug bool) *api_client {
-  if i_debug {
-    log.Printf("api_client.go: Constructing debug api_client\n")
+// NewAPIClient makes a new api client for RESTful calls
+func NewAPIClient (opt *APIClientOpt) (*APIClient, error) {
+  if opt.Debug {
+    log_debug("api_client.go", "Constructing debug api_client")
+  }
+
+  if opt.URI == "" {
+    return nil, errors.New("uri must be set to construct an API client")
   }
 
   /* Sane default */
-  if i_id_attribute == "" {
-    i_id_attribute = "id"
+  id_attribute := opt.IDAttribute
+  if id_attribute == "" {
+    id_attribute = "id"
   }
 
   /* Remove any trailing slashes since we will append
      to this URL with our own root-prefixed location */
-  if strings.HasSuffix(i_uri, "/") {
-    i_uri = i_uri[:len(i_uri)-1]
+  uri := strings.TrimSuffix(opt.URI, "/")
+
+  /* A single token bucket shared by every object using this client.
+     No limit (or a nonsense one) means requests are never delayed */
+  rate_limit := rate.Inf
+  if opt.RateLimit > 0 {
+    rate_limit = rate.Limit(opt.RateLimit)
+  }
+  rate_limit_burst := opt.RateLimitBurst
+  if rate_limit_burst < 1 {
+    rate_limit_burst = 1
+  }
+
+  /* Compiled once here rather than for every response */
+  retry_body_patterns := make([]*regexp.Regexp, 0, len(opt.RetryBodyPatterns))
+  for _, pattern := range opt.RetryBodyPatterns {
+    re, err := regexp.Compile(pattern)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid retry_body_patterns entry '%s': %s", pattern, err)
+    }
+    retry_body_patterns = append(retry_body_patterns, re)
   }
 
-  /* Disable TLS verification if requested */
-  tr := &http.Transport{
-    TLSClientConfig: &tls.Config{InsecureSkipVerify: i_insecure},
+  delete_retry_patterns := make([]*regexp.Regexp, 0, len(opt.DeleteRetryBodyPatterns))
+  for _, pattern := range opt.DeleteRetryBodyPatterns {
+    re, err := regexp.Compile(pattern)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid delete_retry_body_patterns entry '%s': %s", pattern, err)
+    }
+    delete_retry_patterns = append(delete_retry_patterns, re)
   }
 
-  client := api_client{
+  log_redact_patterns := make([]*regexp.Regexp, 0, len(opt.LogRedactPatterns))
+  for _, pattern := range opt.LogRedactPatterns {
+    re, err := regexp.Compile(pattern)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid log_redact_patterns entry '%s': %s", pattern, err)
+    }
+    log_redact_patterns = append(log_redact_patterns, re)
+  }
+  /* The credentials we were given are never worth logging. The
+     token part of "Bearer <token>" is hidden wherever it shows up */
+  secrets := []string{ opt.Password, opt.ProxyPassword, opt.AuthHeader }
+  if fields := strings.Fields(opt.AuthHeader); len(fields) > 1 { secrets = append(secrets, fields[len(fields)-1]) }
+  add_log_redactions(log_redact_patterns, secrets...)
+
+  comparer, err := new_value_comparer(opt.TimestampFormats, opt.TimestampTimezone, opt.NumberEpsilon, opt.NullEqualsAbsent, opt.ValueAliases)
+  if err != nil { return nil, err }
+  comparer.set_write_only(opt.WriteOnlyFields)
+
+  tr, err := build_transport(opt)
+  if err != nil { return nil, err }
+  var transport http.RoundTripper = tr
+  if opt.VCRMode != "" {
+    if transport, err = new_vcr_transport(opt.VCRMode, opt.VCRCassette, tr); err != nil { return nil, err }
+  }
+
+  /* Requests to a unix socket still need an http(s) URL to work
+     with. The socket is dialed no matter what host it names */
+  if strings.HasPrefix(uri, "unix://") {
+    uri = strings.TrimSuffix(opt.UnixSocketBaseURL, "/")
+    if uri == "" { uri = "http://localhost" }
+  }
+
+  client := APIClient{
     http_client: &http.Client{
-      Timeout: time.Second * time.Duration(i_timeout),
-      Transport: tr,
+      Timeout: time.Second * time.Duration(opt.Timeout),
+      Transport: transport,
       },
-    uri: i_uri,
-    insecure: i_insecure,
-    username: i_username,
-    password: i_password,
-    auth_header: i_auth_header,
-    id_attribute: i_id_attribute,
-    copy_keys: i_copy_keys,
-    write_returns_object: i_wro,
-    create_returns_object: i_cro,
-    redirects: 5,
-    debug: i_debug,
-  }
-  return &client
-}
-
-/* Helper function that handles sending/receiving and handling
-   of HTTP data in and out.
-   TODO: Handle redirects */
-func (client *api_client) send_request (method string, path string, data string) (string, error) {
+    uri: uri,
+    insecure: opt.Insecure,
+    username: opt.Username,
+    password: opt.Password,
+    auth_header: opt.AuthHeader,
+    host_header: opt.HostHeader,
+    timeout: opt.Timeout,
+    id_attribute: id_attribute,
+    copy_keys: opt.CopyKeys,
+    write_returns_object: opt.WriteReturnsObject,
+    create_returns_object: opt.CreateReturnsObject,
+    follow_redirects: opt.FollowRedirects == nil || *opt.FollowRedirects,
+    redirects: opt.MaxRedirects,
+    redirect_auth: opt.RedirectAuthAcrossHosts,
+    env_interpolation: opt.EnvInterpolation,
+    max_retry_after: time.Second * time.Duration(opt.MaxRetryAfter),
+    rate_limiter: rate.NewLimiter(rate_limit, rate_limit_burst),
+    breaker_threshold: opt.CircuitBreakerThreshold,
+    max_api_data_size: opt.MaxAPIDataSize,
+    read_only: opt.ReadOnly,
+    retry_body_patterns: retry_body_patterns,
+    retry_body_attempts: opt.RetryBodyAttempts,
+    retry_body_interval: time.Second * time.Duration(opt.RetryBodyInterval),
+    compress_requests: opt.CompressRequests,
+    accept_encoding: opt.AcceptEncoding,
+    pretty_json: opt.PrettyJSON,
+    preserve_key_order: opt.PreserveKeyOrder,
+    escape_html: opt.EscapeHTML == nil || *opt.EscapeHTML,
+    escape_unicode: opt.EscapeUnicode,
+    content_type: "application/json",
+    skip_exists_check: opt.SkipExistsCheck,
+    skip_refresh: opt.SkipRefresh,
+    delete_retry_statuses: opt.DeleteRetryStatuses,
+    delete_retry_patterns: delete_retry_patterns,
+    delete_retry_timeout: time.Second * time.Duration(opt.DeleteRetryTimeout),
+    delete_retry_interval: time.Second * time.Duration(opt.DeleteRetryInterval),
+    create_read_retries: opt.CreateReadRetries,
+    create_read_retry_interval: time.Second * time.Duration(opt.CreateReadRetryInterval),
+    transport_retries: opt.TransportRetries,
+    transport_retry_interval: time.Second * time.Duration(opt.TransportRetryInterval),
+    conditional_reads: opt.ConditionalReads,
+    comparer: comparer,
+    max_response_size: opt.MaxResponseSize,
+    debug: opt.Debug,
+  }
+  /* Parsed once here rather than for every request */
+  client.request_id_header = opt.RequestIDHeader
+  if client.request_id_header == "" { client.request_id_header = "X-Request-Id" }
+  if opt.CorrelationIDHeader != "" {
+    template := opt.CorrelationIDTemplate
+    if template == "" { template = "{uuid}" }
+    if client.correlation_template, err = parse_correlation_template(template); err != nil { return nil, err }
+    if client.run_id, err = correlation_run_id(); err != nil { return nil, err }
+    client.correlation_header = opt.CorrelationIDHeader
+  }
+
+  if opt.OTLPEndpoint != "" {
+    if client.tracer, err = new_tracer(opt.OTLPEndpoint, opt.OTLPHeaders, opt.TracingServiceName); err != nil { return nil, err }
+  }
+
+  client.http_client.CheckRedirect = client.check_redirect
+  if client.redirects <= 0 { client.redirects = 5 }
+
+  if opt.ContentTypeCharset != "" {
+    client.content_type += "; charset=" + opt.ContentTypeCharset
+  }
+  if opt.CacheTTL > 0 {
+    client.response_cache = new_response_cache(time.Second * time.Duration(opt.CacheTTL))
+  }
+  /* Reads and writes may each have a limit of their own on top of
+     the shared one, since APIs are often far stricter about writes */
+  if opt.ReadRateLimit > 0 {
+    client.read_limiter = rate.NewLimiter(rate.Limit(opt.ReadRateLimit), rate_limit_burst)
+  }
+  if opt.WriteRateLimit > 0 {
+    client.write_limiter = rate.NewLimiter(rate.Limit(opt.WriteRateLimit), rate_limit_burst)
+  }
+  if opt.FairQueueing {
+    client.fair_queue = new_fair_queue(client.rate_limiter)
+  }
+  if opt.ExpectContentType != "" {
+    media_type, _, err := mime.ParseMediaType(opt.ExpectContentType)
+    if err == nil && !strings.Contains(media_type, "/") { err = errors.New("not a type/subtype") }
+    if err != nil { return nil, fmt.Errorf("Invalid expect_content_type '%s': %s", opt.ExpectContentType, err) }
+    client.expect_content_type = media_type
+  }
+  if client.skip_refresh == "" { client.skip_refresh = "tagged" }
+  if client.skip_refresh != "none" && client.skip_refresh != "tagged" && client.skip_refresh != "all" {
+    return nil, fmt.Errorf("Invalid skip_refresh '%s': must be none, tagged or all", client.skip_refresh)
+  }
+  client.log_categories = make(map[string]bool)
+  for _, category := range opt.LogCategories {
+    if !log_category_names[category] {
+      return nil, fmt.Errorf("Unknown log_categories entry '%s'. Must be one of http, drift, auth or polling", category)
+    }
+    client.log_categories[category] = true
+  }
+
+  client.create_method = method_or(opt.CreateMethod, "POST")
+  client.read_method = method_or(opt.ReadMethod, "GET")
+  client.update_method = method_or(opt.UpdateMethod, "PUT")
+  client.destroy_method = method_or(opt.DestroyMethod, "DELETE")
+  if opt.MaxConcurrentRequests > 0 {
+    client.request_slots = make(chan struct{}, opt.MaxConcurrentRequests)
+  }
+  return &client, nil
+}
+
+// SendRequest handles sending/receiving and handling of HTTP data
+// in and out. The path is appended to the client's URI and data, when
+// not empty, is sent as a JSON body. The response body is returned
+// for any 2xx response; all other responses are returned as errors.
+// Redirects are followed according to the client's redirect policy.
+func (client *APIClient) SendRequest (method string, path string, data string) (string, error) {
+  return client.SendRequestContext(context.Background(), method, path, data)
+}
+
+// SendRequestContext is SendRequest, but gives up as soon as ctx is
+// done - including while waiting on rate limits or Retry-After
+func (client *APIClient) SendRequestContext (ctx context.Context, method string, path string, data string) (string, error) {
+  resp, err := client.send_request(ctx, method, path, data, nil)
+  if err != nil { return "", err }
+  return resp.body, nil
+}
+
+/* What came back from a successful request */
+type api_response struct {
+  status  int
+  headers http.Header
+  body    string
+}
+
+// APIError is returned when the API responds with a status code that
+// does not indicate success
+type APIError struct {
+  StatusCode int
+  Header     http.Header
+  Body       string
+  Method     string
+  Path       string
+}
+
+func (e *APIError) Error() string {
+  switch e.StatusCode {
+  case 401:
+    return fmt.Sprintf("Unexpected response code '401': the API did not accept the provider's credentials for %s '%s'%s. Check username/password or authorization_header. Response: %s",
+      e.Method, e.Path, permission_hint(e), e.response())
+  case 403:
+    return fmt.Sprintf("Unexpected response code '403': the provider's credentials lack permission to %s '%s'%s. Response: %s",
+      e.Method, e.Path, permission_hint(e), e.response())
+  }
+  return fmt.Sprintf("Unexpected response code '%d': %s", e.StatusCode, e.response())
+}
+
+/* Whether a successful response is of expect_content_type, and
+   what it was. Responses without a body (or a Content-Type) have
+   nothing to be wrong about */
+func (client *APIClient) unexpected_content_type(header http.Header, body string) (string, bool) {
+  if client.expect_content_type == "" || body == "" || header.Get("Content-Type") == "" { return "", true }
+  media_type, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+  if err != nil { return header.Get("Content-Type"), false }
+  if media_type == client.expect_content_type { return media_type, true }
+  /* application/problem+json, application/hal+json and the like are JSON too */
+  if client.expect_content_type == "application/json" && strings.HasPrefix(media_type, "application/") && strings.HasSuffix(media_type, "+json") { return media_type, true }
+  return media_type, false
+}
+
+/* A whole HTML page in an error is mostly noise */
+func (e *APIError) response() string {
+  if diagnostic := html_diagnostic(e.Header, e.Body); diagnostic != "" { return diagnostic }
+  return e.Body
+}
+
+/* How much of an HTML page is shown to tell which one it is */
+const html_excerpt_length = 200
+
+/* Gateways, proxies and single sign-on login pages answer in HTML
+   where the API would have answered in JSON. Says so, with the start
+   of the page, or returns "" when body is not HTML */
+func html_diagnostic(header http.Header, body string) string {
+  media_type, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+  if media_type == "" && strings.TrimSpace(body) != "" {
+    media_type, _, _ = mime.ParseMediaType(http.DetectContentType([]byte(body)))
+  }
+  if media_type != "text/html" && media_type != "application/xhtml+xml" { return "" }
+
+  excerpt := []rune(strings.Join(strings.Fields(body), " "))
+  if len(excerpt) > html_excerpt_length { excerpt = append(excerpt[:html_excerpt_length], []rune("...")...) }
+  return fmt.Sprintf("received HTML, likely an auth redirect or proxy error: %s", string(excerpt))
+}
+
+// IsPermissionError reports whether the API refused the request because
+// of missing or insufficient credentials (401 or 403), as opposed to the
+// object being missing or the request being bad
+func (e *APIError) IsPermissionError() bool {
+  return e.StatusCode == 401 || e.StatusCode == 403
+}
+
+// IsNotFound reports whether the API said the object is not there
+// (404 or 410)
+func (e *APIError) IsNotFound() bool {
+  return e.StatusCode == 404 || e.StatusCode == 410
+}
+
+/* Keys APIs commonly use to say which scope or permission was missing */
+var permission_hint_keys = []string{ "required_scope", "required_scopes", "scope", "scopes", "missing_permissions", "required_permission", "permission", "permissions" }
+
+/* Digs whatever the API told us about the missing permission out of
+   WWW-Authenticate (RFC 6750) or a JSON error body */
+func permission_hint(e *APIError) string {
+  hints := make([]string, 0)
+
+  if challenge := e.Header.Get("WWW-Authenticate"); challenge != "" {
+    for _, part := range strings.Split(challenge, ",") {
+      kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+      if len(kv) != 2 { continue }
+      key := strings.ToLower(kv[0])
+      if i := strings.LastIndex(key, " "); i != -1 { key = key[i+1:] }
+      if key == "scope" || key == "error_description" {
+        hints = append(hints, fmt.Sprintf("%s %s", key, strings.Trim(kv[1], `"`)))
+      }
+    }
+  }
+
+  body := make(map[string]interface{})
+  if json.Unmarshal([]byte(e.Body), &body) == nil {
+    for _, key := range permission_hint_keys {
+      if v, ok := body[key]; ok { hints = append(hints, fmt.Sprintf("%s %v", key, v)) }
+    }
+  }
+
+  if len(hints) == 0 { return "" }
+  return " (" + strings.Join(hints, "; ") + ")"
+}
+
+/* The workhorse behind SendRequest. headers are added to (and
+   override) the ones the client sets on its own */
+func (client *APIClient) send_request (ctx context.Context, method string, path string, data string, headers map[string]string) (*api_response, error) {
+  if client.response_cache == nil {
+    return client.traced_request(ctx, method, path, data, headers)
+  }
+
+  if method != "GET" {
+    if !is_read(ctx, method) { client.response_cache.clear() }
+    return client.traced_request(ctx, method, path, data, headers)
+  }
+
+  key := cache_key(path, data, headers)
+  generation := client.response_cache.current()
+  if res := client.response_cache.get(key); res != nil {
+    if client.logs("http") { log_debug("api_client.go", "Using cached response", "path", path) }
+    return res, nil
+  }
+  res, err := client.traced_request(ctx, method, path, data, headers)
+  if err == nil && res.status != 304 { client.response_cache.put(key, res, generation) }
+  return res, err
+}
+
+/* The answer depends on what was asked with (If-None-Match, an
+   operation's own headers) as well as where */
+func cache_key (path string, data string, headers map[string]string) string {
+  lines := make([]string, 0, len(headers))
+  for name, value := range headers { lines = append(lines, strings.ToLower(name) + ": " + value) }
+  sort.Strings(lines)
+  return path + "\n" + strings.Join(lines, "\n") + "\n\n" + data
+}
+
+/* When tracing is on, the whole call - retries included - is one span */
+func (client *APIClient) traced_request (ctx context.Context, method string, path string, data string, headers map[string]string) (*api_response, error) {
+  if client.tracer == nil {
+    return client.do_request(ctx, method, path, data, headers)
+  }
+
+  span := client.tracer.start(method, client.uri + path)
+  traced := map[string]string{ "traceparent": span.traceparent() }
+  for name, value := range headers { traced[name] = value }
+
+  res, err := client.do_request(ctx, method, path, data, traced)
+  span.end(res, err)
+  return res, err
+}
+
+func (client *APIClient) do_request (ctx context.Context, method string, path string, data string, headers map[string]string) (*api_response, error) {
   full_uri := client.uri + path
   var req *http.Request
   var err error
 
-  if client.debug {
-    log.Printf("api_client.go: method='%s', path='%s', full uri (derived)='%s', data='%s'\n", method, path, full_uri, data)
+  /* Break-glass runs against production must never change anything */
+  if client.read_only && !is_read(ctx, method) {
+    return nil, fmt.Errorf("The provider is configured with read_only = true. Refusing to send %s to '%s'", method, path)
+  }
+
+  /* Don't bother the API (or make the user wait) if we already
+     know it is not working */
+  if err := client.breaker_check(); err != nil {
+    return nil, err
+  }
+
+  /* Resolved at the last moment so the values are never part of
+     the plan or the state */
+  if client.env_interpolation {
+    if data, err = interpolate_env(data, json_string_escape); err != nil { return nil, err }
+    resolved := make(map[string]string, len(headers))
+    for name, value := range headers {
+      if resolved[name], err = interpolate_env(value, no_escape); err != nil { return nil, err }
+    }
+    headers = resolved
+  }
+
+  if client.logs("http") {
+    log_debug("api_client.go", "Preparing request", "method", method, "path", path, "uri", full_uri, "data", data)
   }
 
-  buffer := bytes.NewBuffer([]byte(data))
+  payload := []byte(data)
+  if data != "" && client.compress_requests {
+    if payload, err = gzip_bytes(payload); err != nil { return nil, err }
+  }
 
   if data == "" {
-    req, err = http.NewRequest(method, full_uri, nil)
+    req, err = http.NewRequestWithContext(ctx, method, full_uri, nil)
   } else {
-    req, err = http.NewRequest(method, full_uri, buffer)
+    req, err = http.NewRequestWithContext(ctx, method, full_uri, bytes.NewReader(payload))
 
     if err == nil {
-      req.Header.Set("Content-Type", "application/json")
+      req.Header.Set("Content-Type", client.content_type)
+      if client.compress_requests { req.Header.Set("Content-Encoding", "gzip") }
     }
   }
 
   if err != nil {
-    log.Fatal(err)
-    return "", err
+    log_error("api_client.go", "Could not build request", "method", method, "uri", full_uri, "error", err)
+    return nil, err
   }
 
-  if client.debug {
-    log.Printf("api_client.go: Sending HTTP request to %s...\n", req.URL)
+  if client.logs("http") {
+    log_debug("api_client.go", "Sending HTTP request", "url", req.URL)
+  }
+
+  /* Load balancers and IP-only endpoints may need a Host that
+     differs from what is in the URI */
+  if client.host_header != "" {
+    req.Host = client.host_header
+  }
+
+  /* When Accept-Encoding is set explicitly, net/http no longer
+     decompresses for us - see decode_body */
+  if client.accept_encoding != "" {
+    req.Header.Set("Accept-Encoding", client.accept_encoding)
+  }
+
+  /* Set once so every retry of this request carries the same id */
+  if client.correlation_header != "" {
+    id, err := client.correlation_template.expand(client.run_id, method, path)
+    if err != nil { return nil, err }
+    req.Header.Set(client.correlation_header, id)
+  }
+
+  for name, value := range headers {
+    req.Header.Set(name, value)
   }
 
   /* Allow for tokens or other pre-created secrets */
   if client.auth_header != "" {
-    req.Header.Set("Authorization", client.auth_header)
+    auth_header := client.auth_header
+    if client.env_interpolation {
+      if auth_header, err = interpolate_env(auth_header, no_escape); err != nil { return nil, err }
+    }
+    req.Header.Set("Authorization", auth_header)
   } else if client.username != "" && client.password != "" {
     /* ... and fall back to basic auth if configured */
     req.SetBasicAuth(client.username, client.password)
   }
+  if client.logs("auth") {
+    scheme := "none"
+    if client.auth_header != "" {
+      scheme = "authorization_header"
+    } else if client.username != "" && client.password != "" {
+      scheme = "basic"
+    }
+    log_debug("api_client.go", "Authenticating request", "method", method, "path", path, "scheme", scheme)
+  }
 
-  if client.debug {
-    log.Printf("api_client.go: Request headers:\n")
+  if client.logs("http") {
     for name, headers := range req.Header {
       for _, h := range headers {
-       log.Printf("api_client.go:   %v: %v", name, h)
+        log_debug("api_client.go", "Request header", "name", name, "value", redact_header(name, h))
       }
     }
 
-    log.Printf("api_client.go: BODY:\n")
     body := "<none>"
     if req.Body != nil {
       body = string(data)
     }
-    log.Printf("%s\n", body)
+    log_debug("api_client.go", "Request body", "body", body)
+    log_debug("api_client.go", "Request as curl:\n" + curl_command(req, data, client.compress_requests))
+  }
+
+  /* Objects with a timeout of their own get a client that uses it */
+  http_client := client.http_client
+  if timeout, ok := ctx.Value(request_timeout_type{}).(time.Duration); ok && timeout > 0 {
+    override := *client.http_client
+    override.Timeout = timeout
+    http_client = &override
   }
 
-  for num_redirects := client.redirects; num_redirects >= 0; num_redirects-- {
-    resp, err := client.http_client.Do(req)
+  retry_waited := time.Duration(0)
+  retry_after_attempts := 0
+  body_retries := 0
+  transport_retries := 0
+  /* Redirects are followed inside http_client (see check_redirect),
+     so this only loops for retries - each of which is bounded */
+  for {
+    /* Every attempt counts against the rate limit - retries included */
+    if err := client.wait_turn(ctx, method, path); err != nil {
+      return nil, err
+    }
+
+    if err := client.acquire_slot(ctx); err != nil {
+      return nil, err
+    }
+    resp, err := http_client.Do(req)
 
     if err != nil {
-      //log.Printf("api_client.go: Error detected: %s\n", err)
-      return "", err
+      client.release_slot()
+      kind, retryable, sent := classify_transport_error(err)
+      if retryable && transport_retries < client.transport_retries && (!sent || idempotent_method(method)) {
+        wait := client.transport_retry_interval << uint(transport_retries)
+        transport_retries++
+        log_info("api_client.go", "Request failed in transport. Waiting before retrying", "method", method, "path", path, "kind", kind, "attempt", transport_retries, "max_attempts", client.transport_retries, "wait", wait, "error", err)
+        if err := sleep_context(ctx, wait); err != nil { return nil, err }
+        if data != "" { req.Body = ioutil.NopCloser(bytes.NewReader(payload)) }
+        continue
+      }
+      client.breaker_record(err)
+      return nil, &transport_error{ kind: kind, method: method, path: path, err: err }
     }
 
-    if client.debug {
-      log.Printf("api_client.go: Response code: %d\n", resp.StatusCode)
-      log.Printf("api_client.go: Response headers:\n")
+    if client.logs("http") {
+      log_debug("api_client.go", "Response received", "status", resp.StatusCode)
       for name, headers := range resp.Header {
         for _, h := range headers {
-         log.Printf("api_client.go:   %v: %v", name, h)
+          log_debug("api_client.go", "Response header", "name", name, "value", redact_header(name, h))
         }
       }
     }
 
-    bodyBytes, err2 := ioutil.ReadAll(resp.Body)
+    bodyBytes, err2 := decode_body(resp, client.max_response_size)
     resp.Body.Close()
+    client.release_slot()
 
-    if err2 != nil { return "", err2 }
+    if err2 != nil { return nil, err2 }
     body := string(bodyBytes)
+    if client.logs("http") { log_debug("api_client.go", "Response body", "body", body) }
+
+    /* Rate limited or temporarily unavailable. If the server told us
+       how long to back off and it fits within what we are willing to
+       wait in total, sleep and try again */
+    if resp.StatusCode == 429 || resp.StatusCode == 503 {
+      wait, ok := parse_retry_after(resp.Header.Get("Retry-After"))
+      /* Retry-After: 0 (or a date gone by) adds nothing to what was
+         waited, so the number of attempts has a limit of its own */
+      if ok && retry_waited + wait <= client.max_retry_after && retry_after_attempts < max_retry_after_attempts {
+        log_info("api_client.go", "Honoring Retry-After before retrying", "status", resp.StatusCode, "path", path, "wait", wait)
+        if err := sleep_context(ctx, wait); err != nil { return nil, err }
+        retry_waited += wait
+        retry_after_attempts++
+        if data != "" { req.Body = ioutil.NopCloser(bytes.NewReader(payload)) }
+        continue
+      }
+      if client.logs("polling") { log_debug("api_client.go", "Not waiting for Retry-After", "status", resp.StatusCode, "path", path, "retry_after", resp.Header.Get("Retry-After"), "waited", retry_waited) }
+    }
+
+    /* Some APIs say "try again later" in the body of an otherwise
+       normal looking response */
+    if body_retries < client.retry_body_attempts && client.should_retry_body(body) {
+      body_retries++
+      log_info("api_client.go", "Response body matched retry_body_patterns. Waiting before retrying", "path", path, "attempt", body_retries, "max_attempts", client.retry_body_attempts, "wait", client.retry_body_interval)
+      if err := sleep_context(ctx, client.retry_body_interval); err != nil { return nil, err }
+      if data != "" { req.Body = ioutil.NopCloser(bytes.NewReader(payload)) }
+      continue
+    }
+
+    if resp.StatusCode == 304 {
+      /* Only sent in answer to a conditional request - the caller
+         asked for it and knows what to do with it */
+      client.breaker_record(nil)
+      return &api_response{ status: resp.StatusCode, headers: resp.Header, body: body }, nil
+    } else if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+      /* Only reached when the redirect policy said not to follow it */
+      client.breaker_record(nil)
+      return nil, fmt.Errorf("Unexpected response code '%d': redirect to '%s' was not followed (follow_redirects is false)", resp.StatusCode, resp.Header.Get("Location"))
+    } else if resp.StatusCode == 404 || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+      err = &APIError{ StatusCode: resp.StatusCode, Header: resp.Header, Body: body, Method: method, Path: path }
+      if (resp.StatusCode == 401 || resp.StatusCode == 403) && client.logs("auth") {
+        log_debug("api_client.go", "Request was refused", "status", resp.StatusCode, "method", method, "path", path, "www_authenticate", resp.Header.Get("WWW-Authenticate"))
+      }
+      /* Only server side failures say anything about the health of the API */
+      if resp.StatusCode >= 500 {
+        client.breaker_record(err)
+      } else {
+        client.breaker_record(nil)
+      }
+      return nil, err
+    } else if diagnostic := html_diagnostic(resp.Header, body); diagnostic != "" {
+      /* Usually a redirect to a login page that was followed */
+      client.breaker_record(nil)
+      redirected := ""
+      if resp.Request != nil && resp.Request.URL.String() != req.URL.String() { redirected = fmt.Sprintf(" (after a redirect to '%s')", resp.Request.URL) }
+      return nil, fmt.Errorf("Expected JSON from %s '%s'%s, but %s", method, path, redirected, diagnostic)
+    } else if got, ok := client.unexpected_content_type(resp.Header, body); !ok {
+      /* Most likely the path is not the API's at all */
+      client.breaker_record(nil)
+      return nil, fmt.Errorf("Expected a response of type '%s' (expect_content_type) from %s '%s', but got '%s'. Check that the path is right. Response: %s", client.expect_content_type, method, path, got, body)
+    } else {
+      client.breaker_record(nil)
+      return &api_response{ status: resp.StatusCode, headers: resp.Header, body: body }, nil
+    }
+
+  } //End loop through retry attempts
+}
+
+type request_timeout_type struct{}
+
+/* Requests made with the returned context time out after timeout
+   instead of the provider-wide timeout */
+func with_request_timeout (ctx context.Context, timeout time.Duration) context.Context {
+  return context.WithValue(ctx, request_timeout_type{}, timeout)
+}
+
+type request_read_type struct{}
+
+/* Requests made with the returned context are reads (or writes)
+   whatever their method, for APIs that read with POST (read_method) */
+func with_read (ctx context.Context, read bool) context.Context {
+  return context.WithValue(ctx, request_read_type{}, read)
+}
+
+/* Whether a request only reads. When the caller did not say, the
+   method decides */
+func is_read (ctx context.Context, method string) bool {
+  if read, ok := ctx.Value(request_read_type{}).(bool); ok { return read }
+  return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+/* Redirect policy for http_client. net/http drops the Authorization
+   header when a redirect leaves the original host; it is only put
+   back if the user explicitly asked for that */
+func (client *APIClient) check_redirect (req *http.Request, via []*http.Request) error {
+  if !client.follow_redirects {
+    return http.ErrUseLastResponse
+  }
+  if len(via) >= client.redirects {
+    return fmt.Errorf("Stopped after %d redirects (max_redirects)", len(via))
+  }
+
+  original := via[0]
+  if client.redirect_auth && req.URL.Host != original.URL.Host {
+    if auth := original.Header.Get("Authorization"); auth != "" {
+      req.Header.Set("Authorization", auth)
+      if client.logs("auth") { log_debug("api_client.go", "Sending credentials to another host after redirect", "host", req.URL.Host) }
+    }
+  } else if req.URL.Host != original.URL.Host && client.logs("auth") {
+    log_debug("api_client.go", "Dropping credentials on redirect to another host", "host", req.URL.Host)
+  }
+
+  if client.logs("http") {
+    log_debug("api_client.go", "Following redirect", "number", len(via), "method", req.Method, "url", req.URL)
+  }
+  return nil
+}
+
+/* Returns an error if enough consecutive requests have failed that
+   the circuit breaker has tripped. Once tripped, it stays tripped for
+   the life of the client (one terraform run) */
+func (client *APIClient) breaker_check () error {
+  if client.breaker_threshold <= 0 { return nil }
+
+  client.breaker_mutex.Lock()
+  defer client.breaker_mutex.Unlock()
+
+  if client.breaker_failures >= client.breaker_threshold {
+    return fmt.Errorf("Circuit breaker is open: the last %d requests to '%s' failed, so no further requests will be sent. Last error: %s",
+      client.breaker_failures, client.uri, client.breaker_last_error)
+  }
+  return nil
+}
+
+/* Track consecutive failures. A nil error resets the count */
+func (client *APIClient) breaker_record (err error) {
+  if client.breaker_threshold <= 0 { return }
+
+  client.breaker_mutex.Lock()
+  defer client.breaker_mutex.Unlock()
+
+  if err == nil {
+    client.breaker_failures = 0
+    return
+  }
+
+  client.breaker_failures++
+  client.breaker_last_error = err
+  if client.breaker_failures == client.breaker_threshold {
+    log_warn("api_client.go", "Too many consecutive failures. Tripping circuit breaker", "failures", client.breaker_failures, "uri", client.uri)
+  }
+}
+
+/* Reads and writes first wait on their own limit, if any. Then each
+   collection's reads and writes queue separately when fair queueing
+   is on so they take turns at the shared rate limiter */
+func (client *APIClient) wait_turn (ctx context.Context, method string, path string) error {
+  class := "write"
+  limiter := client.write_limiter
+  if is_read(ctx, method) {
+    class = "read"
+    limiter = client.read_limiter
+  }
+  if limiter != nil {
+    if err := limiter.Wait(ctx); err != nil { return err }
+  }
+
+  if client.fair_queue == nil {
+    return client.rate_limiter.Wait(ctx)
+  }
+  return client.fair_queue.wait(ctx, class + " " + queue_key_from(ctx, path))
+}
+
+/* What log_categories may name. Each turns on the debug messages
+   about one thing without the rest of what debug = true prints */
+var log_category_names = map[string]bool{ "http": true, "drift": true, "auth": true, "polling": true }
+
+/* Whether debug messages of category should be written */
+func (client *APIClient) logs (category string) bool {
+  return client.debug || client.log_categories[category]
+}
+
+/* Methods are case sensitive on the wire, but nobody means "patch" */
+func method_or(method string, fallback string) string {
+  if method == "" { return fallback }
+  return strings.ToUpper(method)
+}
 
-    if resp.StatusCode == 301 || resp.StatusCode == 302 {
-      //Redirecting... decrement num_redirects and proceed to the next loop
-      //uri = URI.parse(rsp['Location'])
-    } else if resp.StatusCode == 404 || resp.StatusCode < 200 || resp.StatusCode >= 303 {
-      return "", errors.New(fmt.Sprintf("Unexpected response code '%d': %s", resp.StatusCode, body))
+/* Holds one of max_concurrent_requests slots while a request is on
+   the wire. Sleeping between retries does not hold one */
+func (client *APIClient) acquire_slot (ctx context.Context) error {
+  if client.request_slots == nil { return nil }
+  select {
+  case client.request_slots <- struct{}{}:
+    return nil
+  case <-ctx.Done():
+    return ctx.Err()
+  }
+}
+
+func (client *APIClient) release_slot () {
+  if client.request_slots != nil { <-client.request_slots }
+}
+
+/* Whether a failed delete looks like the object still has
+   dependents the server has not let go of yet */
+func (client *APIClient) should_retry_delete (err error) bool {
+  var api_err *APIError
+  if !errors.As(err, &api_err) { return false }
+
+  for _, status := range client.delete_retry_statuses {
+    if api_err.StatusCode == status { return true }
+  }
+  for _, re := range client.delete_retry_patterns {
+    if re.MatchString(api_err.Body) { return true }
+  }
+  return false
+}
+
+func (client *APIClient) should_retry_body (body string) bool {
+  for _, re := range client.retry_body_patterns {
+    if re.MatchString(body) { return true }
+  }
+  return false
+}
+
+/* All JSON sent to the API is serialized here so the
+   formatting is the same no matter which operation sends it.
+   order is only used when preserve_key_order is set */
+func (client *APIClient) encode_json (v interface{}, order key_order) ([]byte, error) {
+  if !client.preserve_key_order { order = nil }
+
+  b, err := client.canonical_json(v, order)
+  if err != nil { return nil, err }
+
+  if client.pretty_json {
+    var buffer bytes.Buffer
+    if err := json.Indent(&buffer, b, "", "  "); err != nil { return nil, err }
+    return buffer.Bytes(), nil
+  }
+  return b, nil
+}
+
+/* Headers whose values are never logged */
+var secret_header_words = []string{ "authorization", "cookie", "token", "secret", "password", "api-key", "apikey" }
+
+func redact_header (name string, value string) string {
+  lower := strings.ToLower(name)
+  for _, word := range secret_header_words {
+    if strings.Contains(lower, word) { return "REDACTED" }
+  }
+  return value
+}
+
+/* The request as a curl command that can be pasted into a shell
+   to reproduce it outside of terraform. Secrets are redacted */
+func curl_command (req *http.Request, data string, compressed bool) string {
+  quote := func(s string) string { return "'" + strings.Replace(s, "'", `'\''`, -1) + "'" }
+
+  names := make([]string, 0, len(req.Header))
+  for name := range req.Header { names = append(names, name) }
+  sort.Strings(names)
+
+  var buffer bytes.Buffer
+  buffer.WriteString("curl -X " + req.Method + " " + quote(req.URL.String()))
+  if req.Host != "" && req.Host != req.URL.Host {
+    buffer.WriteString(" \\\n  -H " + quote("Host: " + req.Host))
+  }
+  for _, name := range names {
+    for _, value := range req.Header[name] {
+      buffer.WriteString(" \\\n  -H " + quote(name + ": " + redact_header(name, value)))
+    }
+  }
+  if data != "" {
+    if compressed {
+      /* What we log is the body before it was compressed */
+      buffer.WriteString(" \\\n  --data-binary @<(printf '%s' " + quote(data) + " | gzip)")
     } else {
-      if client.debug { log.Printf("api_client.go: BODY:\n%s\n", body) }
-      return body, nil
+      buffer.WriteString(" \\\n  --data-raw " + quote(data))
     }
+  }
+  return buffer.String()
+}
+
+func gzip_bytes (data []byte) ([]byte, error) {
+  var buffer bytes.Buffer
+  writer := gzip.NewWriter(&buffer)
+  if _, err := writer.Write(data); err != nil { return nil, err }
+  if err := writer.Close(); err != nil { return nil, err }
+  return buffer.Bytes(), nil
+}
+
+/* Reads the response body, decompressing it if the server used
+   an encoding we asked for via accept_encoding. When accept_encoding
+   is not set, net/http has already taken care of gzip. Bodies larger
+   than limit bytes (after decompression) are an error, so a runaway
+   endpoint cannot make us read gigabytes into memory */
+func decode_body (resp *http.Response, limit int64) ([]byte, error) {
+  if limit > 0 && resp.ContentLength > limit {
+    return nil, fmt.Errorf("Response is %d bytes, which is more than max_response_size (%d bytes)", resp.ContentLength, limit)
+  }
 
-  } //End loop through redirect attempts
+  var reader io.Reader = resp.Body
+  switch encoding := strings.ToLower(resp.Header.Get("Content-Encoding")); encoding {
+  case "", "identity":
+  case "gzip":
+    gz, err := gzip.NewReader(resp.Body)
+    if err != nil { return nil, err }
+    defer gz.Close()
+    reader = gz
+  case "deflate":
+    zr, err := zlib.NewReader(resp.Body)
+    if err != nil { return nil, err }
+    defer zr.Close()
+    reader = zr
+  default:
+    return nil, fmt.Errorf("Response uses unsupported Content-Encoding '%s'", encoding)
+  }
+
+  if limit <= 0 { return ioutil.ReadAll(reader) }
+  body, err := ioutil.ReadAll(io.LimitReader(reader, limit + 1))
+  if err != nil { return nil, err }
+  if int64(len(body)) > limit {
+    return nil, fmt.Errorf("Response is larger than max_response_size (%d bytes)", limit)
+  }
+  return body, nil
+}
+
+/* time.Sleep that gives up early when ctx is done */
+func sleep_context (ctx context.Context, wait time.Duration) error {
+  select {
+  case <-time.After(wait):
+    return nil
+  case <-ctx.Done():
+    return ctx.Err()
+  }
+}
+
+/* The most times one request is retried for Retry-After, however
+   short the waits */
+const max_retry_after_attempts = 10
+
+/* Retry-After may be either a number of seconds or an HTTP date.
+   Returns false if the header is missing or cannot be understood */
+func parse_retry_after (value string) (time.Duration, bool) {
+  if value == "" { return 0, false }
+
+  if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+    if seconds < 0 { return 0, false }
+    return time.Second * time.Duration(seconds), true
+  }
+
+  if when, err := http.ParseTime(value); err == nil {
+    wait := time.Until(when)
+    if wait < 0 { wait = 0 }
+    return wait, true
+  }
 
-  return "", errors.New("Error - too many redirects!")
+  return 0, false
 }
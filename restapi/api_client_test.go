@@ -1,13 +1,26 @@
 package restapi
 
 import (
+  "context"
+  "fmt"
+  "strconv"
   "log"
   "testing"
+  "io"
+  "io/ioutil"
+  "net"
   "net/http"
+  "os"
+  "path/filepath"
+  "net/http/httptest"
+  "strings"
+  "sync"
   "time"
 )
 
 var api_client_server *http.Server
+var api_client_retry_count int
+var api_client_busy_count int
 
 func TestAPIClient(t *testing.T) {
   debug := false
@@ -16,13 +29,18 @@ func TestAPIClient(t *testing.T) {
   setup_api_client_server()
 
   /* Notice the intentional trailing / */
-  client := NewAPIClient ("http://127.0.0.1:8080/", false, "", "", "", 2, "id", make([]string, 0), false, false, debug)
+  client, err := NewAPIClient (&APIClientOpt{
+    URI: "http://127.0.0.1:8080/",
+    Timeout: 2,
+    MaxRetryAfter: 5,
+    Debug: debug,
+  })
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
 
   var res string
-  var err error
 
   log.Printf("api_client_test.go: Testing standard OK request\n")
-  res, err = client.send_request("GET", "/ok", "")
+  res, err = client.SendRequest("GET", "/ok", "")
   if err != nil { t.Fatalf("client_test.go: %s", err) }
   if res != "It works!" {
     t.Fatalf("client_test.go: Got back '%s' but expected 'It works!'\n", res)
@@ -30,14 +48,158 @@ func TestAPIClient(t *testing.T) {
 
   /* Verify timeout works */
   log.Printf("api_client_test.go: Testing timeout aborts requests\n")
-  res, err = client.send_request("GET", "/slow", "")
+  res, err = client.SendRequest("GET", "/slow", "")
   if err == nil { t.Fatalf("client_test.go: Timeout did not trigger on slow request") }
 
+  /* Verify a per-object timeout overrides the client's */
+  log.Printf("api_client_test.go: Testing per-request timeout override\n")
+  start := time.Now()
+  _, err = client.SendRequestContext(with_request_timeout(context.Background(), 200 * time.Millisecond), "GET", "/slow", "")
+  if err == nil || time.Since(start) > time.Second { t.Fatalf("client_test.go: Request timeout override did not trigger (%s)", time.Since(start)) }
+
+  /* Verify Retry-After is honored */
+  log.Printf("api_client_test.go: Testing Retry-After is honored\n")
+  res, err = client.SendRequest("GET", "/retry", "")
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+  if res != "It works!" || api_client_retry_count != 2 {
+    t.Fatalf("client_test.go: Got back '%s' after %d attempts but expected 'It works!' after 2\n", res, api_client_retry_count)
+  }
+
+  /* Verify retries on body matches */
+  log.Printf("api_client_test.go: Testing retry_body_patterns\n")
+  body_client, err := NewAPIClient (&APIClientOpt{
+    URI: "http://127.0.0.1:8080",
+    Timeout: 2,
+    RetryBodyPatterns: []string{ "try again" },
+    RetryBodyAttempts: 3,
+  })
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+  res, err = body_client.SendRequest("GET", "/busy", "")
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+  if res != "It works!" || api_client_busy_count != 2 {
+    t.Fatalf("client_test.go: Got back '%s' after %d attempts but expected 'It works!' after 2\n", res, api_client_busy_count)
+  }
+
+  /* Verify host_overrides sends traffic for a name to a fixed address */
+  log.Printf("api_client_test.go: Testing host_overrides\n")
+  override_client, _ := NewAPIClient (&APIClientOpt{
+    URI: "http://api.example.test",
+    Timeout: 2,
+    HostOverrides: map[string]string{ "api.example.test": "127.0.0.1:8080" },
+  })
+  res, err = override_client.SendRequest("GET", "/ok", "")
+  if err != nil || res != "It works!" { t.Fatalf("client_test.go: host_overrides did not work: '%s' %v", res, err) }
+
+  /* Verify the Host header can differ from the dialed address */
+  log.Printf("api_client_test.go: Testing host_header\n")
+  host_client, _ := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", Timeout: 2, HostHeader: "api.example.test" })
+  res, err = host_client.SendRequest("GET", "/host", "")
+  if err != nil || res != "api.example.test" { t.Fatalf("client_test.go: host_header was not sent: '%s' %v", res, err) }
+
+  /* Verify redirects are followed, or not, as configured */
+  log.Printf("api_client_test.go: Testing redirect policy\n")
+  res, err = client.SendRequest("GET", "/redirect", "")
+  if err != nil || res != "It works!" { t.Fatalf("client_test.go: Redirect was not followed: '%s' %v", res, err) }
+  no_follow := false
+  no_redirect_client, _ := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", Timeout: 2, FollowRedirects: &no_follow })
+  if _, err = no_redirect_client.SendRequest("GET", "/redirect", ""); err == nil {
+    t.Fatalf("client_test.go: Redirect was followed with follow_redirects = false")
+  }
+
+  /* Verify compressed requests and explicit Accept-Encoding */
+  log.Printf("api_client_test.go: Testing compress_requests and accept_encoding\n")
+  gzip_client, _ := NewAPIClient (&APIClientOpt{
+    URI: "http://127.0.0.1:8080",
+    Timeout: 2,
+    CompressRequests: true,
+    AcceptEncoding: "gzip",
+  })
+  res, err = gzip_client.SendRequest("POST", "/echo_gzip", `{"hello": "world"}`)
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+  if res != `{"hello": "world"}` {
+    t.Fatalf("client_test.go: Got back '%s' but expected the gzip round trip to return the request\n", res)
+  }
+
+  /* Verify conditional requests can get a 304 back */
+  log.Printf("api_client_test.go: Testing If-None-Match\n")
+  etag_res, err := client.send_request(context.Background(), "GET", "/etag", "", nil)
+  if err != nil || etag_res.headers.Get("ETag") != `"v1"` { t.Fatalf("client_test.go: ETag was not returned: %v", err) }
+  etag_res, err = client.send_request(context.Background(), "GET", "/etag", "", map[string]string{ "If-None-Match": `"v1"` })
+  if err != nil || etag_res.status != 304 { t.Fatalf("client_test.go: Conditional request did not return 304: %v", err) }
+
+  /* Verify huge responses are refused */
+  log.Printf("api_client_test.go: Testing max_response_size\n")
+  small_client, _ := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", Timeout: 2, MaxResponseSize: 4 })
+  if _, err = small_client.SendRequest("GET", "/ok", ""); err == nil || !strings.Contains(err.Error(), "max_response_size") {
+    t.Fatalf("client_test.go: Response over max_response_size was accepted: %v", err)
+  }
+
+  /* Verify the circuit breaker trips after consecutive failures */
+  log.Printf("api_client_test.go: Testing circuit breaker trips\n")
+  breaker_client, _ := NewAPIClient (&APIClientOpt{
+    URI: "http://127.0.0.1:8080",
+    Timeout: 2,
+    CircuitBreakerThreshold: 2,
+    Debug: debug,
+  })
+  for i := 0; i < 2; i++ {
+    _, err = breaker_client.SendRequest("GET", "/fail", "")
+    if err == nil { t.Fatalf("client_test.go: Expected /fail to return an error") }
+  }
+  _, err = breaker_client.SendRequest("GET", "/ok", "")
+  if err == nil || !strings.Contains(err.Error(), "Circuit breaker is open") {
+    t.Fatalf("client_test.go: Expected circuit breaker to be open but got: %v", err)
+  }
+
+  /* Verify read_only refuses to change anything */
+  log.Printf("api_client_test.go: Testing read_only mode\n")
+  ro_client, _ := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", Timeout: 2, ReadOnly: true })
+  if _, err = ro_client.SendRequest("GET", "/ok", ""); err != nil { t.Fatalf("client_test.go: read_only blocked a GET: %s", err) }
+  if _, err = ro_client.SendRequest("POST", "/ok", "{}"); err == nil { t.Fatalf("client_test.go: read_only allowed a POST") }
+
+  /* Verify unsupported proxy schemes are rejected */
+  log.Printf("api_client_test.go: Testing proxy_url validation\n")
+  _, err = NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", ProxyURL: "socks5://127.0.0.1:1080" })
+  if err != nil { t.Fatalf("client_test.go: socks5 proxy_url was rejected: %s", err) }
+  _, err = NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", ProxyURL: "ftp://127.0.0.1:21" })
+  if err == nil { t.Fatalf("client_test.go: ftp proxy_url was accepted") }
+
   if debug { log.Println("client_test.go: Stopping HTTP server") }
   shutdown_api_client_server()
   if debug { log.Println("client_test.go: Done") }
 }
 
+func TestAPIClientUnixSocket(t *testing.T) {
+  dir, err := ioutil.TempDir("", "restapi")
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+  defer os.RemoveAll(dir)
+
+  socket := filepath.Join(dir, "api.sock")
+  listener, err := net.Listen("unix", socket)
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+
+  serverMux := http.NewServeMux()
+  serverMux.HandleFunc("/v1/ok", func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte("It works over " + r.Host))
+  })
+  svr := &http.Server{ Handler: serverMux }
+  go svr.Serve(listener)
+  defer svr.Close()
+
+  client, err := NewAPIClient (&APIClientOpt{
+    URI: "unix://" + socket,
+    UnixSocketBaseURL: "http://docker/v1",
+    Timeout: 2,
+  })
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+
+  res, err := client.SendRequest("GET", "/ok", "")
+  if err != nil { t.Fatalf("client_test.go: %s", err) }
+  if res != "It works over docker" {
+    t.Fatalf("client_test.go: Got back '%s' but expected 'It works over docker'\n", res)
+  }
+}
+
 func setup_api_client_server () {
   serverMux := http.NewServeMux()
   serverMux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
@@ -47,6 +209,49 @@ func setup_api_client_server () {
     time.Sleep(9999 * time.Second)
     w.Write([]byte("This will never return!!!!!"))
   })
+  serverMux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+    http.Error(w, "Broken!", http.StatusInternalServerError)
+  })
+  serverMux.HandleFunc("/busy", func(w http.ResponseWriter, r *http.Request) {
+    api_client_busy_count++
+    if api_client_busy_count == 1 {
+      w.Write([]byte(`{"error": "busy, try again later"}`))
+      return
+    }
+    w.Write([]byte("It works!"))
+  })
+  serverMux.HandleFunc("/echo_gzip", func(w http.ResponseWriter, r *http.Request) {
+    /* Expects a gzip body and answers with it, still gzipped */
+    if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Accept-Encoding") != "gzip" {
+      http.Error(w, "Expected gzip", http.StatusBadRequest)
+      return
+    }
+    w.Header().Set("Content-Encoding", "gzip")
+    io.Copy(w, r.Body)
+  })
+  serverMux.HandleFunc("/host", func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(r.Host))
+  })
+  serverMux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+    http.Redirect(w, r, "/ok", http.StatusFound)
+  })
+  serverMux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+    if r.Header.Get("If-None-Match") == `"v1"` {
+      w.WriteHeader(http.StatusNotModified)
+      return
+    }
+    w.Header().Set("ETag", `"v1"`)
+    w.Write([]byte("It works!"))
+  })
+  serverMux.HandleFunc("/retry", func(w http.ResponseWriter, r *http.Request) {
+    api_client_retry_count++
+    if api_client_retry_count == 1 {
+      w.Header().Set("Retry-After", "1")
+      http.Error(w, "Slow down!", http.StatusTooManyRequests)
+      return
+    }
+    w.Write([]byte("It works!"))
+  })
 
 
   api_client_server = &http.Server{
@@ -61,3 +266,302 @@ func setup_api_client_server () {
 func shutdown_api_client_server () {
   api_client_server.Close()
 }
+
+func TestCurlCommand(t *testing.T) {
+  req, _ := http.NewRequest("PUT", "http://127.0.0.1:8080/api/objects/1", nil)
+  req.Header.Set("Content-Type", "application/json")
+  req.Header.Set("Authorization", "Bearer hunter2")
+
+  cmd := curl_command(req, `{"name":"it's"}`, false)
+  expected := "curl -X PUT 'http://127.0.0.1:8080/api/objects/1' \\\n" +
+    "  -H 'Authorization: REDACTED' \\\n" +
+    "  -H 'Content-Type: application/json' \\\n" +
+    "  --data-raw '{\"name\":\"it'\\''s\"}'"
+  if cmd != expected {
+    t.Fatalf("api_client_test.go: Got curl command\n%s\nbut expected\n%s", cmd, expected)
+  }
+}
+
+func TestPermissionError(t *testing.T) {
+  err := &APIError{
+    StatusCode: 403,
+    Header: http.Header{ "Www-Authenticate": []string{ `Bearer error="insufficient_scope", scope="things:write"` } },
+    Body: `{"message": "forbidden", "missing_permissions": ["things.create"]}`,
+    Method: "POST",
+    Path: "/api/things",
+  }
+  if !err.IsPermissionError() { t.Fatalf("api_client_test.go: 403 was not classified as a permission error") }
+
+  expected := "Unexpected response code '403': the provider's credentials lack permission to POST '/api/things' (scope things:write; missing_permissions [things.create])"
+  if !strings.HasPrefix(err.Error(), expected) {
+    t.Fatalf("api_client_test.go: Got error '%s' but expected it to start with '%s'", err.Error(), expected)
+  }
+}
+
+func TestHTMLResponses(t *testing.T) {
+  page := "<!DOCTYPE html>\n<html><head><title>Sign in</title></head><body>" + strings.Repeat("<p>Please sign in</p>", 20) + "</body></html>"
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/api/things/1":
+      http.Redirect(w, r, "/login", 302)
+    case "/login":
+      w.Header().Set("Content-Type", "text/html; charset=utf-8")
+      w.Write([]byte(page))
+    case "/api/things/2":
+      /* A gateway error with no Content-Type at all */
+      w.Header()["Content-Type"] = nil
+      w.WriteHeader(502)
+      w.Write([]byte("<html><body><h1>502 Bad Gateway</h1></body></html>"))
+    default:
+      w.Write([]byte(`{ "id": "3" }`))
+    }
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  _, err := client.send_request(context.Background(), "GET", "/api/things/1", "", nil)
+  if err == nil || !strings.Contains(err.Error(), "received HTML, likely an auth redirect or proxy error") || !strings.Contains(err.Error(), "/login") {
+    t.Fatalf("api_client_test.go: Expected the login page to be diagnosed but got '%v'", err)
+  }
+  if !strings.HasSuffix(err.Error(), "...") || strings.Contains(err.Error(), "</html>") {
+    t.Fatalf("api_client_test.go: Expected only the start of the page in '%s'", err)
+  }
+
+  _, err = client.send_request(context.Background(), "GET", "/api/things/2", "", nil)
+  if err == nil || !strings.Contains(err.Error(), "Unexpected response code '502': received HTML") {
+    t.Fatalf("api_client_test.go: Expected the gateway error page to be diagnosed but got '%v'", err)
+  }
+
+  if _, err := client.send_request(context.Background(), "GET", "/api/things/3", "", nil); err != nil {
+    t.Fatalf("api_client_test.go: JSON was taken for HTML: %s", err)
+  }
+}
+
+func TestExpectContentType(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/api/things":
+      w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    case "/api/hal":
+      w.Header().Set("Content-Type", "application/hal+json")
+    case "/metrics":
+      w.Header().Set("Content-Type", "text/plain")
+    case "/empty":
+      w.WriteHeader(204)
+      return
+    }
+    w.Write([]byte(`{}`))
+  }))
+  defer server.Close()
+
+  if _, err := NewAPIClient(&APIClientOpt{ URI: server.URL, ExpectContentType: "json" }); err == nil {
+    t.Fatalf("api_client_test.go: An invalid expect_content_type was accepted")
+  }
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, ExpectContentType: "application/json" })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+  for _, path := range []string{ "/api/things", "/api/hal", "/empty" } {
+    if _, err := client.send_request(context.Background(), "GET", path, "", nil); err != nil { t.Fatalf("api_client_test.go: '%s' was refused: %s", path, err) }
+  }
+  _, err = client.send_request(context.Background(), "GET", "/metrics", "", nil)
+  if err == nil || !strings.Contains(err.Error(), "but got 'text/plain'") {
+    t.Fatalf("api_client_test.go: Expected text/plain to be refused but got '%v'", err)
+  }
+}
+
+func TestShouldRetryDelete(t *testing.T) {
+  client, err := NewAPIClient (&APIClientOpt{
+    URI: "http://127.0.0.1:8080",
+    DeleteRetryStatuses: []int{ 409 },
+    DeleteRetryBodyPatterns: []string{ "(?i)has dependents" },
+  })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+
+  if !client.should_retry_delete(&APIError{ StatusCode: 409 }) { t.Fatalf("api_client_test.go: 409 delete was not retried") }
+  if !client.should_retry_delete(&APIError{ StatusCode: 400, Body: "Network HAS DEPENDENTS" }) { t.Fatalf("api_client_test.go: Delete matching delete_retry_body_patterns was not retried") }
+  if client.should_retry_delete(&APIError{ StatusCode: 500, Body: "boom" }) { t.Fatalf("api_client_test.go: Unrelated delete failure was retried") }
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+  var mutex sync.Mutex
+  in_flight, most := 0, 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    mutex.Lock()
+    in_flight++
+    if in_flight > most { most = in_flight }
+    mutex.Unlock()
+    time.Sleep(50 * time.Millisecond)
+    mutex.Lock()
+    in_flight--
+    mutex.Unlock()
+    w.Write([]byte("ok"))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient (&APIClientOpt{ URI: server.URL, Timeout: 5, MaxConcurrentRequests: 2 })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+
+  var wg sync.WaitGroup
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      if _, err := client.SendRequest("POST", "/things", `{}`); err != nil { t.Errorf("api_client_test.go: %s", err) }
+    }()
+  }
+  wg.Wait()
+
+  if most > 2 { t.Fatalf("api_client_test.go: %d requests were in flight at once with max_concurrent_requests = 2", most) }
+}
+
+func TestIPFamily(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte("ok"))
+  }))
+  defer server.Close()
+
+  for family, works := range map[string]bool{ "auto": true, "ipv4": true, "ipv6": false, "prefer_ipv6": true } {
+    client, err := NewAPIClient (&APIClientOpt{ URI: server.URL, Timeout: 5, IPFamily: family })
+    if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+    _, err = client.SendRequest("GET", "/", "")
+    if works && err != nil { t.Fatalf("api_client_test.go: Request with ip_family = %s failed: %s", family, err) }
+    if !works && err == nil { t.Fatalf("api_client_test.go: Request to an IPv4 server with ip_family = %s succeeded", family) }
+  }
+
+  if _, err := NewAPIClient (&APIClientOpt{ URI: server.URL, IPFamily: "ipv5" }); err == nil {
+    t.Fatalf("api_client_test.go: Invalid ip_family was accepted")
+  }
+}
+
+func TestLocalAddress(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    host, _, _ := net.SplitHostPort(r.RemoteAddr)
+    w.Write([]byte(host))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient (&APIClientOpt{ URI: server.URL, Timeout: 5, LocalAddress: "127.0.0.1" })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+  res, err := client.SendRequest("GET", "/", "")
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+  if res != "127.0.0.1" { t.Fatalf("api_client_test.go: Connection came from '%s' instead of local_address", res) }
+
+  if _, err := NewAPIClient (&APIClientOpt{ URI: server.URL, LocalAddress: "no-such-interface0" }); err == nil {
+    t.Fatalf("api_client_test.go: Unknown local_address interface was accepted")
+  }
+}
+
+func TestHTTP2(t *testing.T) {
+  server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(r.Proto))
+  }))
+  server.EnableHTTP2 = true
+  server.StartTLS()
+  defer server.Close()
+
+  for setting, proto := range map[string]string{ "": "HTTP/2.0", "auto": "HTTP/2.0", "force": "HTTP/2.0", "disable": "HTTP/1.1" } {
+    client, err := NewAPIClient (&APIClientOpt{ URI: server.URL, Timeout: 5, Insecure: true, HTTP2: setting })
+    if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+    res, err := client.SendRequest("GET", "/", "")
+    if err != nil { t.Fatalf("api_client_test.go: Request with http2 = '%s' failed: %s", setting, err) }
+    if res != proto { t.Fatalf("api_client_test.go: Request with http2 = '%s' was made over %s instead of %s", setting, res, proto) }
+  }
+}
+
+/* Terraform walks the graph in parallel against a single client.
+   Run with -race to catch shared state that is not synchronized */
+func TestConcurrentClientUse(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("ETag", `"` + r.URL.Path + `"`)
+    w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient (&APIClientOpt{
+    URI: server.URL,
+    Timeout: 5,
+    CacheTTL: 60,
+    CircuitBreakerThreshold: 100,
+    CorrelationIDHeader: "X-Correlation-ID",
+    FairQueueing: true,
+    RateLimit: 10000,
+    MaxConcurrentRequests: 4,
+  })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+
+  var wg sync.WaitGroup
+  for i := 0; i < 20; i++ {
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      path := fmt.Sprintf("/things/%d", i % 5)
+      obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/things", ID: strconv.Itoa(i % 5), Data: `{ "id": "x" }`, Timeout: 5 })
+      if err != nil { t.Errorf("api_client_test.go: %s", err); return }
+      for j := 0; j < 5; j++ {
+        if err := obj.ReadObject(); err != nil { t.Errorf("api_client_test.go: %s", err); return }
+        if obj.APIData()["path"] != path || obj.ETag() != `"` + path + `"` {
+          t.Errorf("api_client_test.go: Object %s got another request's response: %v", path, obj.APIData())
+          return
+        }
+        if j == 2 {
+          if res, err := client.send_request(context.Background(), "PUT", path, `{}`, map[string]string{ "X-N": strconv.Itoa(i) }); err != nil || res.status != 200 {
+            t.Errorf("api_client_test.go: %v", err)
+          }
+        }
+      }
+    }(i)
+  }
+  wg.Wait()
+}
+
+func TestLogCategories(t *testing.T) {
+  client, err := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", LogCategories: []string{ "drift", "auth" } })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+  if !client.logs("drift") || !client.logs("auth") { t.Fatalf("api_client_test.go: Categories named in log_categories are not logged") }
+  if client.logs("http") { t.Fatalf("api_client_test.go: http is logged without being in log_categories") }
+
+  client, err = NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", Debug: true })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+  if !client.logs("polling") { t.Fatalf("api_client_test.go: debug does not turn on every category") }
+
+  if _, err := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", LogCategories: []string{ "everything" } }); err == nil {
+    t.Fatalf("api_client_test.go: Unknown log category was accepted")
+  }
+}
+
+func TestRetryAfterZero(t *testing.T) {
+  attempts := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    attempts++
+    w.Header().Set("Retry-After", "0")
+    w.WriteHeader(429)
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, MaxRetryAfter: 10 })
+  _, err := client.SendRequest("GET", "/things", "")
+  if err == nil { t.Fatalf("api_client_test.go: A server that always answers 429 did not fail the request") }
+  if attempts != max_retry_after_attempts + 1 { t.Fatalf("api_client_test.go: Expected %d attempts but got %d", max_retry_after_attempts + 1, attempts) }
+}
+
+func TestReadWriteRateLimits(t *testing.T) {
+  client, err := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", RateLimit: 50, RateLimitBurst: 3, WriteRateLimit: 2 })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+
+  /* Reads are only held back by the shared limit */
+  if client.read_limiter != nil { t.Fatalf("api_client_test.go: Reads are limited without read_rate_limit") }
+  if client.write_limiter == nil || client.write_limiter.Limit() != 2 || client.write_limiter.Burst() != 3 {
+    t.Fatalf("api_client_test.go: write_rate_limit = 2 did not set up a limiter of 2 per second sharing rate_limit_burst")
+  }
+  if client.rate_limiter.Limit() != 50 { t.Fatalf("api_client_test.go: write_rate_limit changed the shared rate_limit") }
+}
+
+func TestSkipRefresh(t *testing.T) {
+  client, err := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080" })
+  if err != nil { t.Fatalf("api_client_test.go: %s", err) }
+  if client.skip_refresh != "tagged" { t.Fatalf("api_client_test.go: skip_refresh defaulted to '%s' instead of tagged", client.skip_refresh) }
+
+  if _, err := NewAPIClient (&APIClientOpt{ URI: "http://127.0.0.1:8080", SkipRefresh: "sometimes" }); err == nil {
+    t.Fatalf("api_client_test.go: Unknown skip_refresh was accepted")
+  }
+}
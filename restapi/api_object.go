@@ -1,92 +1,608 @@
 package restapi
 
 import (
-  "log"
+  "context"
   "errors"
   "fmt"
   "encoding/json"
+  "crypto/sha256"
   "bytes"
+  "net/url"
+  "reflect"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
   "github.com/davecgh/go-spew/spew"
 )
 
-type api_object struct {
-  api_client           *api_client
+// APIObjectOpt holds the settings used to construct an APIObject.
+type APIObjectOpt struct {
+  Path  string
+  ID    string
+  Data  string
+  Debug bool
+  Ext   string
+
+  /* Parameters added to the query string of every request made for
+     this object, unless the path already has them */
+  QueryString map[string]string
+
+  /* Parameters added to the query string of just one operation, such
+     as force=true on deletes. These win over QueryString */
+  CreateQueryString  map[string]string
+  ReadQueryString    map[string]string
+  UpdateQueryString  map[string]string
+  DestroyQueryString map[string]string
+
+  /* The statuses that count as success for each operation, such as
+     409 on create for APIs that answer that way when the object is
+     already there. Empty means any 2xx. Statuses that are listed but
+     not 2xx have bodies that are not the object, so it is read */
+  CreateSuccessCodes  []int
+  ReadSuccessCodes    []int
+  UpdateSuccessCodes  []int
+  DestroySuccessCodes []int
+
+  /* The key (or dotted path, such as data.attributes.uuid) holding
+     the object's id. Defaults to the client's id_attribute */
+  IDAttribute string
+
+  /* For APIs that name the id differently in the create response
+     ({"uuid": ...}) than when the object is read ({"id": ...}).
+     Both default to IDAttribute. ReadIDAttribute is also what the
+     id is looked for in Data by */
+  CreateIDAttribute string
+  ReadIDAttribute   string
+
+  /* Override the client's settings of the same name for this object
+     when set. nil means use the client's */
+  CreateReturnsObject *bool
+  WriteReturnsObject  *bool
+
+  /* Where each operation is sent, with {id} standing in for the
+     object's id. Default to Path for creates and Path/{id} for the
+     rest. Ext is added to all of them */
+  CreatePath  string
+  ReadPath    string
+  UpdatePath  string
+  DestroyPath string
+
+  /* For APIs where objects can only be found by searching: reads
+     list SearchPath (Path by default, with {key} placeholders like
+     the paths) and take the first object whose SearchKey (a key,
+     dotted path or JSON pointer) is SearchValue. The list may be
+     wrapped in an object under SearchResultsKey. Not finding it is
+     a 404. The id is then only needed for updates and deletes */
+  SearchPath        string
+  SearchKey         string
+  SearchValue       string
+  SearchResultsKey  string
+
+  /* For objects whose GET is paginated: the key of the list spread
+     across the pages, and the key holding the next page's URL (by
+     default, the Link header's rel="next" is followed) */
+  PageListKey string
+  PageNextKey string
+
+  /* How many times an update that got a 409 is retried after reading
+     the object again. Never done with IfMatch or VersionField */
+  ConflictRetries int
+
+  /* How updates are sent: "put" (the default) sends the whole of
+     Data, "json_patch" sends the RFC 6902 operations that turn
+     OldData, the data last sent, into Data and "merge_patch" the
+     RFC 7386 merge patch that does. Patches are sent as a PATCH
+     unless UpdateMethod is set */
+  UpdateMode string
+  OldData    string
+
+  /* For APIs that want a different body on updates than on creates,
+     or one on deletes (such as a reason). With UpdateData, updates
+     send it instead of Data, so it cannot be used with a patching
+     UpdateMode. Data is still what the object is compared with */
+  UpdateData  string
+  DestroyData string
+
+  /* With the "put" UpdateMode, send only the top level keys of Data
+     that differ from OldData */
+  PartialUpdate bool
+
+  /* Override the client's HTTP method for each operation when set */
+  CreateMethod  string
+  ReadMethod    string
+  UpdateMethod  string
+  DestroyMethod string
+
+  /* When a create response has no id, it is taken from the Location
+     header: the first capture group (or whole match) of this regular
+     expression, or the last path segment when it is empty. Setting it
+     also allows Data without an id when responses are not read */
+  LocationIDPattern string
+
+  /* Where the ids of new objects come from: "server" (the default)
+     has the API assign them. Otherwise the id is made up and put in
+     Data under IDField (IDAttribute by default) before the create:
+     "uuid" is a random UUID, "hash" a hash of the values of IDFields
+     (keys, dotted paths or JSON pointers) and "template" the output
+     of IDTemplate, a name_template style template given .data */
+  IDStrategy string
+  IDField    string
+  IDFields   []string
+  IDTemplate string
+
+  /* When IdempotencyHeader is set, IdempotencyKey (derived from the
+     create request if empty) is sent in it so retried writes are not
+     applied twice */
+  IdempotencyHeader string
+  IdempotencyKey    string
+
+  /* When NameTemplate is set, the NameField key of Data is replaced
+     by the template's output before it is sent, and what the API
+     returns for it is matched without regard to case or punctuation */
+  NameField    string
+  NameTemplate string
+
+  /* Keys (dotted paths or JSON pointers) of what the server adds
+     on its own, such as timestamps and links, that are left out of
+     api_data so refreshes do not keep reporting them as changed */
+  IgnoreKeys []string
+
+  /* How refreshes look for changes made outside of terraform: "none"
+     (the default), "managed_keys" compares only the keys in Data and
+     "full" the whole of what the server returns */
+  DriftDetection string
+
+  /* What a null in Data means, by JSON pointer ("*" for the rest):
+     "null" sends it, "omit" leaves the key out and "delete" leaves
+     it out of creates but sends null on updates */
+  NullPolicy map[string]string
+
+  /* The JSON type to send values as, by JSON pointer ("*" matches
+     any key or index): "string", "number" or "boolean" */
+  Coerce map[string]string
+
+  /* The ETag from the last time the object was read, if any */
+  ETag string
+
+  /* Optimistic locking. With IfMatch, updates and deletes send ETag in
+     If-Match. With VersionField, updates send Version (JSON encoded,
+     as last read from that key) in the body. Either way, a 409 or 412
+     means someone else changed the object since it was last read */
+  IfMatch      bool
+  VersionField string
+  Version      string
+
+  /* Before the object is deleted, WaitForEmpty (a path such as
+     /projects/{id}/items) is listed until it is empty, for APIs that
+     refuse to delete parents that still have children. The list may
+     be wrapped in an object under WaitForEmptyKey. ClearChildrenPath,
+     when set, is sent with ClearChildrenMethod (DELETE by default)
+     first to have the server delete the children itself */
+  WaitForEmpty        string
+  WaitForEmptyKey     string
+  ClearChildrenPath   string
+  ClearChildrenMethod string
+
+  /* When set, a delete is only done once reads of the object answer
+     404 (or 410), for APIs that tear objects down in the background.
+     It is read every delete_retry_interval, for at most
+     WaitForDeletionTimeout seconds when that is set */
+  WaitForDeletion        bool
+  WaitForDeletionTimeout int
+
+  /* For APIs that provision in the background: a create answered
+     with 202 has its Operation-Location (or Location) polled until
+     AsyncStatusKey is AsyncDoneValue ("done" by default) or fails
+     with AsyncFailedValue. The new object's id is then taken from
+     AsyncIDKey of the operation or, without one, what was polled is
+     taken to be the object itself. Polls start AsyncPollInterval
+     seconds apart (1 by default) and back off from there */
+  AsyncStatusKey    string
+  AsyncDoneValue    string
+  AsyncFailedValue  string
+  AsyncIDKey        string
+  AsyncPollInterval int
+
+  /* For WaitForValues, which the resource calls after creates and
+     updates: the object is read every WaitForInterval seconds (5 by
+     default) until the value
+     at WaitForKey (a key, dotted path, JSON pointer or $.a.b path)
+     is one of WaitForValues. WaitForTimeout, when set, bounds the
+     wait in seconds on top of Context */
+  WaitForKey      string
+  WaitForValues   []string
+  WaitForTimeout  int
+  WaitForInterval int
+
+  /* When set, creates, updates and deletes of objects under the
+     same Path are made one at a time */
+  SerializeWrites bool
+
+  /* When set, each request for this object times out after this
+     many seconds instead of the client's Timeout */
+  Timeout int
+
+  /* Requests made for this object are abandoned once this is
+     done. Defaults to context.Background() */
+  Context context.Context
+}
+
+// APIObject is a single RESTful object living under a path of the API
+// that can be created, read, updated and deleted through an APIClient.
+type APIObject struct {
+  api_client           *APIClient
+  ctx                  context.Context
   path                 string
   debug                bool
   ext                  string
+  query_string         map[string]string
+  create_query         map[string]string
+  read_query           map[string]string
+  update_query         map[string]string
+  destroy_query        map[string]string
+  success_codes        map[string][]int
   id                   string
+  id_attribute         string
+  create_id_attribute  string
+  location_id_pattern  *regexp.Regexp
+  create_returns_object bool
+  write_returns_object  bool
+  create_method        string
+  read_method          string
+  update_method        string
+  destroy_method       string
+  conflict_retries     int
+  update_mode          string
+  partial_update       bool
+  wait_for_empty       string
+  wait_for_empty_key   string
+  clear_children_path  string
+  clear_children_method string
+  wait_for_deletion    bool
+  wait_for_deletion_timeout time.Duration
+  async_status_key     string
+  async_done_value     string
+  async_failed_value   string
+  async_id_key         string
+  async_poll_interval  time.Duration
+  wait_for_key         string
+  wait_for_values      []string
+  wait_for_timeout     time.Duration
+  wait_for_interval    time.Duration
+  create_path          string
+  read_path            string
+  update_path          string
+  destroy_path         string
+  search_path          string
+  search_key           string
+  search_value         string
+  search_results_key   string
+  page_list_key        string
+  page_next_key        string
+  idempotency_header   string
+  idempotency_key      string
+  etag                 string
+  name_field           string
+  if_match             bool
+  version_field        string
+  ignore_keys          []string
+  drift_detection      string
+  last_operation       map[string]string
+  version              string
+  lock_etag            string
+  lock_version         string
+  null_policy          null_policy
+  coercion             coercion
+  name                 string
+  not_modified         bool
+  serialize_writes     bool
 
   /* Set internally */
   data         map[string]interface{} /* Data as managed by the user */
+  data_order   key_order              /* Key order of data as the user wrote it */
+  old_data     map[string]interface{} /* Data as last sent, for json_patch updates */
+  update_data  map[string]interface{} /* Sent on updates instead of data, if set */
+  update_order key_order
+  destroy_data string
   api_data     map[string]interface{} /* Data as available from the API */
 }
 
-// Make an api_object to manage a RESTful object in an API
-func NewAPIObject (i_client *api_client, i_path string, i_id string, i_data string, i_debug bool, i_ext string) (*api_object, error) {
-  if i_debug {
-    log.Printf("api_object.go: Constructing debug api_object\n")
-    log.Printf(" path: %s\n", i_path)
-    log.Printf(" id: %s\n", i_id)
-    log.Printf(" ext: %s\n", i_ext)
+// NewAPIObject makes an APIObject to manage a RESTful object in an API
+func NewAPIObject (i_client *APIClient, opt *APIObjectOpt) (*APIObject, error) {
+  if opt.Debug {
+    log_debug("api_object.go", "Constructing debug api_object", "path", opt.Path, "id", opt.ID, "ext", opt.Ext)
   }
 
-  obj := api_object{
+  obj := APIObject{
     api_client: i_client,
-    path: i_path,
-    debug: i_debug,
-    ext: i_ext,
-    id: i_id,
+    ctx: opt.Context,
+    path: opt.Path,
+    debug: opt.Debug,
+    ext: opt.Ext,
+    query_string: opt.QueryString,
+    create_query: opt.CreateQueryString,
+    read_query: opt.ReadQueryString,
+    update_query: opt.UpdateQueryString,
+    destroy_query: opt.DestroyQueryString,
+    success_codes: map[string][]int{ "create": opt.CreateSuccessCodes, "read": opt.ReadSuccessCodes, "update": opt.UpdateSuccessCodes, "destroy": opt.DestroySuccessCodes },
+    id: opt.ID,
+    id_attribute: opt.ReadIDAttribute,
+    create_id_attribute: opt.CreateIDAttribute,
+    idempotency_header: opt.IdempotencyHeader,
+    idempotency_key: opt.IdempotencyKey,
+    etag: opt.ETag,
+    if_match: opt.IfMatch,
+    version_field: opt.VersionField,
+    ignore_keys: opt.IgnoreKeys,
+    drift_detection: opt.DriftDetection,
+    version: opt.Version,
+    lock_etag: opt.ETag,
+    lock_version: opt.Version,
+    serialize_writes: opt.SerializeWrites,
+    conflict_retries: opt.ConflictRetries,
+    update_mode: opt.UpdateMode,
+    partial_update: opt.PartialUpdate,
+    wait_for_empty: opt.WaitForEmpty,
+    wait_for_empty_key: opt.WaitForEmptyKey,
+    clear_children_path: opt.ClearChildrenPath,
+    clear_children_method: method_or(opt.ClearChildrenMethod, "DELETE"),
+    wait_for_deletion: opt.WaitForDeletion,
+    wait_for_deletion_timeout: time.Second * time.Duration(opt.WaitForDeletionTimeout),
+    async_status_key: opt.AsyncStatusKey,
+    async_done_value: opt.AsyncDoneValue,
+    async_failed_value: opt.AsyncFailedValue,
+    async_id_key: opt.AsyncIDKey,
+    async_poll_interval: time.Second * time.Duration(opt.AsyncPollInterval),
+    wait_for_key: opt.WaitForKey,
+    wait_for_values: opt.WaitForValues,
+    wait_for_timeout: time.Second * time.Duration(opt.WaitForTimeout),
+    wait_for_interval: time.Second * time.Duration(opt.WaitForInterval),
+    create_path: opt.CreatePath,
+    read_path: opt.ReadPath,
+    update_path: opt.UpdatePath,
+    destroy_path: opt.DestroyPath,
+    search_key: opt.SearchKey,
+    search_value: opt.SearchValue,
+    search_results_key: opt.SearchResultsKey,
+    page_list_key: opt.PageListKey,
+    page_next_key: opt.PageNextKey,
     data: make(map[string]interface{}),
     api_data: make(map[string]interface{}),
   }
 
-  if "" == i_path { return nil, errors.New("No path passed to api_object constructor") }
-  if "" == i_data { return nil, errors.New("No data passed to api_object constructor") }
+  if obj.ctx == nil { obj.ctx = context.Background() }
+  if obj.id_attribute == "" { obj.id_attribute = opt.IDAttribute }
+  if obj.id_attribute == "" { obj.id_attribute = i_client.id_attribute }
+  if obj.create_id_attribute == "" { obj.create_id_attribute = opt.IDAttribute }
+  if obj.create_id_attribute == "" { obj.create_id_attribute = i_client.id_attribute }
+  if obj.create_path == "" { obj.create_path = opt.Path }
+  if obj.read_path == "" { obj.read_path = opt.Path + "/{id}" }
+  if obj.update_path == "" { obj.update_path = opt.Path + "/{id}" }
+  if obj.destroy_path == "" { obj.destroy_path = opt.Path + "/{id}" }
+  if obj.async_done_value == "" { obj.async_done_value = "done" }
+  if obj.async_poll_interval <= 0 { obj.async_poll_interval = time.Second }
+  if obj.wait_for_interval <= 0 { obj.wait_for_interval = 5 * time.Second }
+  if obj.wait_for_key != "" && len(obj.wait_for_values) == 0 { return nil, fmt.Errorf("wait_for on '%s' needs at least one value to wait for", obj.wait_for_key) }
+  if obj.search_key != "" {
+    obj.search_path = opt.SearchPath
+    if obj.search_path == "" { obj.search_path = opt.Path }
+  }
+  obj.create_method = method_or(opt.CreateMethod, i_client.create_method)
+  obj.read_method = method_or(opt.ReadMethod, i_client.read_method)
+  if obj.update_mode == "" { obj.update_mode = "put" }
+  if update_modes[obj.update_mode] == "" { return nil, fmt.Errorf("Invalid update_mode '%s': must be put, json_patch or merge_patch", obj.update_mode) }
+  if obj.partial_update && obj.update_mode != "put" { return nil, fmt.Errorf("partial_update cannot be used with update_mode '%s'", obj.update_mode) }
+  obj.update_method = method_or(opt.UpdateMethod, i_client.update_method)
+  if obj.update_mode != "put" { obj.update_method = method_or(opt.UpdateMethod, "PATCH") }
+  obj.destroy_method = method_or(opt.DestroyMethod, i_client.destroy_method)
+  obj.create_returns_object = i_client.create_returns_object
+  if opt.CreateReturnsObject != nil { obj.create_returns_object = *opt.CreateReturnsObject }
+  obj.write_returns_object = i_client.write_returns_object
+  if opt.WriteReturnsObject != nil { obj.write_returns_object = *opt.WriteReturnsObject }
+  /* All requests for objects in the same collection share a queue */
+  obj.ctx = with_queue_key(obj.ctx, opt.Path)
+  if opt.Timeout > 0 {
+    obj.ctx = with_request_timeout(obj.ctx, time.Second * time.Duration(opt.Timeout))
+  }
+
+  var err error
+  if obj.null_policy, err = new_null_policy(opt.NullPolicy); err != nil { return nil, err }
+  if obj.coercion, err = new_coercion(opt.Coerce); err != nil { return nil, err }
+  for op, codes := range obj.success_codes {
+    for _, code := range codes {
+      if code < 100 || code > 599 { return nil, fmt.Errorf("Invalid %s_success_codes: %d is not an HTTP status", op, code) }
+    }
+  }
+  if opt.DriftDetection != "" && opt.DriftDetection != "none" && opt.DriftDetection != "managed_keys" && opt.DriftDetection != "full" {
+    return nil, fmt.Errorf("Invalid drift_detection '%s': must be none, managed_keys or full", opt.DriftDetection)
+  }
+  if opt.LocationIDPattern != "" {
+    if obj.location_id_pattern, err = i_client.location_patterns.get(opt.LocationIDPattern); err != nil {
+      return nil, fmt.Errorf("Invalid location_id_pattern '%s': %s", opt.LocationIDPattern, err)
+    }
+  }
 
-  if i_data != ""{
-    if i_debug { log.Printf("api_object.go: Parsing data: '%s'", i_data) }
+  if "" == opt.Path { return nil, errors.New("No path passed to api_object constructor") }
+  if "" == opt.Data { return nil, errors.New("No data passed to api_object constructor") }
 
-    err := json.Unmarshal([]byte(i_data), &obj.data)
+  if opt.Data != ""{
+    if obj.debug { log_debug("api_object.go", "Parsing data", "data", opt.Data) }
+
+    err := json.Unmarshal([]byte(opt.Data), &obj.data)
     if err != nil {
       return nil, err
     }
 
+    if i_client.preserve_key_order {
+      obj.data_order, err = record_key_order(opt.Data)
+      if err != nil { return nil, err }
+    }
+
+    if opt.NameTemplate != "" {
+      if err := obj.apply_name_template(opt.NameField, opt.NameTemplate); err != nil { return nil, err }
+    }
+
+    if opt.UpdateData != "" {
+      if obj.update_mode != "put" { return nil, fmt.Errorf("update_data cannot be used with update_mode '%s'", obj.update_mode) }
+      if obj.partial_update { return nil, errors.New("update_data cannot be used with partial_update") }
+      if err := json.Unmarshal([]byte(opt.UpdateData), &obj.update_data); err != nil { return nil, fmt.Errorf("Invalid update_data: %s", err) }
+      if i_client.preserve_key_order {
+        if obj.update_order, err = record_key_order(opt.UpdateData); err != nil { return nil, err }
+      }
+    }
+    /* So a value coerce cannot convert is reported before anything is sent */
+    if _, err := obj.coercion.apply(obj.data); err != nil { return nil, err }
+    if _, err := obj.coercion.apply(obj.update_data); err != nil { return nil, fmt.Errorf("In update_data: %s", err) }
+    if opt.DestroyData != "" {
+      if !json.Valid([]byte(opt.DestroyData)) { return nil, errors.New("Invalid destroy_data: it is not valid JSON") }
+      obj.destroy_data = opt.DestroyData
+    }
+
+    if opt.OldData != "" {
+      if err := json.Unmarshal([]byte(opt.OldData), &obj.old_data); err != nil { return nil, fmt.Errorf("Invalid old data: %s", err) }
+      /* Sent with the same name, so the template is no change */
+      if obj.name_field != "" {
+        if _, ok := obj.old_data[obj.name_field]; ok { obj.old_data[obj.name_field] = obj.name }
+      }
+    }
+
+    if opt.IDStrategy != "" && !id_strategies[opt.IDStrategy] {
+      return nil, fmt.Errorf("Invalid id_strategy '%s': must be server, uuid, hash or template", opt.IDStrategy)
+    }
+    if _, ok := id_value(obj.data, obj.id_attribute); !ok && obj.id == "" {
+      if err := obj.generate_id(opt.IDStrategy, opt.IDField, opt.IDFields, opt.IDTemplate); err != nil { return nil, err }
+    }
+
     /* Opportunistically set the object's ID if it is provided in the data.
        If it is not set, we will get it later in synchronize_state */
     if obj.id == "" {
-      val, ok := obj.data[obj.api_client.id_attribute]
+      val, ok := id_value(obj.data, obj.id_attribute)
       if ok {
         obj.id = fmt.Sprintf("%v", val)
-      } else if !obj.api_client.write_returns_object && !obj.api_client.create_returns_object {
+      } else if !obj.write_returns_object && !obj.create_returns_object && obj.location_id_pattern == nil && obj.search_path == "" && obj.async_status_key == "" {
         /* If the id is not set and we cannot obtain it
 	   later, error out to be safe */
-        return nil, errors.New(fmt.Sprintf("Provided data does not have %s attribute for the object's id and the client is not configured to read the object from a POST response. Without an id, the object cannot be managed.", obj.api_client.id_attribute))
+        return nil, errors.New(fmt.Sprintf("Provided data does not have %s attribute for the object's id and the client is not configured to read the object from a POST response. Without an id, the object cannot be managed.", obj.id_attribute))
       }
     }
   }
 
-  if obj.debug { log.Printf("api_object.go: Constructed object: %s", obj.toString()) }
+  /* Not ours to send, even when data has them (as data filled in on
+     import does). Only after the id was taken, since it may be one */
+  if len(obj.ignore_keys) > 0 { obj.data = without_keys(obj.data, obj.ignore_keys) }
+
+  if err := obj.check_placeholders(); err != nil { return nil, err }
+
+  if obj.debug { log_debug("api_object.go", "Constructed object:\n" + obj.toString()) }
   return &obj, nil
 }
 
+func (obj *APIObject) apply_name_template(field string, text string) error {
+  if field == "" { return errors.New("name_template is set but name_field is not") }
+  value, ok := obj.data[field]
+  if !ok { return fmt.Errorf("name_field '%s' is not in the data", field) }
+
+  t, err := obj.api_client.name_templates.get(text)
+  if err != nil { return fmt.Errorf("Invalid name_template: %s", err) }
+  name, err := apply_name_template(t, value, obj.data)
+  if err != nil { return fmt.Errorf("name_template failed for '%v': %s", value, err) }
+
+  if obj.debug { log_debug("api_object.go", "Applied name_template", "field", field, "from", value, "to", name) }
+  obj.name_field = field
+  obj.name = name
+  obj.data[field] = name
+  return nil
+}
+
+// ID returns the id of the object, which may be empty until it is created
+func (obj *APIObject) ID() string {
+  return obj.id
+}
+
+// Data returns the data managed by the user for this object
+func (obj *APIObject) Data() map[string]interface{} {
+  return obj.data
+}
+
+// LastOperation describes the last create, update or delete request
+// made for the object that succeeded: its operation (create, update or
+// destroy), method, path, status_code, timestamp (RFC 3339),
+// duration_ms and the request_id the API gave it. It is nil when no
+// such request was made
+func (obj *APIObject) LastOperation() map[string]string {
+  return obj.last_operation
+}
+
+// IdempotencyKey returns the key sent on create when an idempotency
+// header is configured. It must be kept to build keys for updates.
+func (obj *APIObject) IdempotencyKey() string {
+  return obj.idempotency_key
+}
+
+// ETag returns the entity tag the API sent with the object, if any
+func (obj *APIObject) ETag() string {
+  return obj.etag
+}
+
+// Version returns the JSON encoded value of the version field as
+// last read from the API, if a version field is set
+func (obj *APIObject) Version() string {
+  return obj.version
+}
+
+// NotModified reports whether the last RefreshObject found the object
+// unchanged, in which case APIData was not refreshed
+func (obj *APIObject) NotModified() bool {
+  return obj.not_modified
+}
+
+// APIData returns the data most recently received from the API for this object
+func (obj *APIObject) APIData() map[string]interface{} {
+  return obj.api_data
+}
+
+/* Dumps of data and api_data in toString are cut off after
+   this many bytes so huge objects don't flood the logs */
+const max_dump_size = 4096
+
 // Convert the important bits about this object to string representation
 // This is useful for debugging.
-func (obj *api_object) toString() string {
+func (obj *APIObject) toString() string {
   var buffer bytes.Buffer
   buffer.WriteString(fmt.Sprintf("id: %s\n", obj.id))
   buffer.WriteString(fmt.Sprintf("path: %s\n", obj.path))
   buffer.WriteString(fmt.Sprintf("ext: %s\n", obj.ext))
   buffer.WriteString(fmt.Sprintf("debug: %t\n", obj.debug))
-  buffer.WriteString(fmt.Sprintf("data: %s\n", spew.Sdump(obj.data)))
-  buffer.WriteString(fmt.Sprintf("api_data: %s\n", spew.Sdump(obj.api_data)))
+  buffer.WriteString(fmt.Sprintf("data: %s\n", truncate_dump(spew.Sdump(obj.data))))
+  buffer.WriteString(fmt.Sprintf("api_data: %s\n", truncate_dump(spew.Sdump(obj.api_data))))
   return buffer.String()
 }
 
+/* Cheap summary of the object for routine log messages. The full
+   (and expensive) toString dump is only built when debug is set */
+func (obj *APIObject) describe() string {
+  if obj.debug { return obj.toString() }
+  return fmt.Sprintf("id: %s, path: %s (set debug for the full object)", obj.id, obj.path)
+}
+
+func truncate_dump(dump string) string {
+  if len(dump) <= max_dump_size { return dump }
+  return fmt.Sprintf("%s...(truncated %d bytes)", dump[:max_dump_size], len(dump) - max_dump_size)
+}
+
 /* Centralized function to ensure that our data as managed by
    the api_object is updated with data that has come back from
    the API */
-func (obj *api_object) update_state(state string) error {
-  if obj.debug { log.Printf("api_object.go: Updating API object state to '%s'\n", state) }
+func (obj *APIObject) update_state(state string) error {
+  return obj.update_state_from(state, obj.id_attribute)
+}
+
+/* update_state, but an unknown id is looked for under id_attribute */
+func (obj *APIObject) update_state_from(state string, id_attribute string) error {
+  if obj.logs("drift") { log_debug("api_object.go", "Updating API object state", "state", state) }
 
   /* Other option - Decode as JSON Numbers instead of golang datatypes
   d := json.NewDecoder(strings.NewReader(res_str))
@@ -96,115 +612,734 @@ func (obj *api_object) update_state(state string) error {
   err := json.Unmarshal([]byte(state), &obj.api_data)
   if err != nil { return err }
 
+  if obj.version_field != "" {
+    if v, ok := obj.api_data[obj.version_field]; ok {
+      b, err := json.Marshal(v)
+      if err != nil { return err }
+      obj.version = string(b)
+    }
+  }
+
+  /* The API normalized the name we sent. It is still the same name */
+  if obj.name_field != "" {
+    if v, ok := obj.api_data[obj.name_field].(string); ok && v != obj.name && normalize_name(v) == normalize_name(obj.name) {
+      if obj.logs("drift") { log_debug("api_object.go", "API normalized the name", "field", obj.name_field, "sent", obj.name, "returned", v) }
+      obj.api_data[obj.name_field] = obj.name
+    }
+  }
+
   /* A usable ID was not passed (in constructor or here), 
      so we have to guess what it is from the data structure */
   if obj.id == "" {
-    val, ok := obj.api_data[obj.api_client.id_attribute]
+    val, ok := id_value(obj.api_data, id_attribute)
     if ok {
       /* Coax to string */
       obj.id = fmt.Sprintf("%v", val)
-      log.Printf("api_object.go: Updating object id (unset) to '%s'\n", obj.id)
+      log_info("api_object.go", "Updating object id (unset)", "id", obj.id)
     } else {
       /* An ID is REQUIRED to manage the object. We canot proceed */
-      err_message := fmt.Sprintf("api_object.go: Error: %s is not in the data presented nor passed in the constructor.\n", obj.api_client.id_attribute)
+      err_message := fmt.Sprintf("api_object.go: Error: %s is not in the data presented nor passed in the constructor.\n", id_attribute)
       err_message += fmt.Sprintf("List of keys available:\n")
       for k := range obj.data { err_message += fmt.Sprintf("  %s\n", k) }
       errors.New(err_message)
     }
   } else if obj.debug {
-    log.Printf("api_object.go: Not updating id. It is already set to '%s'\n", obj.id)
+    log_debug("api_object.go", "Not updating id. It is already set", "id", obj.id)
   }
 
   /* Any keys that come from the data we want to copy are done here */
   if len(obj.api_client.copy_keys) > 0 {
     for _, key := range obj.api_client.copy_keys {
-      if obj.debug {
-        log.Printf("api_object.go: Copying key '%s' from api_data (%v) to data (%v)\n", key, obj.api_data[key], obj.data[key])
+      if obj.logs("drift") {
+        log_debug("api_object.go", "Copying key from api_data to data", "key", key, "api_data", obj.api_data[key], "data", obj.data[key])
       }
       obj.data[key] = obj.api_data[key]
+      /* They are copied so they are sent, whichever body that is */
+      if obj.update_data != nil { obj.update_data[key] = obj.api_data[key] }
     }
   } else if obj.debug {
-    log.Printf("api_object.go: copy_keys is empty - not attempting to copy data")
+    log_debug("api_object.go", "copy_keys is empty - not attempting to copy data")
   }
 
-  if obj.debug {
-    log.Printf("api_object.go: final object after synchronization of state:\n%+v\n", obj.toString())
+  /* Last, so the id, version and copy_keys can come from them */
+  if len(obj.ignore_keys) > 0 { obj.api_data = without_keys(obj.api_data, obj.ignore_keys) }
+
+  if obj.logs("drift") {
+    log_debug("api_object.go", "Final object after synchronization of state:\n" + obj.toString())
   }
   return err
 }
 
-func (obj *api_object) create_object() error {
+// CreateObject POSTs the object's data to its path and learns its id
+func (obj *APIObject) CreateObject() error {
   /* Failsafe: The constructor should prevent this situation, but
      protect here also. If no id is set, and the API does not respond
      with the id of whatever gets created, we have no way to know what
      the object's id will be. Abandon this attempt */
-  if obj.id == "" && !obj.api_client.write_returns_object && !obj.api_client.create_returns_object {
+  if obj.id == "" && !obj.write_returns_object && !obj.create_returns_object && obj.location_id_pattern == nil && obj.search_path == "" && obj.async_status_key == "" {
     return errors.New("ERROR: Provided object does not have an id set and the client is not configured to read the object from a POST or PUT response. Without an id, the object cannot be managed.")
   }
 
-  b, _ := json.Marshal(obj.data)
-  res_str, err := obj.api_client.send_request("POST", obj.path + obj.ext, string(b))
+  data, err := obj.outgoing(obj.data, "create")
+  if err != nil { return err }
+  b, err := obj.api_client.encode_json(data, obj.data_order)
   if err != nil { return err }
 
-  /* We will need to sync state as well as get the object's ID */
-  if obj.api_client.write_returns_object || obj.api_client.create_returns_object {
+  defer obj.lock_path()()
+
+  path := add_query(obj.op_path(obj.create_path), obj.create_query)
+  headers := make(map[string]string)
+  if obj.idempotency_header != "" {
+    /* Nothing is kept of a create that failed, even when the server
+       did create the object before timing out or answering 5xx. A key
+       that is the same for the same request is what lets the create
+       terraform sends next time be recognized as a retry */
+    if obj.idempotency_key == "" {
+      obj.idempotency_key = name_uuid(obj.create_method + " " + obj.api_client.uri + add_query(path, obj.query_string) + "\n" + string(b))
+    }
+    headers[obj.idempotency_header] = obj.idempotency_key
+  }
+
+  res, err := obj.send_op("create", obj.create_method, path, string(b), headers)
+  if err != nil { return err }
+  if res.status == 202 && obj.async_status_key != "" { return obj.finish_async_create(res) }
+  res_str := res.body
+
+  /* We will need to sync state as well as get the object's ID. A 201
+     with nothing in the body has to be read back like any other */
+  returns_object := obj.write_returns_object || obj.create_returns_object
+  if returns_object && strings.TrimSpace(res_str) != "" && res.status < 300 {
     if obj.debug {
-      log.Printf("api_object.go: Parsing response from POST to update internal structures (write_returns_object=%t, create_returns_object=%t)...\n",
-        obj.api_client.write_returns_object, obj.api_client.create_returns_object)
+      log_debug("api_object.go", "Parsing response from " + obj.create_method + " to update internal structures",
+        "write_returns_object", obj.write_returns_object, "create_returns_object", obj.create_returns_object)
     }
-    err = obj.update_state(res_str)
-    /* Yet another failsafe. In case something terrible went wrong internally,
-       bail out so the user at least knows that the ID did not get set. */
-    if obj.id == "" { return errors.New("Internal validation failed. Object ID is not set, but *may* have been created. This should never happen!") }
+    obj.etag = res.headers.Get("ETag")
+    err = obj.update_state_from(res_str, obj.create_id_attribute)
   } else {
+    returns_object = false
+  }
+
+  if obj.id == "" {
+    if location := res.headers.Get("Location"); location != "" {
+      obj.id = obj.id_from_location(location)
+      log_info("api_object.go", "Took object id from the Location header", "location", location, "id", obj.id)
+    }
+  }
+
+  /* Searching for the object is the only way left to learn its id */
+  if obj.id == "" && obj.search_path != "" {
+    if err := obj.read_created(); err != nil { return fmt.Errorf("Object was created, but could not be found by searching: %w", err) }
+    returns_object = true
+  }
+
+  if obj.id == "" && res.status >= 300 {
+    return fmt.Errorf("Create answered %d, which create_success_codes counts as success, but without an id in data (or search_path) the object cannot be found", res.status)
+  }
+
+  /* Yet another failsafe. In case something terrible went wrong internally,
+     bail out so the user at least knows that the ID did not get set. */
+  if obj.id == "" { return errors.New("Internal validation failed. Object ID is not set, but *may* have been created. This should never happen!") }
+
+  if !returns_object {
     if obj.debug {
-      log.Printf("api_object.go: Requesting created object from API (write_returns_object=%t, create_returns_object=%t)...\n",
-        obj.api_client.write_returns_object, obj.api_client.create_returns_object)
+      log_debug("api_object.go", "Requesting created object from API",
+        "write_returns_object", obj.write_returns_object, "create_returns_object", obj.create_returns_object)
     }
-    err = obj.read_object()
+    err = obj.read_created()
   }
   return err
 }
 
-func (obj *api_object) read_object() error {
-  if obj.id == "" {
+/* Eventually consistent APIs may not serve an object for a while
+   after creating it. The 404 is not cached, so each retry asks */
+func (obj *APIObject) read_created() error {
+  client := obj.api_client
+  for attempt := 0; ; attempt++ {
+    err := obj.read(nil)
+    var api_err *APIError
+    if !errors.As(err, &api_err) || api_err.StatusCode != 404 || attempt >= client.create_read_retries { return err }
+
+    log_info("api_object.go", "New object cannot be read yet. Waiting before retrying", "id", obj.id, "attempt", attempt + 1, "max_attempts", client.create_read_retries, "wait", client.create_read_retry_interval)
+    if err := sleep_context(obj.ctx, client.create_read_retry_interval); err != nil { return err }
+  }
+}
+
+// ReadObject GETs the object from the API and refreshes its state
+func (obj *APIObject) ReadObject() error {
+  if obj.id == "" && obj.search_path == "" {
+    return errors.New("Cannot read an object unless the ID has been set.")
+  }
+
+  return obj.read(nil)
+}
+
+// RefreshObject is ReadObject, but when the client does conditional
+// reads and the object's ETag is known, the API is asked to skip
+// sending the object if it has not changed. See NotModified
+func (obj *APIObject) RefreshObject() error {
+  if obj.id == "" && obj.search_path == "" {
     return errors.New("Cannot read an object unless the ID has been set.")
   }
 
-  res_str, err := obj.api_client.send_request("GET", obj.path + "/" + obj.id + obj.ext, "")
+  headers := make(map[string]string)
+  if obj.api_client.conditional_reads && obj.etag != "" {
+    headers["If-None-Match"] = obj.etag
+  }
+  return obj.read(headers)
+}
+
+func (obj *APIObject) read(headers map[string]string) error {
+  obj.not_modified = false
+  if obj.search_path != "" { return obj.read_search() }
+  res, err := obj.send_op("read", obj.read_method, add_query(obj.op_path(obj.read_path), obj.read_query_string()), "", headers)
   if err != nil { return err }
 
-  err = obj.update_state(res_str)
+  if res.status == 304 {
+    if obj.logs("drift") { log_debug("api_object.go", "Object is unchanged since it was last read", "id", obj.id, "etag", obj.etag) }
+    obj.not_modified = true
+    return nil
+  }
+
+  obj.etag = res.headers.Get("ETag")
+  body := res.body
+  if obj.page_list_key != "" {
+    if body, err = obj.read_pages(res); err != nil { return err }
+  }
+  err = obj.update_state(body)
   return err
 }
 
-func (obj *api_object) update_object() error {
+func (obj *APIObject) read_search() error {
+  path := add_query(obj.expand_placeholders(obj.search_path), obj.read_query_string())
+  value := obj.expand_placeholders(obj.search_value)
+  res, err := obj.send_op("read", obj.read_method, path, "", nil)
+  if err != nil { return err }
+
+  objects, err := parse_collection(res.body, path, obj.search_results_key)
+  if err != nil { return err }
+  for _, o := range objects {
+    v, ok := object_value(o, obj.search_key)
+    if !ok || fmt.Sprintf("%v", v) != value { continue }
+
+    b, err := json.Marshal(o)
+    if err != nil { return err }
+    if obj.logs("drift") { log_debug("api_object.go", "Found object by searching", "path", path, "key", obj.search_key, "value", value) }
+    return obj.update_state(string(b))
+  }
+
+  /* Gone, as far as refreshes are concerned */
+  return &APIError{
+    StatusCode: 404,
+    Method: obj.read_method,
+    Path: path,
+    Body: fmt.Sprintf("No object at '%s' has '%s' = '%s'", path, obj.search_key, value),
+  }
+}
+
+// UpdateObject PUTs the object's data to the API and refreshes its state
+func (obj *APIObject) UpdateObject() error {
   if obj.id == "" {
     return errors.New("Cannot update an object unless the ID has been set.")
   }
 
-  b, _ := json.Marshal(obj.data)
-  res_str, err := obj.api_client.send_request("PUT", obj.path + "/" + obj.id + obj.ext, string(b))
-  if err != nil { return err }
+  /* The version terraform last saw, not whatever a read made just now
+     (for copy_keys) found - that would defeat the point */
+  if obj.version_field != "" && obj.lock_version != "" {
+    var version interface{}
+    if err := json.Unmarshal([]byte(obj.lock_version), &version); err != nil { return err }
+    obj.data[obj.version_field] = version
+    if obj.update_data != nil { obj.update_data[obj.version_field] = version }
+  }
 
-  if obj.api_client.write_returns_object {
-    if obj.debug { log.Printf("api_object.go: Parsing response from PUT to update internal structures (write_returns_object=true)...\n") }
-    err = obj.update_state(res_str)
-  } else {
-    if obj.debug { log.Printf("api_object.go: Requesting updated object from API (write_returns_object=false)...\n") }
-    err = obj.read_object()
+  defer obj.lock_path()()
+  for attempt := 0; ; attempt++ {
+    b, err := obj.update_body()
+    if err != nil { return err }
+    if b == nil {
+      if obj.debug { log_debug("api_object.go", "Nothing to patch. Not sending the update", "id", obj.id) }
+      return obj.ReadObject()
+    }
+
+    /* Reusing the create key would get the create's response replayed.
+       Derive one per body instead so retries of the same update match */
+    headers := make(map[string]string)
+    if obj.idempotency_header != "" && obj.idempotency_key != "" {
+      sum := sha256.Sum256(b)
+      headers[obj.idempotency_header] = fmt.Sprintf("%s-%x", obj.idempotency_key, sum[:8])
+    }
+
+    obj.add_if_match(headers)
+    if obj.update_mode != "put" { headers["Content-Type"] = update_modes[obj.update_mode] }
+
+    res, err := obj.send_op("update", obj.update_method, add_query(obj.op_path(obj.update_path), obj.update_query), string(b), headers)
+    if err != nil {
+      if attempt >= obj.conflict_retries || !obj.retry_conflict(err) { return obj.lock_error("update", err) }
+
+      /* Someone else's write got in first. Read what they left, so
+         copy_keys picks up the new revision, and try again */
+      log_info("api_object.go", "Update conflicted. Reading the object again before retrying", "id", obj.id, "attempt", attempt + 1, "max_attempts", obj.conflict_retries, "error", err)
+      if err := obj.ReadObject(); err != nil { return err }
+      continue
+    }
+
+    if obj.write_returns_object && res.status < 300 {
+      if obj.debug { log_debug("api_object.go", "Parsing response from " + obj.update_method + " to update internal structures", "write_returns_object", true) }
+      obj.etag = res.headers.Get("ETag")
+      return obj.update_state(res.body)
+    }
+    if obj.debug { log_debug("api_object.go", "Requesting updated object from API", "write_returns_object", false) }
+    return obj.ReadObject()
   }
-  return err
 }
 
-func (obj *api_object) delete_object() error {
+/* Each update_mode and the Content-Type its patches are sent with */
+var update_modes = map[string]string{
+  "put": "application/json",
+  "json_patch": "application/json-patch+json",
+  "merge_patch": "application/merge-patch+json",
+}
+
+/* The body of an update, or nil when a patch would be empty */
+func (obj *APIObject) update_body() ([]byte, error) {
+  if obj.update_data != nil {
+    data, err := obj.outgoing(obj.update_data, "update")
+    if err != nil { return nil, err }
+    return obj.api_client.encode_json(data, obj.update_order)
+  }
+  if obj.partial_update { return obj.partial_update_body() }
+  data, err := obj.outgoing(obj.data, "update")
+  if err != nil { return nil, err }
+  if obj.update_mode == "put" { return obj.api_client.encode_json(data, obj.data_order) }
+
+  if obj.old_data == nil { return nil, fmt.Errorf("Cannot patch '%s': update_mode is %s but the data last sent is not known", obj.id, obj.update_mode) }
+  /* What was sent last time may predate a coerce rule it does not
+     fit. Then the whole value shows up as changed, which is right */
+  old, err := obj.outgoing(obj.old_data, "update")
+  if err != nil { old = obj.null_policy.apply(obj.old_data, "update") }
+
+  /* The version goes along with a change, but is not one itself */
+  if obj.update_mode == "merge_patch" {
+    version, has_version := data[obj.version_field]
+    if obj.version_field != "" && has_version {
+      data = without_key(data, obj.version_field)
+      old = without_key(old, obj.version_field)
+    }
+    patch := merge_patch_diff(old, data)
+    if len(patch) == 0 { return nil, nil }
+    if obj.version_field != "" && has_version { patch[obj.version_field] = version }
+    return obj.api_client.encode_json(patch, obj.data_order)
+  }
+
+  /* The version is checked, not written */
+  ops := make([]interface{}, 0)
+  if obj.version_field != "" {
+    if version, ok := data[obj.version_field]; ok {
+      ops = append(ops, map[string]interface{}{ "op": "test", "path": "/" + escape_pointer_token(obj.version_field), "value": version })
+      data = without_key(data, obj.version_field)
+      old = without_key(old, obj.version_field)
+    }
+  }
+  changes := json_patch_diff("", old, data)
+  if len(changes) == 0 { return nil, nil }
+  return json.Marshal(append(ops, changes...))
+}
+
+/* Just the top level keys that changed since the data last sent,
+   with null for those that were removed (which null_policy may
+   leave out). Like a merge patch, but sent as an ordinary update */
+func (obj *APIObject) partial_update_body() ([]byte, error) {
+  if obj.old_data == nil { return nil, fmt.Errorf("Cannot update '%s': partial_update is set but the data last sent is not known", obj.id) }
+
+  partial := make(map[string]interface{})
+  for k := range obj.old_data {
+    if _, ok := obj.data[k]; !ok { partial[k] = nil }
+  }
+  for k, v := range obj.data {
+    if k == obj.version_field { continue }
+    if old, ok := obj.old_data[k]; !ok || !reflect.DeepEqual(old, v) { partial[k] = v }
+  }
+  if len(partial) == 0 { return nil, nil }
+  if version, ok := obj.data[obj.version_field]; ok && obj.version_field != "" { partial[obj.version_field] = version }
+  data, err := obj.outgoing(partial, "update")
+  if err != nil { return nil, err }
+  return obj.api_client.encode_json(data, obj.data_order)
+}
+
+/* data as it is sent for op: with null_policy and coerce applied */
+func (obj *APIObject) outgoing(data map[string]interface{}, op string) (map[string]interface{}, error) {
+  return obj.coercion.apply(obj.null_policy.apply(data, op))
+}
+
+/* Only a plain 409 is worth another go. With if_match or version_field
+   set, a conflict is the lock doing its job and must not be papered over */
+func (obj *APIObject) retry_conflict(err error) bool {
+  if obj.if_match || obj.version_field != "" { return false }
+  var api_err *APIError
+  return errors.As(err, &api_err) && api_err.StatusCode == 409
+}
+
+// DeleteObject removes the object from the API
+func (obj *APIObject) DeleteObject() error {
   if obj.id == "" {
-    log.Printf("WARNING: Attempting to delete an object that has no id set. Assuming this is OK.\n")
+    log_warn("api_object.go", "Attempting to delete an object that has no id set. Assuming this is OK", "path", obj.path)
     return nil
   }
 
-  _, err := obj.api_client.send_request("DELETE", obj.path + "/" + obj.id + obj.ext, "")
-  if err != nil { return err }
+  if err := obj.wait_for_children(); err != nil { return err }
+
+  /* The graph may say the dependents are gone while the server is
+     still letting go of them. Give it delete_retry_timeout to catch up */
+  headers := make(map[string]string)
+  obj.add_if_match(headers)
+
+  defer obj.lock_path()()
+  deadline := time.Now().Add(obj.api_client.delete_retry_timeout)
+  for {
+    _, err := obj.send_op("destroy", obj.destroy_method, add_query(obj.op_path(obj.destroy_path), obj.destroy_query), obj.destroy_data, headers)
+    if err == nil { return obj.wait_for_gone() }
+
+    client := obj.api_client
+    if !client.should_retry_delete(err) {
+      return obj.lock_error("delete", err)
+    }
+    if time.Now().Add(client.delete_retry_interval).After(deadline) {
+      return err
+    }
+    log_info("api_object.go", "Delete was refused because of dependents. Waiting before retrying", "id", obj.id, "wait", client.delete_retry_interval, "error", err)
+    if err := sleep_context(obj.ctx, client.delete_retry_interval); err != nil { return err }
+  }
+}
+
+/* Whatever depends on the object may only go once the API no longer
+   has it, not as soon as it accepted the delete */
+func (obj *APIObject) wait_for_gone() error {
+  if !obj.wait_for_deletion { return nil }
+
+  path := add_query(obj.op_path(obj.read_path), obj.read_query_string())
+  interval := obj.api_client.delete_retry_interval
+  if interval <= 0 { interval = 100 * time.Millisecond }
+  var deadline time.Time
+  if obj.wait_for_deletion_timeout > 0 { deadline = time.Now().Add(obj.wait_for_deletion_timeout) }
+  for {
+    _, err := obj.poll(path)
+    var api_err *APIError
+    if errors.As(err, &api_err) && (api_err.StatusCode == 404 || api_err.StatusCode == 410) { return nil }
+    if err != nil { return err }
+
+    if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+      return fmt.Errorf("Object '%s' was deleted, but could still be read at '%s' after %s", obj.id, path, obj.wait_for_deletion_timeout)
+    }
+    log_info("api_object.go", "Waiting for the deleted object to be gone", "id", obj.id, "path", path, "wait", interval)
+    if err := sleep_context(obj.ctx, interval); err != nil {
+      return fmt.Errorf("Gave up waiting for the deleted object '%s' to be gone from '%s': %w", obj.id, path, err)
+    }
+  }
+}
+
+/* Children are usually deleted in the background, so the list is
+   polled every delete_retry_interval until it is empty or the delete
+   times out. A child collection that is gone altogether is empty */
+func (obj *APIObject) wait_for_children() error {
+  if obj.wait_for_empty == "" { return nil }
+
+  if obj.clear_children_path != "" {
+    log_info("api_object.go", "Asking the API to delete the object's children", "id", obj.id, "method", obj.clear_children_method, "path", obj.clear_children_path)
+    if _, err := obj.send(obj.clear_children_method, obj.op_path(obj.clear_children_path), "", nil); err != nil {
+      return fmt.Errorf("Could not delete the children of '%s': %w", obj.id, err)
+    }
+  }
+
+  path := obj.op_path(obj.wait_for_empty)
+  interval := obj.api_client.delete_retry_interval
+  if interval <= 0 { interval = 100 * time.Millisecond }
+  for {
+    res, err := obj.poll(path)
+    var api_err *APIError
+    if errors.As(err, &api_err) && api_err.StatusCode == 404 { return nil }
+    if err != nil { return err }
+
+    children, err := parse_collection(res.body, path, obj.wait_for_empty_key)
+    if err != nil { return err }
+    if len(children) == 0 { return nil }
+
+    log_info("api_object.go", "Waiting for the object's children to be deleted", "id", obj.id, "path", path, "children", len(children), "wait", interval)
+    if err := sleep_context(obj.ctx, interval); err != nil {
+      return fmt.Errorf("Gave up waiting for the %d children at '%s' to be deleted: %w", len(children), path, err)
+    }
+  }
+}
+
+/* Holds the lock for the object's path when serialize_writes is set.
+   The follow-up read of a create or update is held to it as well */
+func (obj *APIObject) lock_path() func() {
+  if !obj.serialize_writes { return func() {} }
+  return obj.api_client.path_locks.lock(obj.path)
+}
+
+var path_placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+/* The object's own debug turns on everything, like the client's */
+func (obj *APIObject) logs(category string) bool {
+  return obj.debug || obj.api_client.logs(category)
+}
+
+/* The path for an operation, from its create_path/read_path/...
+   {id} is the object's id and any other {key} (or {dotted.path})
+   is taken from data, for objects nested under a parent */
+func (obj *APIObject) op_path(template string) string {
+  return obj.expand_placeholders(template) + obj.ext
+}
 
+func (obj *APIObject) expand_placeholders(template string) string {
+  return path_placeholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+    if v, ok := obj.placeholder_value(placeholder[1:len(placeholder) - 1]); ok { return v }
+    return placeholder
+  })
+}
+
+/* {id}, or a key (or dotted path) of data. {data.name} is the same
+   as {name}, unless data has a "data" key of its own */
+func (obj *APIObject) placeholder_value(key string) (string, bool) {
+  if key == "id" { return obj.id, true }
+  if v, ok := id_value(obj.data, key); ok { return fmt.Sprintf("%v", v), true }
+  if strings.HasPrefix(key, "data.") {
+    if v, ok := id_value(obj.data, strings.TrimPrefix(key, "data.")); ok { return fmt.Sprintf("%v", v), true }
+  }
+  return "", false
+}
+
+/* Query values are more likely than paths to have braces of their
+   own, such as a JSON filter, so only {key} and {dotted.key} count */
+var query_placeholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+/* read_query_string with placeholders in its values filled in, so
+   APIs that find objects by query (?name={data.name}) can be read */
+func (obj *APIObject) read_query_string() map[string]string {
+  if len(obj.read_query) == 0 { return obj.read_query }
+  query := make(map[string]string, len(obj.read_query))
+  for k, v := range obj.read_query {
+    query[k] = query_placeholder.ReplaceAllStringFunc(v, func(placeholder string) string {
+      if v, ok := obj.placeholder_value(placeholder[1:len(placeholder) - 1]); ok { return v }
+      return placeholder
+    })
+  }
+  return query
+}
+
+/* A path that would be sent with a placeholder in it is a config
+   problem, so it is caught before anything is sent */
+func (obj *APIObject) check_placeholders() error {
+  for _, template := range []string{ obj.create_path, obj.read_path, obj.update_path, obj.destroy_path, obj.wait_for_empty, obj.clear_children_path, obj.search_path, obj.search_value } {
+    for _, match := range path_placeholder.FindAllStringSubmatch(template, -1) {
+      if _, ok := obj.placeholder_value(match[1]); !ok {
+        return fmt.Errorf("Path '%s' refers to {%s}, but data has no such key", template, match[1])
+      }
+    }
+  }
+  for k, template := range obj.read_query {
+    for _, match := range query_placeholder.FindAllStringSubmatch(template, -1) {
+      if _, ok := obj.placeholder_value(match[1]); !ok {
+        return fmt.Errorf("read_query_string '%s' refers to {%s}, but data has no such key", k, match[1])
+      }
+    }
+  }
   return nil
 }
+
+/* Patterns are compiled once per client no matter how many objects
+   (or operations on them) use the same one */
+type regexp_cache struct {
+  mutex    sync.Mutex
+  patterns map[string]*regexp.Regexp
+}
+
+func (c *regexp_cache) get(pattern string) (*regexp.Regexp, error) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  if re, ok := c.patterns[pattern]; ok { return re, nil }
+  re, err := regexp.Compile(pattern)
+  if err != nil { return nil, err }
+  if c.patterns == nil { c.patterns = make(map[string]*regexp.Regexp) }
+  c.patterns[pattern] = re
+  return re, nil
+}
+
+func (obj *APIObject) id_from_location(location string) string {
+  if obj.location_id_pattern != nil {
+    match := obj.location_id_pattern.FindStringSubmatch(location)
+    if len(match) > 1 { return match[1] }
+    if len(match) == 1 { return match[0] }
+    return ""
+  }
+
+  /* Locations may be absolute URLs and carry a query string */
+  if u, err := url.Parse(location); err == nil { location = u.Path }
+  location = strings.TrimSuffix(strings.TrimSuffix(location, "/"), obj.ext)
+  return location[strings.LastIndex(location, "/") + 1:]
+}
+
+/* Finds the id under attribute, which may be a dotted path into
+   nested objects (data.attributes.uuid). A top level key that
+   happens to contain dots wins, so existing settings keep working */
+func id_value(data map[string]interface{}, attribute string) (interface{}, bool) {
+  if v, ok := data[attribute]; ok { return v, true }
+  if !strings.Contains(attribute, ".") { return nil, false }
+
+  var current interface{} = data
+  for _, part := range strings.Split(attribute, ".") {
+    m, ok := current.(map[string]interface{})
+    if !ok { return nil, false }
+    if current, ok = m[part]; !ok { return nil, false }
+  }
+  return current, current != nil
+}
+
+/* A copy of data with the (dotted) key removed. The maps on the way
+   to it are copied too, so data itself is left alone */
+func without_key(data map[string]interface{}, key string) map[string]interface{} {
+  out := make(map[string]interface{}, len(data))
+  for k, v := range data { out[k] = v }
+  if _, ok := out[key]; ok {
+    delete(out, key)
+    return out
+  }
+
+  parts := strings.SplitN(key, ".", 2)
+  if len(parts) == 2 {
+    if nested, ok := out[parts[0]].(map[string]interface{}); ok { out[parts[0]] = without_key(nested, parts[1]) }
+  }
+  return out
+}
+
+/* Keys are dotted paths as for without_key or JSON pointers. Ones
+   that are not there are fine - servers do not always send them */
+func without_keys(data map[string]interface{}, keys []string) map[string]interface{} {
+  for _, key := range keys {
+    if !strings.HasPrefix(key, "/") {
+      data = without_key(data, key)
+      continue
+    }
+    tokens, err := parse_pointer(key)
+    if err != nil || len(tokens) == 0 { continue }
+    if stripped, err := pointer_remove(deep_copy(data), tokens); err == nil {
+      if m, ok := stripped.(map[string]interface{}); ok { data = m }
+    }
+  }
+  return data
+}
+
+func (obj *APIObject) add_if_match(headers map[string]string) {
+  if obj.if_match && obj.lock_etag != "" {
+    headers["If-Match"] = obj.lock_etag
+  }
+}
+
+/* With locking on, a conflict means the object was changed out of
+   band. Say so instead of just passing the status code along */
+func (obj *APIObject) lock_error(op string, err error) error {
+  if !obj.if_match && obj.version_field == "" { return err }
+
+  var api_err *APIError
+  if errors.As(err, &api_err) && (api_err.StatusCode == 409 || api_err.StatusCode == 412) {
+    return fmt.Errorf("Refusing to %s '%s': it was changed outside of terraform since it was last read (%d). Refresh and review the changes before applying again: %w",
+      op, obj.id, api_err.StatusCode, err)
+  }
+  return err
+}
+
+/* Every request made on behalf of this object goes through here */
+func (obj *APIObject) send(method string, path string, data string, headers map[string]string) (*api_response, error) {
+  return obj.send_op("", method, path, data, headers)
+}
+
+/* send for one of the object's operations, which decides what
+   counts as success when it has <op>_success_codes */
+func (obj *APIObject) send_op(op string, method string, path string, data string, headers map[string]string) (*api_response, error) {
+  path = add_query(path, obj.query_string)
+  ctx := obj.ctx
+  switch op {
+  case "read":
+    ctx = with_read(ctx, true)
+  case "create", "update", "destroy":
+    ctx = with_read(ctx, false)
+  }
+  start := time.Now()
+  res, err := obj.api_client.send_request(ctx, method, path, data, headers)
+  if codes := obj.success_codes[op]; len(codes) > 0 { res, err = expect_status(op, codes, method, path, res, err) }
+  /* By operation, since reads may well be POSTs (read_method) */
+  if err == nil && (op == "create" || op == "update" || op == "destroy") { obj.record_operation(op, method, path, res, start) }
+  return res, err
+}
+
+func expect_status(op string, codes []int, method string, path string, res *api_response, err error) (*api_response, error) {
+  status := 0
+  var api_err *APIError
+  if err == nil {
+    /* The answer to a conditional read is not up to the user */
+    if res.status == 304 { return res, nil }
+    status = res.status
+  } else if errors.As(err, &api_err) {
+    status = api_err.StatusCode
+  } else {
+    return res, err
+  }
+
+  for _, code := range codes {
+    if code != status { continue }
+    if api_err != nil {
+      log_info("api_object.go", "Response counts as success (" + op + "_success_codes)", "method", method, "path", path, "status", status)
+      return &api_response{ status: status, headers: api_err.Header, body: api_err.Body }, nil
+    }
+    return res, nil
+  }
+  if api_err != nil { return nil, err }
+  return nil, &APIError{ StatusCode: status, Header: res.headers, Body: res.body, Method: method, Path: path }
+}
+
+/* The last write that succeeded, for LastOperation. Reads that
+   follow it (and refreshes) are not what anyone wants to audit */
+func (obj *APIObject) record_operation(op string, method string, path string, res *api_response, start time.Time) {
+  client := obj.api_client
+  request_id := res.headers.Get(client.request_id_header)
+  if request_id == "" && client.correlation_header != "" { request_id = res.headers.Get(client.correlation_header) }
+  obj.last_operation = map[string]string{
+    "operation":   op,
+    "method":      method,
+    "path":        path,
+    "status_code": strconv.Itoa(res.status),
+    "timestamp":   start.UTC().Format(time.RFC3339),
+    "duration_ms": strconv.FormatInt(int64(time.Since(start) / time.Millisecond), 10),
+    "request_id":  request_id,
+  }
+}
+
+/* A poll has to see the server change, so the response cache is
+   skipped. It reads the way the object is read (read_method) */
+func (obj *APIObject) poll(path string) (*api_response, error) {
+  if obj.logs("polling") { log_debug("api_object.go", "Polling", "id", obj.id, "path", path) }
+  return obj.api_client.traced_request(with_read(obj.ctx, true), obj.read_method, add_query(path, obj.query_string), "", nil)
+}
+
+/* Adds params to the query string of path. Next page links often
+   repeat the parameters they were asked with, and operations' own
+   parameters are added first, so those already there are kept */
+func add_query(path string, params map[string]string) string {
+  if len(params) == 0 { return path }
+
+  existing := url.Values{}
+  if i := strings.Index(path, "?"); i >= 0 { existing, _ = url.ParseQuery(path[i + 1:]) }
+  keys := make([]string, 0, len(params))
+  for k := range params {
+    if _, ok := existing[k]; !ok { keys = append(keys, k) }
+  }
+  if len(keys) == 0 { return path }
+  /* Sorted so the same object always makes the same requests */
+  sort.Strings(keys)
+
+  query := make([]string, len(keys))
+  for i, k := range keys { query[i] = url.QueryEscape(k) + "=" + url.QueryEscape(params[k]) }
+  separator := "?"
+  if strings.Contains(path, "?") { separator = "&" }
+  return path + separator + strings.Join(query, "&")
+}
@@ -5,7 +5,14 @@ import (
   "testing"
   "encoding/json"
   "fmt"
-  "github.com/Mastercard/terraform-provider-restapi/fakeserver"
+  "errors"
+  "strings"
+  "net/http"
+  "net/http/httptest"
+  "sync"
+  "time"
+  "io/ioutil"
+  "github.com/TrurlMcByte/terraform-provider-restapi/fakeserver"
 )
 
 var test_debug = false
@@ -30,7 +37,7 @@ func TestAPIObject(t *testing.T) {
 
   /* Holds the full list of api_object items that we are testing
      indexed by the name of the test case */
-  testing_objects := make(map[string]*api_object)
+  testing_objects := make(map[string]*APIObject)
 
   /* Messy... fakeserver wants "generic" objects, but it is much easier
      to write our test cases with typed (test_api_object) objects. Make
@@ -39,31 +46,26 @@ func TestAPIObject(t *testing.T) {
   api_server_objects := make(map[string]map[string]interface{})
   generate_test_api_objects(&generated_objects, &api_server_objects, t, test_debug)
 
-  client := NewAPIClient (
-    "http://127.0.0.1:8081/",  /* URL */
-    false,                     /* insecure */
-    "",                        /* username */
-    "",                        /* password */
-    "",                        /* Authorization header */
-    5,                         /* HTTP Timeout in seconds */
-    "Id",                      /* Attribute from server that serves as ID */
-    []string{ "Thing" },       /* keys to copy from api_data to data */
-    true,                      /* Write returns object */
-    false,                     /* Create returns object */
-    api_client_debug,          /* Debug logging */
-    )
+  client, err := NewAPIClient (&APIClientOpt{
+    URI: "http://127.0.0.1:8081/",
+    Timeout: 5,                      /* HTTP Timeout in seconds */
+    IDAttribute: "Id",               /* Attribute from server that serves as ID */
+    CopyKeys: []string{ "Thing" },   /* keys to copy from api_data to data */
+    WriteReturnsObject: true,
+    Debug: api_client_debug,
+  })
+  if err != nil { t.Fatalf("api_object_test.go: Failed to create API client: %s", err) }
 
   /* Construct a local map of test case objects with only the ID populated */
   if test_debug { log.Println("api_object_test.go: Building test objects...") }
   for id, test_obj := range generated_objects {
     if test_debug { log.Printf("api_object_test.go:   '%s'\n", id) }
-    o, err := NewAPIObject(
-      client,                            /* The HTTP client created above */
-      "/api/objects",                    /* path to the "object" in the test server (note: id will automatically be appended) */
-      "",                                /* Do not set an ID to force the constructor to verify id_attribute works */
-      fmt.Sprintf(`{ "Id": "%s" }`, id), /* Start with only an empty JSON object ID as our "data" */
-      api_object_debug,                  /* Whether the object's debug is enabled */
-    )
+    o, err := NewAPIObject(client, &APIObjectOpt{
+      Path: "/api/objects",                    /* path to the "object" in the test server (note: id will automatically be appended) */
+      ID: "",                                  /* Do not set an ID to force the constructor to verify id_attribute works */
+      Data: fmt.Sprintf(`{ "Id": "%s" }`, id), /* Start with only an empty JSON object ID as our "data" */
+      Debug: api_object_debug,                 /* Whether the object's debug is enabled */
+    })
     if err != nil {
       t.Fatalf("api_object_test.go: Failed to create new api_object for id '%s'", id)
     } else {
@@ -79,7 +81,7 @@ func TestAPIObject(t *testing.T) {
   log.Printf("api_object_test.go: Testing read_object()")
   for Test_case, _ := range testing_objects {
     if test_debug { log.Printf("api_object_test.go: Getting data for '%s' test case from server\n", Test_case) }
-    err := testing_objects[Test_case].read_object()
+    err := testing_objects[Test_case].ReadObject()
     if err != nil {
       t.Fatalf("api_object_test.go: Failed to read data for test case '%s': %s", Test_case, err)
     }
@@ -94,7 +96,7 @@ func TestAPIObject(t *testing.T) {
   /* Go ahead and update one of our objects */
   log.Printf("api_object_test.go: Testing update_object()")
   testing_objects["minimal"].data["Thing"] = "spoon"
-  testing_objects["minimal"].update_object()
+  testing_objects["minimal"].UpdateObject()
   if err != nil {
     t.Fatalf("api_object_test.go: Failed in update_object() test: %s", err)
   } else if testing_objects["minimal"].api_data["Thing"] != "spoon" {
@@ -104,8 +106,8 @@ func TestAPIObject(t *testing.T) {
 
   /* Delete one and make sure a 404 follows */
   log.Printf("api_object_test.go: Testing delete_object()")
-  testing_objects["pet"].delete_object()
-  err = testing_objects["pet"].read_object()
+  testing_objects["pet"].DeleteObject()
+  err = testing_objects["pet"].ReadObject()
   if err == nil {
     t.Fatalf("api_object_test.go: 'pet' object deleted, but 404 not returned when getting it.\n")
   }
@@ -113,7 +115,7 @@ func TestAPIObject(t *testing.T) {
   /* Recreate the one we just got rid of */
   log.Printf("api_object_test.go: Testing create_object()")
   testing_objects["pet"].data["Thing"] = "dog"
-  err = testing_objects["pet"].create_object()
+  err = testing_objects["pet"].CreateObject()
   if err != nil {
     t.Fatalf("api_object_test.go: Failed in create_object() test: %s", err)
   } else if testing_objects["minimal"].api_data["Thing"] != "spoon" {
@@ -122,7 +124,7 @@ func TestAPIObject(t *testing.T) {
   }
 
   /* verify it's there */
-  err = testing_objects["pet"].read_object()
+  err = testing_objects["pet"].ReadObject()
   if err != nil {
     t.Fatalf("api_object_test.go: Failed in read_object() test: %s", err)
   } else if testing_objects["pet"].api_data["Thing"] != "dog" {
@@ -136,6 +138,547 @@ func TestAPIObject(t *testing.T) {
 }
 
 
+func TestAPIObjectLockError(t *testing.T) {
+  client, _ := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8081" })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/objects", Data: `{ "id": "1" }`, IfMatch: true, ETag: `"v1"` })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  headers := make(map[string]string)
+  obj.add_if_match(headers)
+  if headers["If-Match"] != `"v1"` { t.Fatalf("api_object_test.go: If-Match was not set from the ETag") }
+
+  err = obj.lock_error("update", &APIError{ StatusCode: 412 })
+  var api_err *APIError
+  if err == nil || !errors.As(err, &api_err) || !strings.Contains(err.Error(), "changed outside of terraform") {
+    t.Fatalf("api_object_test.go: 412 was not reported as a conflict: %v", err)
+  }
+}
+
+func TestAPIObjectNestedIDAttribute(t *testing.T) {
+  client, _ := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8081" })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/objects", Data: `{ "data": { "attributes": { "uuid": "abc" } } }`, IDAttribute: "data.attributes.uuid" })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.ID() != "abc" { t.Fatalf("api_object_test.go: Expected id 'abc' from the nested id_attribute but got '%s'", obj.ID()) }
+
+  /* A top level key with dots in its name still works */
+  if v, ok := id_value(map[string]interface{}{ "a.b": "1", "a": map[string]interface{}{ "b": "2" } }, "a.b"); !ok || v != "1" {
+    t.Fatalf("api_object_test.go: Top level key with dots was not preferred: %v", v)
+  }
+  if _, ok := id_value(map[string]interface{}{ "a": "flat" }, "a.b"); ok { t.Fatalf("api_object_test.go: Path through a non-object found an id") }
+}
+
+func TestAPIObjectIDFromLocation(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "POST" {
+      w.Header().Set("Location", "http://" + r.Host + "/api/things/42?created=1")
+      w.WriteHeader(201)
+      return
+    }
+    if r.URL.Path != "/api/things/42" { w.WriteHeader(404); return }
+    w.Write([]byte(`{ "id": "42", "name": "x" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, CreateReturnsObject: true, Timeout: 5 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "name": "x" }` })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.ID() != "42" || obj.APIData()["name"] != "x" {
+    t.Fatalf("api_object_test.go: Expected object 42 read back after an empty 201 but got '%s' %v", obj.ID(), obj.APIData())
+  }
+
+  /* One object can opt out of what the provider trusts */
+  no := false
+  write_client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, WriteReturnsObject: true, Timeout: 5 })
+  obj, err = NewAPIObject(write_client, &APIObjectOpt{ Path: "/api/things", ID: "42", Data: `{ "name": "x" }`, WriteReturnsObject: &no })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.write_returns_object || !write_client.write_returns_object { t.Fatalf("api_object_test.go: write_returns_object was not overridden for the object alone") }
+
+  /* With a pattern, responses do not need to be read at all */
+  client, _ = NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  obj, err = NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "name": "x" }`, LocationIDPattern: `/things/([0-9]+)` })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.ID() != "42" { t.Fatalf("api_object_test.go: Expected id 42 from location_id_pattern but got '%s'", obj.ID()) }
+
+  /* Every operation builds an object, but the pattern is compiled once */
+  again, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "name": "x" }`, LocationIDPattern: `/things/([0-9]+)` })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if again.location_id_pattern != obj.location_id_pattern { t.Fatalf("api_object_test.go: location_id_pattern was compiled again") }
+  if _, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "name": "x" }`, LocationIDPattern: `(` }); err == nil {
+    t.Fatalf("api_object_test.go: Invalid location_id_pattern was accepted")
+  }
+}
+
+func TestAPIObjectMethods(t *testing.T) {
+  var mutex sync.Mutex
+  methods := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    mutex.Lock()
+    methods = append(methods, r.Method + " " + r.URL.Path)
+    mutex.Unlock()
+    w.Write([]byte(`{ "id": "1" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, UpdateMethod: "patch", Timeout: 5 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1" }`, CreateMethod: "PUT", DestroyMethod: "POST" })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  for _, op := range []func() error{ obj.CreateObject, obj.UpdateObject, obj.DeleteObject } {
+    if err := op(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  }
+
+  expected := "PUT /api/things, GET /api/things/1, PATCH /api/things/1, GET /api/things/1, POST /api/things/1"
+  if strings.Join(methods, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(methods, ", "), expected) }
+
+  /* Asymmetric APIs keep objects somewhere other than path/id */
+  methods = methods[:0]
+  obj, err = NewAPIObject(client, &APIObjectOpt{ Path: "/v1/things", Data: `{ "id": "1" }`, ReadPath: "/v1/thing/{id}/details", DestroyPath: "/v1/things/{id}/purge", Ext: ".json" })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  for _, op := range []func() error{ obj.CreateObject, obj.DeleteObject } {
+    if err := op(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  }
+  expected = "POST /v1/things.json, GET /v1/thing/1/details.json, DELETE /v1/things/1/purge.json"
+  if strings.Join(methods, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(methods, ", "), expected) }
+
+  /* Nested collections take their parent from data */
+  methods = methods[:0]
+  obj, err = NewAPIObject(client, &APIObjectOpt{ Path: "/orgs/{org_id}/projects", Data: `{ "id": "1", "org_id": "acme", "team": { "id": 7 } }`, UpdatePath: "/teams/{team.id}/projects/{id}" })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.UpdateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  expected = "PATCH /teams/7/projects/1, GET /orgs/acme/projects/1"
+  if strings.Join(methods, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(methods, ", "), expected) }
+
+  if _, err := NewAPIObject(client, &APIObjectOpt{ Path: "/orgs/{org}/projects", Data: `{ "id": "1" }` }); err == nil {
+    t.Fatalf("api_object_test.go: Placeholder missing from data was accepted")
+  }
+}
+
+func TestAPIObjectQueryString(t *testing.T) {
+  var mutex sync.Mutex
+  requests := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    mutex.Lock()
+    requests = append(requests, r.Method + " " + r.URL.RequestURI())
+    mutex.Unlock()
+    w.Write([]byte(`{ "id": "1" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1" }`, QueryString: map[string]string{ "tenant": "a b", "api_version": "2" } })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  for _, op := range []func() error{ obj.CreateObject, obj.DeleteObject } {
+    if err := op(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  }
+  expected := "POST /api/things?api_version=2&tenant=a+b, GET /api/things/1?api_version=2&tenant=a+b, DELETE /api/things/1?api_version=2&tenant=a+b"
+  if strings.Join(requests, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(requests, ", "), expected) }
+
+  /* Next page links that repeat a parameter keep their value */
+  if path := add_query("/api/things/1?page=2&tenant=b", obj.query_string); path != "/api/things/1?page=2&tenant=b&api_version=2" {
+    t.Fatalf("api_object_test.go: Got '%s' adding query_string to a path with a query", path)
+  }
+
+  /* Each operation can have parameters of its own */
+  requests = requests[:0]
+  obj, err = NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1" }`,
+    QueryString: map[string]string{ "api_version": "2" },
+    ReadQueryString: map[string]string{ "expand": "all" },
+    DestroyQueryString: map[string]string{ "force": "true", "api_version": "3" },
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  for _, op := range []func() error{ obj.UpdateObject, obj.DeleteObject } {
+    if err := op(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  }
+  expected = "PUT /api/things/1?api_version=2, GET /api/things/1?expand=all&api_version=2, DELETE /api/things/1?api_version=3&force=true"
+  if strings.Join(requests, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(requests, ", "), expected) }
+
+  /* Read query values can come from data, and braces that are not
+     placeholders are left alone */
+  requests = requests[:0]
+  obj, err = NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1", "name": "web one", "owner": { "team": "ops" } }`,
+    ReadQueryString: map[string]string{ "name": "{data.name}", "team": "{owner.team}", "ref": "{id}", "filter": `{"a":1}` },
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.ReadObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  expected = "GET /api/things/1?filter=%7B%22a%22%3A1%7D&name=web+one&ref=1&team=ops"
+  if strings.Join(requests, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(requests, ", "), expected) }
+
+  _, err = NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1" }`,
+    ReadQueryString: map[string]string{ "name": "{data.name}" },
+  })
+  if err == nil { t.Fatalf("api_object_test.go: read_query_string referring to a key data does not have was accepted") }
+}
+
+func TestAPIObjectJSONPatchUpdate(t *testing.T) {
+  var method, content_type, body string
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "GET" {
+      b, _ := ioutil.ReadAll(r.Body)
+      method, content_type, body = r.Method, r.Header.Get("Content-Type"), string(b)
+    }
+    w.Write([]byte(`{ "id": "1", "rev": 4 }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1", "size": 2, "tags": [ "a" ] }`,
+    OldData: `{ "id": "1", "size": 1, "color": "red" }`,
+    UpdateMode: "json_patch",
+    VersionField: "rev",
+    Version: "3",
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.UpdateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  expected := `[{"op":"test","path":"/rev","value":3},{"op":"remove","path":"/color"},{"op":"replace","path":"/size","value":2},{"op":"add","path":"/tags","value":["a"]}]`
+  if method != "PATCH" || content_type != "application/json-patch+json" || body != expected {
+    t.Fatalf("api_object_test.go: Update was sent as %s (%s) '%s' but expected a PATCH of '%s'", method, content_type, body, expected)
+  }
+
+  /* Nothing changed, so nothing is sent */
+  method = ""
+  obj, _ = NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1" }`, OldData: `{ "id": "1" }`, UpdateMode: "json_patch" })
+  if err := obj.UpdateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if method != "" { t.Fatalf("api_object_test.go: An empty patch was sent with %s", method) }
+
+  /* Merge patches only have what changed */
+  obj, err = NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1", "size": 2, "settings": { "a": 1, "b": 3 } }`,
+    OldData: `{ "id": "1", "size": 2, "color": "red", "settings": { "a": 1, "b": 2 } }`,
+    UpdateMode: "merge_patch",
+    VersionField: "rev",
+    Version: "3",
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.UpdateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  expected = `{"color":null,"rev":3,"settings":{"b":3}}`
+  if method != "PATCH" || content_type != "application/merge-patch+json" || body != expected {
+    t.Fatalf("api_object_test.go: Update was sent as %s (%s) '%s' but expected a PATCH of '%s'", method, content_type, body, expected)
+  }
+
+  /* partial_update sends changed keys whole, the usual way */
+  obj, err = NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1", "size": 2, "settings": { "a": 1, "b": 3 } }`,
+    OldData: `{ "id": "1", "size": 2, "color": "red", "settings": { "a": 1, "b": 2 } }`,
+    PartialUpdate: true,
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.UpdateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  expected = `{"color":null,"settings":{"a":1,"b":3}}`
+  if method != "PUT" || content_type != "application/json" || body != expected {
+    t.Fatalf("api_object_test.go: Update was sent as %s (%s) '%s' but expected a PUT of '%s'", method, content_type, body, expected)
+  }
+
+  if _, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1" }`, UpdateMode: "yaml" }); err == nil {
+    t.Fatalf("api_object_test.go: Unknown update_mode was accepted")
+  }
+}
+
+func TestAPIObjectWaitForEmpty(t *testing.T) {
+  var mutex sync.Mutex
+  requests := make([]string, 0)
+  children := 2
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    mutex.Lock()
+    defer mutex.Unlock()
+    requests = append(requests, r.Method + " " + r.URL.Path)
+    if r.URL.Path == "/projects/1/items" && r.Method == "GET" {
+      /* Children go away one poll at a time */
+      items := make([]string, children)
+      for i := range items { items[i] = `{ "id": "x" }` }
+      if children > 0 { children-- }
+      w.Write([]byte(`{ "items": [` + strings.Join(items, ",") + `] }`))
+      return
+    }
+    if r.Method == "DELETE" && r.URL.Path == "/projects/1" && children > 0 {
+      w.WriteHeader(409)
+      return
+    }
+    w.Write([]byte(`{}`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, CacheTTL: 60 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{
+    Path: "/projects",
+    Data: `{ "id": "1" }`,
+    WaitForEmpty: "/projects/{id}/items",
+    WaitForEmptyKey: "items",
+    ClearChildrenPath: "/projects/{id}/items",
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.DeleteObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  expected := "DELETE /projects/1/items, GET /projects/1/items, GET /projects/1/items, GET /projects/1/items, DELETE /projects/1"
+  if strings.Join(requests, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(requests, ", "), expected) }
+}
+
+func TestAPIObjectWaitForDeletion(t *testing.T) {
+  reads := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "DELETE" {
+      w.WriteHeader(202)
+      return
+    }
+    /* Torn down on the third read */
+    reads++
+    if reads < 3 {
+      w.Write([]byte(`{ "id": "1", "state": "deleting" }`))
+      return
+    }
+    w.WriteHeader(404)
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/volumes", Data: `{ "id": "1" }`, WaitForDeletion: true })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.DeleteObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if reads != 3 { t.Fatalf("api_object_test.go: Expected the delete to wait for the 404 on the third read but it read %d times", reads) }
+
+  reads = -100
+  obj, _ = NewAPIObject(client, &APIObjectOpt{ Path: "/volumes", Data: `{ "id": "1" }`, WaitForDeletion: true, WaitForDeletionTimeout: 1 })
+  if err := obj.DeleteObject(); err == nil || !strings.Contains(err.Error(), "could still be read") {
+    t.Fatalf("api_object_test.go: Expected the wait to time out but got '%v'", err)
+  }
+}
+
+func TestAPIObjectCreateReadRetries(t *testing.T) {
+  reads := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "POST" {
+      w.WriteHeader(201)
+      return
+    }
+    /* Readable from the third read on */
+    reads++
+    if reads < 3 {
+      w.WriteHeader(404)
+      return
+    }
+    w.Write([]byte(`{ "id": "1", "name": "x" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, CreateReadRetries: 1, CacheTTL: 60 })
+  obj, _ := NewAPIObject(client, &APIObjectOpt{ Path: "/things", Data: `{ "id": "1", "name": "x" }` })
+  err := obj.CreateObject()
+  var api_err *APIError
+  if !errors.As(err, &api_err) || api_err.StatusCode != 404 || reads != 2 { t.Fatalf("api_object_test.go: Expected a 404 after one retry but got '%v' after %d reads", err, reads) }
+
+  reads = 0
+  client, _ = NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, CreateReadRetries: 5, CacheTTL: 60 })
+  obj, _ = NewAPIObject(client, &APIObjectOpt{ Path: "/things", Data: `{ "id": "1", "name": "x" }` })
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if reads != 3 || obj.APIData()["name"] != "x" { t.Fatalf("api_object_test.go: Expected the object on the third read but got %v after %d reads", obj.APIData(), reads) }
+}
+
+func TestAPIObjectIgnoreKeys(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(`{ "id": "1", "name": "x", "updated_at": "now", "meta": { "etag": "e1", "owner": "me" }, "_links": { "self": "/things/1" } }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  obj, _ := NewAPIObject(client, &APIObjectOpt{ Path: "/things", Data: `{ "id": "1" }`, IgnoreKeys: []string{ "updated_at", "meta.etag", "/_links/self", "/missing" } })
+  if err := obj.ReadObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  b, _ := json.Marshal(obj.APIData())
+  expected := `{"_links":{},"id":"1","meta":{"owner":"me"},"name":"x"}`
+  if string(b) != expected { t.Fatalf("api_object_test.go: Got api_data %s but expected %s", b, expected) }
+}
+
+func TestAPIObjectLastOperation(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("X-Request-Id", "req-" + r.Method)
+    if r.Method == "POST" { w.WriteHeader(201) }
+    w.Write([]byte(`{ "id": "1" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  obj, _ := NewAPIObject(client, &APIObjectOpt{ Path: "/things", Data: `{ "id": "1" }`, QueryString: map[string]string{ "v": "2" } })
+  if obj.LastOperation() != nil { t.Fatalf("api_object_test.go: A new object has a last operation") }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  /* The read that followed does not count */
+  last := obj.LastOperation()
+  if last["operation"] != "create" || last["method"] != "POST" || last["path"] != "/things?v=2" || last["status_code"] != "201" || last["request_id"] != "req-POST" || last["duration_ms"] == "" {
+    t.Fatalf("api_object_test.go: Unexpected last operation %v", last)
+  }
+  if _, err := time.Parse(time.RFC3339, last["timestamp"]); err != nil { t.Fatalf("api_object_test.go: Invalid timestamp: %s", err) }
+}
+
+func TestAPIObjectSuccessCodes(t *testing.T) {
+  methods := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    methods = append(methods, r.Method)
+    switch r.Method {
+    case "POST":
+      w.WriteHeader(409)
+      w.Write([]byte(`{ "error": "already exists" }`))
+    case "PUT":
+      w.WriteHeader(204)
+    case "DELETE":
+      w.WriteHeader(410)
+    default:
+      w.Write([]byte(`{ "id": "1", "name": "x" }`))
+    }
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, WriteReturnsObject: true })
+  obj, err := NewAPIObject(client, &APIObjectOpt{
+    Path: "/things",
+    Data: `{ "id": "1", "name": "x" }`,
+    CreateSuccessCodes: []int{ 201, 409 },
+    UpdateSuccessCodes: []int{ 200 },
+    DestroySuccessCodes: []int{ 204, 410 },
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  /* The body of the 409 is not the object, so it is read */
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.APIData()["name"] != "x" || strings.Join(methods, ",") != "POST,GET" { t.Fatalf("api_object_test.go: Unexpected api_data %v after %v", obj.APIData(), methods) }
+
+  var api_err *APIError
+  if err := obj.UpdateObject(); !errors.As(err, &api_err) || api_err.StatusCode != 204 { t.Fatalf("api_object_test.go: Expected a 204 that update_success_codes does not list to fail, but got '%v'", err) }
+  if err := obj.DeleteObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  if _, err := NewAPIObject(client, &APIObjectOpt{ Path: "/things", Data: `{ "id": "1" }`, ReadSuccessCodes: []int{ 2000 } }); err == nil {
+    t.Fatalf("api_object_test.go: An invalid success code was accepted")
+  }
+}
+
+func TestAPIObjectReadSearch(t *testing.T) {
+  requests := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    requests = append(requests, r.Method + " " + r.URL.RequestURI())
+    if r.Method == "POST" {
+      /* Nothing to learn the id from */
+      w.WriteHeader(204)
+      return
+    }
+    w.Write([]byte(`{ "results": [ { "id": "7", "name": "other" }, { "id": "9", "name": "web" } ] }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  opt := &APIObjectOpt{
+    Path: "/hosts",
+    Data: `{ "name": "web" }`,
+    SearchPath: "/hosts?name={name}",
+    SearchKey: "name",
+    SearchValue: "{name}",
+    SearchResultsKey: "results",
+  }
+  obj, err := NewAPIObject(client, opt)
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.id != "9" { t.Fatalf("api_object_test.go: Expected the id '9' of the object found but got '%s'", obj.id) }
+
+  expected := "POST /hosts, GET /hosts?name=web"
+  if strings.Join(requests, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(requests, ", "), expected) }
+
+  /* Not in the results is gone */
+  opt.Data = `{ "name": "db" }`
+  obj, err = NewAPIObject(client, opt)
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  err = obj.ReadObject()
+  var api_err *APIError
+  if !errors.As(err, &api_err) || api_err.StatusCode != 404 { t.Fatalf("api_object_test.go: Expected a 404 when no object matches but got '%v'", err) }
+}
+
+func TestAPIObjectCreateIDAttribute(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "POST" {
+      w.Write([]byte(`{ "uuid": "abc", "name": "x" }`))
+      return
+    }
+    if r.URL.Path != "/api/things/abc" { w.WriteHeader(404); return }
+    w.Write([]byte(`{ "id": "abc", "name": "x" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, WriteReturnsObject: true })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "name": "x" }`, CreateIDAttribute: "uuid" })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.id != "abc" { t.Fatalf("api_object_test.go: Expected the id 'abc' from uuid in the create response but got '%s'", obj.id) }
+  if err := obj.ReadObject(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+
+  /* Reads (and data) keep using id_attribute */
+  obj, err = NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "abc" }`, CreateIDAttribute: "uuid" })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if obj.id != "abc" { t.Fatalf("api_object_test.go: Expected the id 'abc' from data but got '%s'", obj.id) }
+}
+
+func TestAPIObjectUpdateDestroyData(t *testing.T) {
+  var mutex sync.Mutex
+  requests := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    b, _ := ioutil.ReadAll(r.Body)
+    mutex.Lock()
+    requests = append(requests, r.Method + " " + string(b))
+    mutex.Unlock()
+    w.Write([]byte(`{ "id": "1", "name": "x" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, WriteReturnsObject: true })
+  obj, err := NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/things",
+    Data: `{ "id": "1", "name": "x" }`,
+    UpdateData: `{ "spec": { "name": "x" } }`,
+    DestroyData: `{ "reason": "test" }`,
+  })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  for _, op := range []func() error{ obj.CreateObject, obj.UpdateObject, obj.DeleteObject } {
+    if err := op(); err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  }
+  expected := `POST {"id":"1","name":"x"}, PUT {"spec":{"name":"x"}}, DELETE { "reason": "test" }`
+  if strings.Join(requests, ", ") != expected { t.Fatalf("api_object_test.go: Got requests '%s' but expected '%s'", strings.Join(requests, ", "), expected) }
+
+  if _, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1" }`, UpdateData: `{}`, UpdateMode: "merge_patch" }); err == nil {
+    t.Fatalf("api_object_test.go: update_data was accepted with a patching update_mode")
+  }
+}
+
+func TestAPIObjectConflictRetries(t *testing.T) {
+  puts := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "PUT" {
+      puts++
+      body, _ := ioutil.ReadAll(r.Body)
+      if !strings.Contains(string(body), `"revision":2`) { w.WriteHeader(409); return }
+    }
+    w.Write([]byte(`{ "id": "1", "revision": 2 }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, CopyKeys: []string{ "revision" }, Timeout: 5 })
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1", "revision": 1 }`, ConflictRetries: 2 })
+  if err != nil { t.Fatalf("api_object_test.go: %s", err) }
+  if err := obj.UpdateObject(); err != nil { t.Fatalf("api_object_test.go: Update was not retried after the conflict: %s", err) }
+  if puts != 2 { t.Fatalf("api_object_test.go: Expected 2 updates but %d were sent", puts) }
+
+  /* With locking, a conflict is final */
+  puts = 0
+  obj, _ = NewAPIObject(client, &APIObjectOpt{ Path: "/api/things", Data: `{ "id": "1", "revision": 1 }`, ConflictRetries: 2, IfMatch: true })
+  if err := obj.UpdateObject(); err == nil || puts != 1 { t.Fatalf("api_object_test.go: Locked update was retried (%d updates, error %v)", puts, err) }
+}
+
 func generate_test_api_objects (typed *map[string]test_api_object, untyped *map[string]map[string]interface{}, t *testing.T, test_debug bool) {
   add_test_api_object(
     `{
@@ -0,0 +1,194 @@
+package restapi
+
+import (
+  "context"
+  "crypto/tls"
+  "fmt"
+  "net"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+)
+
+/* Everything about how the client reaches the API (TLS, proxies,
+   sockets) is decided here so NewAPIClient only deals with
+   what is sent once a connection exists */
+func build_transport(opt *APIClientOpt) (*http.Transport, error) {
+  /* Zero means "use the net/http default" for all of these */
+  keep_alive := 30 * time.Second
+  if opt.KeepAlive != 0 { keep_alive = time.Duration(opt.KeepAlive) * time.Second }
+  max_idle_conns := 100
+  if opt.MaxIdleConns != 0 { max_idle_conns = opt.MaxIdleConns }
+  idle_conn_timeout := 90 * time.Second
+  if opt.IdleConnTimeout != 0 { idle_conn_timeout = time.Duration(opt.IdleConnTimeout) * time.Second }
+
+  dialer := &net.Dialer{
+    Timeout:   30 * time.Second,
+    KeepAlive: keep_alive,
+  }
+
+  if opt.LocalAddress != "" && !strings.HasPrefix(opt.URI, "unix://") {
+    ip, err := local_ip(opt.LocalAddress, opt.IPFamily)
+    if err != nil { return nil, err }
+    dialer.LocalAddr = &net.TCPAddr{ IP: ip }
+  }
+
+  base_dial, err := family_dial(dialer, opt.IPFamily)
+  if err != nil { return nil, err }
+
+  /* host_overrides is applied when dialing so TLS verification
+     and the Host header still use the name from the URL */
+  dial := base_dial
+  if len(opt.HostOverrides) > 0 {
+    overrides := make(map[string]string)
+    for host, target := range opt.HostOverrides {
+      overrides[strings.ToLower(host)] = target
+    }
+    dial = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+      host, port, err := net.SplitHostPort(addr)
+      if err != nil { return nil, err }
+      if target, ok := overrides[strings.ToLower(host)]; ok {
+        /* The override may or may not carry its own port */
+        if _, _, err := net.SplitHostPort(target); err == nil {
+          addr = target
+        } else {
+          addr = net.JoinHostPort(target, port)
+        }
+      }
+      return base_dial(ctx, network, addr)
+    }
+  }
+
+  /* Disable TLS verification if requested */
+  tr := &http.Transport{
+    TLSClientConfig: &tls.Config{
+      InsecureSkipVerify: opt.Insecure,
+      /* Empty means "use the host from the URI" */
+      ServerName: opt.TLSServerName,
+    },
+    Proxy: http.ProxyFromEnvironment,
+    DialContext: dial,
+    MaxIdleConns: max_idle_conns,
+    MaxIdleConnsPerHost: opt.MaxIdleConnsPerHost,
+    MaxConnsPerHost: opt.MaxConnsPerHost,
+    IdleConnTimeout: idle_conn_timeout,
+    DisableKeepAlives: opt.DisableKeepAlives,
+    DisableCompression: opt.AcceptEncoding != "",
+    TLSHandshakeTimeout: 10 * time.Second,
+  }
+
+  /* An explicit proxy wins over HTTP_PROXY and friends */
+  if opt.ProxyURL != "" {
+    proxy_url, err := url.Parse(opt.ProxyURL)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid proxy_url '%s': %s", opt.ProxyURL, err)
+    }
+    /* net/http speaks SOCKS5 natively, so a socks5:// URL is all
+       it takes to go through a SOCKS bastion */
+    switch proxy_url.Scheme {
+    case "http", "https", "socks5", "socks5h":
+    default:
+      return nil, fmt.Errorf("Unsupported proxy_url scheme '%s'. Must be one of http, https, socks5 or socks5h", proxy_url.Scheme)
+    }
+    if opt.ProxyUsername != "" {
+      proxy_url.User = url.UserPassword(opt.ProxyUsername, opt.ProxyPassword)
+    }
+    tr.Proxy = http.ProxyURL(proxy_url)
+  }
+
+  /* Local daemons (Docker-style) expose REST over a socket. Every
+     connection goes to the socket and proxies make no sense */
+  if strings.HasPrefix(opt.URI, "unix://") {
+    socket := strings.TrimPrefix(opt.URI, "unix://")
+    if socket == "" {
+      return nil, fmt.Errorf("uri '%s' does not name a socket. Use unix:///path/to/socket", opt.URI)
+    }
+    tr.Proxy = nil
+    tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+      return dialer.DialContext(ctx, "unix", socket)
+    }
+  }
+
+  /* Some gateways misbehave depending on what gets negotiated,
+     so let the user pin the protocol */
+  protocols := new(http.Protocols)
+  switch opt.HTTP2 {
+  case "", "auto":
+    /* With a TLSClientConfig and DialContext of our own, net/http only
+       offers h2 when asked to */
+    protocols.SetHTTP1(true)
+    protocols.SetHTTP2(true)
+  case "force":
+    protocols.SetHTTP2(true)
+  case "disable":
+    protocols.SetHTTP1(true)
+  case "h2c":
+    protocols.SetUnencryptedHTTP2(true)
+  default:
+    return nil, fmt.Errorf("Unsupported http2 setting '%s'. Must be one of auto, force, disable or h2c", opt.HTTP2)
+  }
+  tr.Protocols = protocols
+
+  return tr, nil
+}
+
+type dial_func func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+/* How long the preferred address family gets before the other
+   one is tried. Broken routes otherwise hang until the dial timeout */
+const ip_fallback_timeout = 2 * time.Second
+
+/* Dual-stack DNS with a broken IPv6 route (or IPv4, on v6-only
+   networks) makes connections hang before falling back. ip_family
+   picks or prefers a family instead of leaving it to luck */
+func family_dial(dialer *net.Dialer, family string) (dial_func, error) {
+  networks := map[string][]string{
+    "": nil,
+    "auto": nil,
+    "ipv4": { "tcp4" },
+    "ipv6": { "tcp6" },
+    "prefer_ipv4": { "tcp4", "tcp6" },
+    "prefer_ipv6": { "tcp6", "tcp4" },
+  }
+  order, ok := networks[family]
+  if !ok { return nil, fmt.Errorf("Unsupported ip_family '%s'. Must be one of auto, ipv4, ipv6, prefer_ipv4 or prefer_ipv6", family) }
+  if order == nil { return dialer.DialContext, nil }
+
+  return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+    /* Only plain tcp leaves the family open to choose */
+    if network != "tcp" { return dialer.DialContext(ctx, network, addr) }
+    if len(order) == 1 { return dialer.DialContext(ctx, order[0], addr) }
+
+    first_ctx, cancel := context.WithTimeout(ctx, ip_fallback_timeout)
+    conn, err := dialer.DialContext(first_ctx, order[0], addr)
+    cancel()
+    if err == nil || ctx.Err() != nil { return conn, err }
+
+    log_debug("api_transport.go", "Preferred address family failed. Falling back", "addr", addr, "network", order[1], "error", err)
+    return dialer.DialContext(ctx, order[1], addr)
+  }, nil
+}
+
+/* Multi-homed runners must connect from the address the API has
+   allow-listed. address is either that IP or the name of an
+   interface, whose first address (of the ip_family preferred) is used */
+func local_ip(address string, family string) (net.IP, error) {
+  if ip := net.ParseIP(address); ip != nil { return ip, nil }
+
+  iface, err := net.InterfaceByName(address)
+  if err != nil { return nil, fmt.Errorf("Invalid local_address '%s': not an IP address or interface: %s", address, err) }
+  addrs, err := iface.Addrs()
+  if err != nil { return nil, fmt.Errorf("Could not list addresses of interface '%s': %s", address, err) }
+
+  want_v6 := family == "ipv6" || family == "prefer_ipv6"
+  var fallback net.IP
+  for _, a := range addrs {
+    ip_net, ok := a.(*net.IPNet)
+    if !ok { continue }
+    if (ip_net.IP.To4() == nil) == want_v6 { return ip_net.IP, nil }
+    if fallback == nil && family != "ipv4" && family != "ipv6" { fallback = ip_net.IP }
+  }
+  if fallback == nil { return nil, fmt.Errorf("Interface '%s' has no address usable with ip_family '%s'", address, family) }
+  return fallback, nil
+}
@@ -0,0 +1,82 @@
+package restapi
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "strings"
+  "time"
+)
+
+/* Polls back off to this, so an operation that takes an hour is not
+   asked about every second */
+const max_async_poll_interval = 30 * time.Second
+
+/* The create was accepted (202) but is still being provisioned.
+   The id is only set once the operation is done, so a create that
+   fails or times out leaves nothing in the state */
+func (obj *APIObject) finish_async_create(res *api_response) error {
+  location := res.headers.Get("Operation-Location")
+  if location == "" { location = res.headers.Get("Location") }
+  if location == "" {
+    return errors.New("Create was accepted (202), but the response has no Operation-Location or Location header to poll")
+  }
+  path, err := relative_page_path(obj.api_client.uri, obj.op_path(obj.create_path), location)
+  if err != nil { return err }
+
+  log_info("async_create.go", "Create was accepted. Waiting for it to finish", "location", location)
+  operation, err := obj.wait_for_operation(path, res)
+  if err != nil { return err }
+
+  if obj.async_id_key != "" {
+    id, ok := object_value(operation, obj.async_id_key)
+    if !ok { return fmt.Errorf("Create finished, but the operation at '%s' has no '%s' for the object's id", path, obj.async_id_key) }
+    obj.id = fmt.Sprintf("%v", id)
+    log_info("async_create.go", "Took object id from the finished operation", "id", obj.id)
+    return obj.read_created()
+  }
+
+  /* Without async_id_key the object itself was polled, usually
+     until it became active or ready */
+  b, err := json.Marshal(operation)
+  if err != nil { return err }
+  if err := obj.update_state_from(string(b), obj.create_id_attribute); err != nil { return err }
+  if obj.id == "" { obj.id = obj.id_from_location(location) }
+  if obj.id == "" { return fmt.Errorf("Create finished, but no id could be found in '%s' or the location '%s'", path, location) }
+  return nil
+}
+
+/* Waits for the status at path to be done, honoring Retry-After
+   when the API says how long to wait. The create timeout bounds it */
+func (obj *APIObject) wait_for_operation(path string, accepted *api_response) (map[string]interface{}, error) {
+  interval := obj.async_poll_interval
+  wait := interval
+  if retry_after, ok := parse_retry_after(accepted.headers.Get("Retry-After")); ok { wait = retry_after }
+
+  status := ""
+  for {
+    if err := sleep_context(obj.ctx, wait); err != nil {
+      return nil, fmt.Errorf("Gave up waiting for the create at '%s' to finish (last status '%s'): %w", path, status, err)
+    }
+
+    res, err := obj.poll(path)
+    if err != nil { return nil, fmt.Errorf("Could not poll the create at '%s': %w", path, err) }
+    operation := make(map[string]interface{})
+    if err := json.Unmarshal([]byte(res.body), &operation); err != nil {
+      return nil, fmt.Errorf("Polling the create at '%s' did not return a JSON object: %s", path, err)
+    }
+
+    status = ""
+    if v, ok := object_value(operation, obj.async_status_key); ok { status = fmt.Sprintf("%v", v) }
+    if strings.EqualFold(status, obj.async_done_value) { return operation, nil }
+    if obj.async_failed_value != "" && strings.EqualFold(status, obj.async_failed_value) {
+      return nil, fmt.Errorf("Create failed: '%s' of the operation at '%s' is '%s'. Response: %s", obj.async_status_key, path, status, res.body)
+    }
+
+    interval *= 2
+    if interval > max_async_poll_interval { interval = max_async_poll_interval }
+    wait = interval
+    if retry_after, ok := parse_retry_after(res.headers.Get("Retry-After")); ok { wait = retry_after }
+    if obj.logs("polling") { log_debug("async_create.go", "Create is not done yet", "path", path, "status", status, "wait", wait) }
+  }
+}
@@ -0,0 +1,58 @@
+package restapi
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestAsyncCreate(t *testing.T) {
+  polls := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch {
+    case r.Method == "POST":
+      w.Header().Set("Operation-Location", "http://" + r.Host + "/operations/op1")
+      w.Header().Set("Retry-After", "0")
+      w.WriteHeader(202)
+      w.Write([]byte(`{ "id": "op1" }`))
+    case r.URL.Path == "/operations/op1":
+      /* Done on the third poll */
+      polls++
+      w.Header().Set("Retry-After", "0")
+      if polls < 3 {
+        w.Write([]byte(`{ "id": "op1", "status": "Running" }`))
+        return
+      }
+      w.Write([]byte(`{ "id": "op1", "status": "Succeeded", "result": { "server_id": "s9" } }`))
+    case r.URL.Path == "/operations/op2":
+      w.Write([]byte(`{ "id": "op2", "status": "Failed", "error": "out of capacity" }`))
+    case r.URL.Path == "/servers/s9":
+      w.Write([]byte(`{ "id": "s9", "name": "web" }`))
+    default:
+      w.WriteHeader(404)
+    }
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  opt := &APIObjectOpt{
+    Path: "/servers",
+    Data: `{ "name": "web" }`,
+    AsyncStatusKey: "status",
+    AsyncDoneValue: "succeeded",
+    AsyncFailedValue: "failed",
+    AsyncIDKey: "result.server_id",
+  }
+  obj, err := NewAPIObject(client, opt)
+  if err != nil { t.Fatalf("async_create_test.go: %s", err) }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("async_create_test.go: %s", err) }
+  if obj.id != "s9" || polls != 3 { t.Fatalf("async_create_test.go: Expected the id 's9' after 3 polls but got '%s' after %d", obj.id, polls) }
+  if obj.APIData()["name"] != "web" { t.Fatalf("async_create_test.go: Expected the created object to be read back but got %v", obj.APIData()) }
+
+  /* A failed operation is an error and sets no id */
+  obj, _ = NewAPIObject(client, opt)
+  if _, err := obj.wait_for_operation("/operations/op2", &api_response{ headers: http.Header{} }); err == nil || !strings.Contains(err.Error(), "out of capacity") {
+    t.Fatalf("async_create_test.go: Expected the failed operation's response in the error but got '%v'", err)
+  }
+}
@@ -0,0 +1,131 @@
+package restapi
+
+import (
+  "encoding/json"
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+/* The JSON type to send the value at each JSON pointer as, for APIs
+   whose schemas take "true" or "8080" where a boolean or number
+   would be expected (or the other way around). A "*" token matches
+   every key or index at that level, as in /ports/*:
+     string  - booleans and numbers are sent as strings
+     number  - strings (and booleans, as 0 or 1) are sent as numbers
+     boolean - "true", "false" and the like, or 0 and 1, are sent
+               as booleans */
+type coercion map[string]string
+
+func new_coercion(rules map[string]string) (coercion, error) {
+  for path, t := range rules {
+    if t != "string" && t != "number" && t != "boolean" {
+      return nil, fmt.Errorf("Invalid coerce type '%s' for '%s': must be string, number or boolean", t, path)
+    }
+    if _, err := parse_pointer(path); err != nil || path == "" {
+      return nil, fmt.Errorf("Invalid coerce path '%s': must be a JSON pointer such as /enabled", path)
+    }
+  }
+  return coercion(rules), nil
+}
+
+/* The rule with the fewest wildcards wins, so /ports/0 can be told
+   apart from the rest of /ports/* */
+func (rules coercion) for_path(tokens []string) string {
+  best, best_path, best_wildcards := "", "", -1
+  for path, t := range rules {
+    pattern, _ := parse_pointer(path)
+    if len(pattern) != len(tokens) { continue }
+    wildcards := 0
+    for i := range pattern {
+      if pattern[i] == "*" {
+        wildcards++
+      } else if pattern[i] != tokens[i] {
+        wildcards = -1
+        break
+      }
+    }
+    if wildcards < 0 { continue }
+    if best_wildcards < 0 || wildcards < best_wildcards || (wildcards == best_wildcards && path < best_path) {
+      best, best_path, best_wildcards = t, path, wildcards
+    }
+  }
+  return best
+}
+
+/* Returns a copy of data with the values converted. data itself is
+   left alone. A value that cannot be converted, such as "abc" as a
+   number, is an error */
+func (rules coercion) apply(data map[string]interface{}) (map[string]interface{}, error) {
+  if len(rules) == 0 || data == nil { return data, nil }
+  out, err := rules.apply_value(data, []string{})
+  if err != nil { return nil, err }
+  return out.(map[string]interface{}), nil
+}
+
+func (rules coercion) apply_value(v interface{}, tokens []string) (interface{}, error) {
+  switch value := v.(type) {
+  case map[string]interface{}:
+    out := make(map[string]interface{}, len(value))
+    for k, e := range value {
+      c, err := rules.apply_value(e, append(tokens[:len(tokens):len(tokens)], k))
+      if err != nil { return nil, err }
+      out[k] = c
+    }
+    return out, nil
+  case []interface{}:
+    out := make([]interface{}, len(value))
+    for i, e := range value {
+      c, err := rules.apply_value(e, append(tokens[:len(tokens):len(tokens)], strconv.Itoa(i)))
+      if err != nil { return nil, err }
+      out[i] = c
+    }
+    return out, nil
+  }
+
+  if v == nil || len(tokens) == 0 { return v, nil }
+  t := rules.for_path(tokens)
+  if t == "" { return v, nil }
+  c, err := coerce_value(v, t)
+  if err != nil { return nil, fmt.Errorf("Cannot coerce '/%s' to a %s: %s", strings.Join(tokens, "/"), t, err) }
+  return c, nil
+}
+
+func coerce_value(v interface{}, t string) (interface{}, error) {
+  switch t {
+  case "string":
+    switch value := v.(type) {
+    case bool:
+      return strconv.FormatBool(value), nil
+    case float64:
+      return strconv.FormatFloat(value, 'f', -1, 64), nil
+    case json.Number:
+      return value.String(), nil
+    }
+  case "number":
+    switch value := v.(type) {
+    case bool:
+      if value { return json.Number("1"), nil }
+      return json.Number("0"), nil
+    case string:
+      s := strings.TrimSpace(value)
+      /* As JSON has them: "NaN", "Inf" or "1_000" could not be sent.
+         Of valid JSON, only numbers start with a digit or a minus */
+      if s == "" || !json.Valid([]byte(s)) || !strings.ContainsRune("-0123456789", rune(s[0])) { return nil, fmt.Errorf("'%s' is not a number", value) }
+      /* Kept as written so large ids do not lose digits to a float */
+      return json.Number(s), nil
+    }
+  case "boolean":
+    switch value := v.(type) {
+    case string:
+      b, err := strconv.ParseBool(strings.TrimSpace(value))
+      if err != nil { return nil, fmt.Errorf("'%s' is not a boolean", value) }
+      return b, nil
+    case float64:
+      if value == 0 || value == 1 { return value == 1, nil }
+      return nil, fmt.Errorf("%v is not 0 or 1", value)
+    }
+  }
+  /* Already the right type, or an object or list */
+  return v, nil
+}
@@ -0,0 +1,72 @@
+package restapi
+
+import (
+  "encoding/json"
+  "reflect"
+  "testing"
+)
+
+func TestCoercion(t *testing.T) {
+  rules, err := new_coercion(map[string]string{
+    "/enabled": "string",
+    "/port": "string",
+    "/replicas": "number",
+    "/tags/*/public": "boolean",
+    "/ports/*": "number",
+    "/ports/0": "string",
+  })
+  if err != nil { t.Fatalf("coerce_test.go: %s", err) }
+
+  data := map[string]interface{}{
+    "enabled": true,
+    "port": float64(8080),
+    "replicas": "3",
+    "name": "web",
+    "tags": []interface{}{ map[string]interface{}{ "public": "false" }, map[string]interface{}{ "public": float64(1) } },
+    "ports": []interface{}{ float64(80), "443" },
+  }
+  out, err := rules.apply(data)
+  if err != nil { t.Fatalf("coerce_test.go: %s", err) }
+  expected := map[string]interface{}{
+    "enabled": "true",
+    "port": "8080",
+    "replicas": json.Number("3"),
+    "name": "web",
+    "tags": []interface{}{ map[string]interface{}{ "public": false }, map[string]interface{}{ "public": true } },
+    "ports": []interface{}{ "80", json.Number("443") },
+  }
+  if !reflect.DeepEqual(out, expected) { t.Fatalf("coerce_test.go: Unexpected coerced data %v", out) }
+  if data["enabled"] != true { t.Fatalf("coerce_test.go: Original data was changed") }
+
+  for _, s := range []string{ "many", "NaN", "Inf", "-Inf", "1_000", "0x10", "1e", "", "true", "[1]", `"1"` } {
+    if _, err := rules.apply(map[string]interface{}{ "replicas": s }); err == nil { t.Fatalf("coerce_test.go: '%s' is not a number but was coerced", s) }
+  }
+  for _, s := range []string{ "-1", "1.5e3", " 42 ", "12345678901234567890" } {
+    out, err := rules.apply(map[string]interface{}{ "replicas": s })
+    if err != nil { t.Fatalf("coerce_test.go: %s", err) }
+    if _, err := json.Marshal(out); err != nil { t.Fatalf("coerce_test.go: '%s' was coerced to a number that cannot be sent: %s", s, err) }
+  }
+  if _, err := new_coercion(map[string]string{ "/x": "date" }); err == nil { t.Fatalf("coerce_test.go: Invalid type was accepted") }
+  if _, err := new_coercion(map[string]string{ "x": "string" }); err == nil { t.Fatalf("coerce_test.go: Invalid pointer was accepted") }
+}
+
+func TestAPIObjectCoerce(t *testing.T) {
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8111/" })
+  if err != nil { t.Fatalf("coerce_test.go: %s", err) }
+  obj, err := NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/objects",
+    Data: `{ "id": "1", "enabled": true, "size": "10" }`,
+    Coerce: map[string]string{ "/enabled": "string", "/size": "number" },
+  })
+  if err != nil { t.Fatalf("coerce_test.go: %s", err) }
+  body, err := obj.update_body()
+  if err != nil { t.Fatalf("coerce_test.go: %s", err) }
+  if string(body) != `{"enabled":"true","id":"1","size":10}` { t.Fatalf("coerce_test.go: Unexpected update body %s", body) }
+
+  _, err = NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/objects",
+    Data: `{ "id": "1", "size": "big" }`,
+    Coerce: map[string]string{ "/size": "number" },
+  })
+  if err == nil { t.Fatalf("coerce_test.go: Data that cannot be coerced was accepted") }
+}
@@ -0,0 +1,213 @@
+package restapi
+
+import (
+  "encoding/json"
+  "fmt"
+  "math"
+  "strings"
+  "time"
+)
+
+/* Decides whether what the API has matches what the user asked for.
+   Servers have opinions about formatting that should not show up as
+   changes, so the comparison can be told to look past some of them */
+type value_comparer struct {
+  timestamp_layouts  []string
+  timestamp_location *time.Location
+  number_epsilon     float64
+  null_equals_absent bool
+  /* JSON pointer -> configured value -> what the server says instead */
+  value_aliases      map[string]map[string]interface{}
+  /* JSON pointers of secrets the server only returns hashed or
+     encrypted, if at all */
+  write_only         map[string]bool
+}
+
+/* Layouts timestamp_formats may refer to by name */
+var named_timestamp_layouts = map[string]string{
+  "RFC3339":     time.RFC3339,
+  "RFC3339Nano": time.RFC3339Nano,
+  "RFC1123":     time.RFC1123,
+  "RFC1123Z":    time.RFC1123Z,
+  "RFC822":      time.RFC822,
+  "RFC822Z":     time.RFC822Z,
+  "DateTime":    "2006-01-02 15:04:05",
+  "DateOnly":    "2006-01-02",
+}
+
+/* value_aliases maps a JSON pointer to a JSON object of configured
+   values and what the server canonicalizes each of them to */
+func new_value_comparer(timestamp_formats []string, timezone string, number_epsilon float64, null_equals_absent bool, value_aliases map[string]string) (*value_comparer, error) {
+  if number_epsilon < 0 { return nil, fmt.Errorf("number_epsilon must not be negative") }
+  c := value_comparer{ timestamp_location: time.UTC, number_epsilon: number_epsilon, null_equals_absent: null_equals_absent }
+  for path, aliases_str := range value_aliases {
+    if path != "" && !strings.HasPrefix(path, "/") { return nil, fmt.Errorf("Invalid value_aliases path '%s': must be a JSON pointer", path) }
+    aliases := make(map[string]interface{})
+    if err := json.Unmarshal([]byte(aliases_str), &aliases); err != nil {
+      return nil, fmt.Errorf("Invalid value_aliases for '%s': must be a JSON object of configured to server values: %s", path, err)
+    }
+    if c.value_aliases == nil { c.value_aliases = make(map[string]map[string]interface{}) }
+    c.value_aliases[path] = aliases
+  }
+  for _, format := range timestamp_formats {
+    if layout, ok := named_timestamp_layouts[format]; ok { format = layout }
+    c.timestamp_layouts = append(c.timestamp_layouts, format)
+  }
+  if timezone != "" {
+    location, err := time.LoadLocation(timezone)
+    if err != nil { return nil, fmt.Errorf("Invalid timestamp_timezone '%s': %s", timezone, err) }
+    c.timestamp_location = location
+  }
+  return &c, nil
+}
+
+/* Fields are JSON pointers or, for convenience, top level keys */
+func (c *value_comparer) set_write_only(fields []string) {
+  for _, field := range fields {
+    if !strings.HasPrefix(field, "/") { field = "/" + escape_pointer_token(field) }
+    if c.write_only == nil { c.write_only = make(map[string]bool) }
+    c.write_only[field] = true
+  }
+}
+
+/* a is what is configured and b is what the server has */
+func (c *value_comparer) equal(a interface{}, b interface{}) bool {
+  return c.equal_at("", a, b)
+}
+
+/* Like equal, for values found at the JSON pointer path */
+func (c *value_comparer) equal_at(path string, a interface{}, b interface{}) bool {
+  /* Whatever the server made of the secret, it has one. Only an
+     empty value says it was never set */
+  if c.write_only[path] && !empty_value(b) { return true }
+  a = c.alias(path, a)
+  switch av := a.(type) {
+  case map[string]interface{}:
+    bv, ok := b.(map[string]interface{})
+    if !ok { return false }
+    if c.null_equals_absent { return c.equal_keys(path, av, bv, false) && c.equal_keys(path, bv, av, true) }
+    /* A secret the server does not return at all is not missing */
+    absent := 0
+    for k, v := range av {
+      child := path + "/" + escape_pointer_token(k)
+      other, ok := bv[k]
+      if !ok && c.write_only[child] {
+        absent++
+        continue
+      }
+      if !ok || !c.equal_at(child, v, other) { return false }
+    }
+    return len(av) - absent == len(bv)
+  case []interface{}:
+    bv, ok := b.([]interface{})
+    if !ok || len(av) != len(bv) { return false }
+    for i := range av {
+      if !c.equal_at(fmt.Sprintf("%s/%d", path, i), av[i], bv[i]) { return false }
+    }
+    return true
+  case string:
+    bv, ok := b.(string)
+    if !ok { return false }
+    return av == bv || c.same_instant(av, bv)
+  }
+
+  /* 1 and 1.0 are the same number, whatever types they ended up in */
+  if an, ok := to_float(a); ok {
+    bn, ok := to_float(b)
+    return ok && math.Abs(an - bn) <= c.number_epsilon
+  }
+  return a == b
+}
+
+/* Like equal_at, but keys the server has and a does not do not
+   count, at any depth. Lists still have to match element for element */
+func (c *value_comparer) managed_equal_at(path string, a interface{}, b interface{}) bool {
+  av, ok := a.(map[string]interface{})
+  if !ok || c.write_only[path] { return c.equal_at(path, a, b) }
+  bv, ok := b.(map[string]interface{})
+  if !ok { return false }
+  for k, v := range av {
+    child := path + "/" + escape_pointer_token(k)
+    other, ok := bv[k]
+    if !ok {
+      if v == nil || c.write_only[child] { continue }
+      return false
+    }
+    if !c.managed_equal_at(child, v, other) { return false }
+  }
+  return true
+}
+
+func empty_value(v interface{}) bool {
+  switch value := v.(type) {
+  case string:
+    return value == ""
+  case []interface{}:
+    return len(value) == 0
+  case map[string]interface{}:
+    return len(value) == 0
+  }
+  return false
+}
+
+func to_float(v interface{}) (float64, bool) {
+  switch n := v.(type) {
+  case float64:
+    return n, true
+  case float32:
+    return float64(n), true
+  case int:
+    return float64(n), true
+  case int64:
+    return float64(n), true
+  case json.Number:
+    f, err := n.Float64()
+    return f, err == nil
+  }
+  return 0, false
+}
+
+/* Every key of a is in b with an equal value, where a missing
+   key is the same as null. swapped says a is the server's side */
+func (c *value_comparer) equal_keys(path string, a map[string]interface{}, b map[string]interface{}, swapped bool) bool {
+  for k, v := range a {
+    child := path + "/" + escape_pointer_token(k)
+    if swapped {
+      if !c.equal_at(child, b[k], v) { return false }
+    } else if !c.equal_at(child, v, b[k]) {
+      return false
+    }
+  }
+  return true
+}
+
+/* What the server calls a configured value, if value_aliases has
+   a name for it. Non-string values are looked up by their JSON */
+func (c *value_comparer) alias(path string, v interface{}) interface{} {
+  aliases, ok := c.value_aliases[path]
+  if !ok { return v }
+  key, ok := v.(string)
+  if !ok {
+    b, err := json.Marshal(v)
+    if err != nil { return v }
+    key = string(b)
+  }
+  if server_v, ok := aliases[key]; ok { return server_v }
+  return v
+}
+
+func (c *value_comparer) same_instant(a string, b string) bool {
+  if len(c.timestamp_layouts) == 0 { return false }
+  at, ok := c.parse_timestamp(a)
+  if !ok { return false }
+  bt, ok := c.parse_timestamp(b)
+  return ok && at.Equal(bt)
+}
+
+/* Timestamps without a zone of their own are in timestamp_location */
+func (c *value_comparer) parse_timestamp(s string) (time.Time, bool) {
+  for _, layout := range c.timestamp_layouts {
+    if t, err := time.ParseInLocation(layout, s, c.timestamp_location); err == nil { return t, true }
+  }
+  return time.Time{}, false
+}
@@ -0,0 +1,98 @@
+package restapi
+
+import (
+  "testing"
+)
+
+func TestValueComparerTimestamps(t *testing.T) {
+  plain, _ := new_value_comparer(nil, "", 0, false, nil)
+  if plain.equal("2024-01-01T00:00:00Z", "2024-01-01T00:00:00.000+00:00") {
+    t.Fatalf("compare_test.go: Timestamps were normalized without timestamp_formats")
+  }
+
+  c, err := new_value_comparer([]string{ "RFC3339Nano", "DateTime" }, "Europe/Berlin", 0, false, nil)
+  if err != nil { t.Fatalf("compare_test.go: %s", err) }
+
+  a := map[string]interface{}{ "created": "2024-01-01T00:00:00Z", "tags": []interface{}{ "x" } }
+  b := map[string]interface{}{ "created": "2024-01-01T00:00:00.000+00:00", "tags": []interface{}{ "x" } }
+  if !c.equal(a, b) { t.Fatalf("compare_test.go: Equal timestamps in different formats did not match") }
+
+  /* Zoneless timestamps are read in timestamp_timezone */
+  if !c.equal("2024-01-01 01:00:00", "2024-01-01T00:00:00Z") { t.Fatalf("compare_test.go: timestamp_timezone was not applied") }
+  if c.equal("2024-01-01T00:00:01Z", "2024-01-01T00:00:00Z") { t.Fatalf("compare_test.go: Different timestamps matched") }
+  if c.equal("not a time", "2024-01-01T00:00:00Z") { t.Fatalf("compare_test.go: A string matched a timestamp") }
+}
+
+func TestValueComparerNumbers(t *testing.T) {
+  /* Variables, so the sum is done in floating point and not as an exact constant */
+  tenth, fifth := 0.1, 0.2
+  exact, _ := new_value_comparer(nil, "", 0, false, nil)
+  if exact.equal(0.3, tenth + fifth) { t.Fatalf("compare_test.go: Numbers matched without number_epsilon") }
+  if !exact.equal(1, 1.0) { t.Fatalf("compare_test.go: Integer and float of the same value did not match") }
+
+  c, _ := new_value_comparer(nil, "", 1e-9, false, nil)
+  if !c.equal(map[string]interface{}{ "ratio": 0.3 }, map[string]interface{}{ "ratio": tenth + fifth }) {
+    t.Fatalf("compare_test.go: Numbers within number_epsilon did not match")
+  }
+  if c.equal(0.3, 0.31) { t.Fatalf("compare_test.go: Numbers outside number_epsilon matched") }
+  if c.equal(1.0, "1") { t.Fatalf("compare_test.go: A number matched a string") }
+}
+
+func TestValueComparerNulls(t *testing.T) {
+  strict, _ := new_value_comparer(nil, "", 0, false, nil)
+  lenient, _ := new_value_comparer(nil, "", 0, true, nil)
+  a := map[string]interface{}{ "name": "web", "owner": nil }
+  b := map[string]interface{}{ "name": "web" }
+
+  if strict.equal(a, b) { t.Fatalf("compare_test.go: null matched absent without null_equals_absent") }
+  if !lenient.equal(a, b) || !lenient.equal(b, a) { t.Fatalf("compare_test.go: null did not match absent with null_equals_absent") }
+  if lenient.equal(map[string]interface{}{ "owner": "x" }, b) { t.Fatalf("compare_test.go: A value matched absent") }
+}
+
+func TestValueComparerAliases(t *testing.T) {
+  if _, err := new_value_comparer(nil, "", 0, false, map[string]string{ "/enabled": "on" }); err == nil {
+    t.Fatalf("compare_test.go: Aliases that are not a JSON object were accepted")
+  }
+
+  c, err := new_value_comparer(nil, "", 0, false, map[string]string{
+    "/enabled": `{"on": true, "off": false}`,
+    "/tiers/0/level": `{"low": 1}`,
+  })
+  if err != nil { t.Fatalf("compare_test.go: %s", err) }
+
+  if !c.equal(map[string]interface{}{ "enabled": "on" }, map[string]interface{}{ "enabled": true }) {
+    t.Fatalf("compare_test.go: Aliased value did not match the server's")
+  }
+  if c.equal(map[string]interface{}{ "enabled": "off" }, map[string]interface{}{ "enabled": true }) {
+    t.Fatalf("compare_test.go: Alias matched the wrong server value")
+  }
+  if !c.equal(map[string]interface{}{ "enabled": true }, map[string]interface{}{ "enabled": true }) {
+    t.Fatalf("compare_test.go: Unaliased value no longer matched")
+  }
+  /* Aliases apply only at their own path */
+  if c.equal(map[string]interface{}{ "other": "on" }, map[string]interface{}{ "other": true }) {
+    t.Fatalf("compare_test.go: Alias was applied at another path")
+  }
+  if !c.equal_at("/tiers", []interface{}{ map[string]interface{}{ "level": "low" } }, []interface{}{ map[string]interface{}{ "level": 1 } }) {
+    t.Fatalf("compare_test.go: Alias inside a list did not match")
+  }
+}
+
+func TestValueComparerWriteOnly(t *testing.T) {
+  c, _ := new_value_comparer(nil, "", 0, false, nil)
+  c.set_write_only([]string{ "password", "/auth/token" })
+
+  configured := map[string]interface{}{ "name": "x", "password": "hunter2", "auth": map[string]interface{}{ "token": "abc" } }
+  if !c.equal(configured, map[string]interface{}{ "name": "x", "password": "$2b$12$hash", "auth": map[string]interface{}{ "token": "****" } }) {
+    t.Fatalf("compare_test.go: Hashed secrets did not match what was configured")
+  }
+  if !collection_object_matches(c, configured, map[string]interface{}{ "name": "x", "auth": map[string]interface{}{ "token": "****" } }) {
+    t.Fatalf("compare_test.go: A secret the server does not return did not match")
+  }
+  if c.equal(configured, map[string]interface{}{ "name": "x", "password": "", "auth": map[string]interface{}{ "token": "****" } }) {
+    t.Fatalf("compare_test.go: An empty secret on the server matched")
+  }
+  if c.equal(configured, map[string]interface{}{ "name": "y", "password": "$2b$12$hash", "auth": map[string]interface{}{ "token": "****" } }) {
+    t.Fatalf("compare_test.go: Other fields were no longer compared")
+  }
+}
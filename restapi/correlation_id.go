@@ -0,0 +1,77 @@
+package restapi
+
+import (
+  "fmt"
+  "os"
+  "strings"
+)
+
+/* A correlation_id_template split up into literal text and
+   placeholders so nothing has to be parsed per request */
+type correlation_template struct {
+  parts []correlation_part
+}
+
+type correlation_part struct {
+  literal     string
+  placeholder string
+}
+
+var correlation_placeholders = map[string]bool{
+  "run_id": true,
+  "uuid":   true,
+  "method": true,
+  "path":   true,
+}
+
+func parse_correlation_template(template string) (*correlation_template, error) {
+  t := correlation_template{}
+  rest := template
+  for rest != "" {
+    start := strings.Index(rest, "{")
+    if start == -1 {
+      t.parts = append(t.parts, correlation_part{ literal: rest })
+      break
+    }
+    end := strings.Index(rest[start:], "}")
+    if end == -1 {
+      return nil, fmt.Errorf("Invalid correlation_id_template '%s': unterminated placeholder", template)
+    }
+    name := rest[start+1:start+end]
+    if !correlation_placeholders[name] {
+      return nil, fmt.Errorf("Invalid correlation_id_template '%s': unknown placeholder '{%s}'. Valid placeholders are {run_id}, {uuid}, {method} and {path}", template, name)
+    }
+    if start > 0 { t.parts = append(t.parts, correlation_part{ literal: rest[:start] }) }
+    t.parts = append(t.parts, correlation_part{ placeholder: name })
+    rest = rest[start+end+1:]
+  }
+  return &t, nil
+}
+
+func (t *correlation_template) expand(run_id string, method string, path string) (string, error) {
+  var buffer strings.Builder
+  for _, part := range t.parts {
+    switch part.placeholder {
+    case "":
+      buffer.WriteString(part.literal)
+    case "run_id":
+      buffer.WriteString(run_id)
+    case "uuid":
+      id, err := new_uuid()
+      if err != nil { return "", err }
+      buffer.WriteString(id)
+    case "method":
+      buffer.WriteString(method)
+    case "path":
+      buffer.WriteString(path)
+    }
+  }
+  return buffer.String(), nil
+}
+
+/* Terraform Cloud/Enterprise tell us which run we are part of.
+   Anywhere else, every provider process makes up its own */
+func correlation_run_id() (string, error) {
+  if id := os.Getenv("TFC_RUN_ID"); id != "" { return id, nil }
+  return new_uuid()
+}
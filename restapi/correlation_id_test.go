@@ -0,0 +1,23 @@
+package restapi
+
+import (
+  "regexp"
+  "testing"
+)
+
+func TestCorrelationTemplate(t *testing.T) {
+  tmpl, err := parse_correlation_template("tf-{run_id}/{method} {path}/{uuid}")
+  if err != nil { t.Fatalf("correlation_id_test.go: %s", err) }
+
+  id, err := tmpl.expand("run-1", "PUT", "/api/objects/1")
+  if err != nil { t.Fatalf("correlation_id_test.go: %s", err) }
+  if !regexp.MustCompile(`^tf-run-1/PUT /api/objects/1/[0-9a-f-]{36}$`).MatchString(id) {
+    t.Fatalf("correlation_id_test.go: Unexpected correlation id '%s'", id)
+  }
+
+  for _, bad := range []string{ "{nope}", "{uuid" } {
+    if _, err := parse_correlation_template(bad); err == nil {
+      t.Fatalf("correlation_id_test.go: Template '%s' did not return an error", bad)
+    }
+  }
+}
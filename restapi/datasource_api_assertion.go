@@ -0,0 +1,107 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "encoding/json"
+  "fmt"
+  "sort"
+  "strings"
+)
+
+func dataSourceRestApiAssertion() *schema.Resource {
+  return &schema.Resource{
+    Read: dataSourceRestApiAssertionRead,
+
+    Schema: map[string]*schema.Schema{
+      "path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The API path on top of the base URL set in the provider to GET and evaluate.",
+        Required:    true,
+      },
+      "expected_data": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Valid JSON object. Every top level key in this object must be present in the response with an equal value for the assertion to pass. When omitted, the assertion passes if the request succeeds and returns valid JSON.",
+        Optional:    true,
+      },
+      "debug": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Whether to emit verbose debug output while evaluating the assertion.",
+        Optional:    true,
+      },
+      "passed": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Whether the API state matched the expectations.",
+        Computed:    true,
+      },
+      "details": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A human readable explanation of why the assertion failed. Empty when it passed.",
+        Computed:    true,
+      },
+      "response": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The raw response body returned by the API.",
+        Computed:    true,
+      },
+    }, /* End schema */
+
+  }
+}
+
+/* Assertions are meant to be used in check blocks, so failing to
+   talk to the API or mismatched data is reported via passed/details
+   instead of an error. An error would stop the plan entirely. */
+func dataSourceRestApiAssertionRead(d *schema.ResourceData, meta interface{}) error {
+  client := meta.(*APIClient)
+  path := d.Get("path").(string)
+  debug := d.Get("debug").(bool)
+
+  d.SetId(path)
+  log_info("datasource_api_assertion.go", "Evaluating assertion", "path", path)
+
+  res_str, err := client.SendRequest("GET", path, "")
+  d.Set("response", res_str)
+  if err != nil {
+    return set_assertion_result(d, false, fmt.Sprintf("Request to '%s' failed: %s", path, err))
+  }
+
+  actual := make(map[string]interface{})
+  if err := json.Unmarshal([]byte(res_str), &actual); err != nil {
+    return set_assertion_result(d, false, fmt.Sprintf("Response from '%s' is not a JSON object: %s", path, err))
+  }
+
+  expected_str := d.Get("expected_data").(string)
+  if expected_str == "" {
+    return set_assertion_result(d, true, "")
+  }
+
+  /* Bad expectations are a configuration problem, not an API
+     state problem, so this one is allowed to be a real error */
+  expected := make(map[string]interface{})
+  if err := json.Unmarshal([]byte(expected_str), &expected); err != nil {
+    return fmt.Errorf("datasource_api_assertion.go: expected_data is not a valid JSON object: %s", err)
+  }
+
+  mismatches := make([]string, 0)
+  for k, v := range expected {
+    actual_v, ok := actual[k]
+    if !ok {
+      mismatches = append(mismatches, fmt.Sprintf("key '%s' is missing", k))
+    } else if !client.comparer.equal_at("/" + escape_pointer_token(k), v, actual_v) {
+      mismatches = append(mismatches, fmt.Sprintf("key '%s' is '%v' but expected '%v'", k, actual_v, v))
+    }
+    if debug || client.logs("drift") { log_debug("datasource_api_assertion.go", "Compared key", "key", k, "expected", v, "actual", actual_v) }
+  }
+  sort.Strings(mismatches)
+
+  if len(mismatches) > 0 {
+    return set_assertion_result(d, false, fmt.Sprintf("Response from '%s' did not match: %s", path, strings.Join(mismatches, "; ")))
+  }
+  return set_assertion_result(d, true, "")
+}
+
+func set_assertion_result(d *schema.ResourceData, passed bool, details string) error {
+  d.Set("passed", passed)
+  d.Set("details", details)
+  return nil
+}
@@ -0,0 +1,88 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "crypto/sha256"
+  "encoding/json"
+  "fmt"
+  "sort"
+)
+
+func dataSourceRestApiExtract() *schema.Resource {
+  return &schema.Resource{
+    Read: dataSourceRestApiExtractRead,
+
+    Schema: map[string]*schema.Schema{
+      "json": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A JSON document that was already fetched, such as the response of a restapi_assertion or the api_response of a restapi_object.",
+        Required:    true,
+      },
+      "extract": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "What to extract: a name for each value and the JSON pointer (such as /spec/replicas) to find it at.",
+        Required:    true,
+      },
+      "ignore_missing": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, pointers that are not in the document are left out of values instead of failing.",
+        Optional:    true,
+      },
+      "values": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "The extracted values by name. Strings are as they are and everything else is JSON encoded.",
+        Computed:    true,
+      },
+    }, /* End schema */
+
+  }
+}
+
+/* Nothing is sent to the API. This only picks apart a response
+   that something else already made the request for */
+func dataSourceRestApiExtractRead(d *schema.ResourceData, meta interface{}) error {
+  source := d.Get("json").(string)
+  var doc interface{}
+  if err := json.Unmarshal([]byte(source), &doc); err != nil {
+    return fmt.Errorf("datasource_api_extract.go: json is not valid JSON: %s", err)
+  }
+
+  extract := string_map(d.Get("extract"))
+  ignore_missing := d.Get("ignore_missing").(bool)
+
+  /* Sorted so the first missing pointer reported is always the same */
+  names := make([]string, 0, len(extract))
+  for name := range extract { names = append(names, name) }
+  sort.Strings(names)
+
+  values := make(map[string]string)
+  for _, name := range names {
+    value, found, err := extract_value(doc, extract[name])
+    if err != nil { return fmt.Errorf("datasource_api_extract.go: Cannot extract '%s': %s", name, err) }
+    if !found {
+      if ignore_missing { continue }
+      return fmt.Errorf("datasource_api_extract.go: Cannot extract '%s': '%s' is not in the document", name, extract[name])
+    }
+    values[name] = value
+  }
+
+  sum := sha256.Sum256([]byte(source))
+  d.SetId(fmt.Sprintf("%x", sum[:8]))
+  d.Set("values", values)
+  return nil
+}
+
+/* The value at pointer, as a string if it is one and JSON otherwise
+   so that jsondecode() gets lists and objects back */
+func extract_value(doc interface{}, pointer string) (string, bool, error) {
+  tokens, err := parse_pointer(pointer)
+  if err != nil { return "", false, err }
+  value, err := pointer_get(doc, tokens)
+  if err != nil { return "", false, nil }
+
+  if s, ok := value.(string); ok { return s, true, nil }
+  b, err := json.Marshal(value)
+  return string(b), true, err
+}
@@ -0,0 +1,49 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestExtract(t *testing.T) {
+  doc := `{ "spec": { "replicas": 3, "name": "web", "ports": [ 80, 443 ], "labels": { "a/b": "c" } }, "ready": true, "owner": null }`
+  extract := map[string]interface{}{
+    "replicas": "/spec/replicas",
+    "name": "/spec/name",
+    "ports": "/spec/ports",
+    "first_port": "/spec/ports/0",
+    "label": "/spec/labels/a~1b",
+    "ready": "/ready",
+    "owner": "/owner",
+  }
+  d := schema.TestResourceDataRaw(t, dataSourceRestApiExtract().Schema, map[string]interface{}{ "json": doc, "extract": extract })
+  if err := dataSourceRestApiExtractRead(d, nil); err != nil { t.Fatalf("datasource_api_extract_test.go: %s", err) }
+
+  /* Strings are as they are and everything else is JSON */
+  expected := map[string]interface{}{
+    "replicas": "3",
+    "name": "web",
+    "ports": "[80,443]",
+    "first_port": "80",
+    "label": "c",
+    "ready": "true",
+    "owner": "null",
+  }
+  if values := d.Get("values"); !reflect.DeepEqual(values, expected) { t.Fatalf("datasource_api_extract_test.go: Unexpected values %v", values) }
+  if d.Id() == "" { t.Fatalf("datasource_api_extract_test.go: No id was set") }
+
+  extract["missing"] = "/spec/missing"
+  d = schema.TestResourceDataRaw(t, dataSourceRestApiExtract().Schema, map[string]interface{}{ "json": doc, "extract": extract })
+  err := dataSourceRestApiExtractRead(d, nil)
+  if err == nil || !strings.Contains(err.Error(), "'missing'") { t.Fatalf("datasource_api_extract_test.go: Expected an error about the missing pointer but got %v", err) }
+
+  d = schema.TestResourceDataRaw(t, dataSourceRestApiExtract().Schema, map[string]interface{}{ "json": doc, "extract": extract, "ignore_missing": true })
+  if err := dataSourceRestApiExtractRead(d, nil); err != nil { t.Fatalf("datasource_api_extract_test.go: %s", err) }
+  values := d.Get("values").(map[string]interface{})
+  if _, ok := values["missing"]; ok || values["name"] != "web" { t.Fatalf("datasource_api_extract_test.go: Unexpected values with ignore_missing %v", values) }
+
+  d = schema.TestResourceDataRaw(t, dataSourceRestApiExtract().Schema, map[string]interface{}{ "json": "{ nope", "extract": extract })
+  if err := dataSourceRestApiExtractRead(d, nil); err == nil { t.Fatalf("datasource_api_extract_test.go: Invalid JSON was accepted") }
+}
@@ -0,0 +1,133 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "path/filepath"
+  "regexp"
+  "strings"
+  "time"
+)
+
+func dataSourceRestApiSnapshot() *schema.Resource {
+  return &schema.Resource{
+    Read: dataSourceRestApiSnapshotRead,
+
+    Schema: map[string]*schema.Schema{
+      "path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The API path on top of the base URL set in the provider of the collection to GET and capture.",
+        Required:    true,
+      },
+      "results_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When the collection is wrapped in an object (for example, { \"items\": [...] }), the key holding the list of objects. By default the response must be a JSON array.",
+        Optional:    true,
+      },
+      "output_dir": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When set, the snapshot is also written to a timestamped file in this directory.",
+        Optional:    true,
+      },
+      "debug": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Whether to emit verbose debug output while taking the snapshot.",
+        Optional:    true,
+      },
+      "snapshot": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The snapshot as a JSON document holding the path, timestamp and list of objects.",
+        Computed:    true,
+      },
+      "timestamp": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When the snapshot was taken (RFC 3339, UTC).",
+        Computed:    true,
+      },
+      "object_count": &schema.Schema{
+        Type:        schema.TypeInt,
+        Description: "The number of objects in the snapshot.",
+        Computed:    true,
+      },
+      "file": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The file the snapshot was written to when output_dir is set.",
+        Computed:    true,
+      },
+    }, /* End schema */
+
+  }
+}
+
+/* What a snapshot file holds. Restores read the same shape back */
+type api_snapshot struct {
+  Path      string        `json:"path"`
+  Timestamp string        `json:"timestamp"`
+  Objects   []interface{} `json:"objects"`
+}
+
+/* Collections come back either as a plain array or wrapped
+   in an object under results_key */
+func parse_collection(body string, path string, results_key string) ([]interface{}, error) {
+  var response interface{}
+  if err := json.Unmarshal([]byte(body), &response); err != nil {
+    return nil, fmt.Errorf("Response from '%s' is not valid JSON: %s", path, err)
+  }
+
+  if results_key != "" {
+    wrapper, ok := response.(map[string]interface{})
+    if !ok { return nil, fmt.Errorf("Response from '%s' is not a JSON object, so results_key '%s' cannot be used", path, results_key) }
+    response = wrapper[results_key]
+  }
+  objects, ok := response.([]interface{})
+  if !ok { return nil, fmt.Errorf("Collection at '%s' is not a JSON array. Set results_key if it is wrapped in an object", path) }
+  return objects, nil
+}
+
+var snapshot_file_chars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+/* Unlike assertions, a snapshot that cannot be taken is an error.
+   A backup that silently came back empty is worse than none */
+func dataSourceRestApiSnapshotRead(d *schema.ResourceData, meta interface{}) error {
+  client := meta.(*APIClient)
+  path := d.Get("path").(string)
+  results_key := d.Get("results_key").(string)
+  debug := d.Get("debug").(bool)
+  now := time.Now().UTC()
+
+  log_info("datasource_api_snapshot.go", "Taking snapshot", "path", path)
+
+  res_str, err := client.SendRequest("GET", path, "")
+  if err != nil { return err }
+
+  objects, err := parse_collection(res_str, path, results_key)
+  if err != nil { return err }
+
+  snapshot := api_snapshot{
+    Path: path,
+    Timestamp: now.Format(time.RFC3339),
+    Objects: objects,
+  }
+  b, err := json.MarshalIndent(snapshot, "", "  ")
+  if err != nil { return err }
+
+  file := ""
+  if output_dir := d.Get("output_dir").(string); output_dir != "" {
+    name := strings.Trim(snapshot_file_chars.ReplaceAllString(path, "_"), "_")
+    file = filepath.Join(output_dir, fmt.Sprintf("%s-%s.json", name, now.Format("20060102T150405Z")))
+    if err := ioutil.WriteFile(file, b, 0600); err != nil {
+      return fmt.Errorf("datasource_api_snapshot.go: Could not write snapshot of '%s': %s", path, err)
+    }
+    log_info("datasource_api_snapshot.go", "Wrote snapshot", "path", path, "count", len(objects), "file", file)
+  }
+  if debug { log_debug("datasource_api_snapshot.go", "Snapshot:\n" + string(b)) }
+
+  d.SetId(fmt.Sprintf("%s@%s", path, snapshot.Timestamp))
+  d.Set("snapshot", string(b))
+  d.Set("timestamp", snapshot.Timestamp)
+  d.Set("object_count", len(objects))
+  d.Set("file", file)
+  return nil
+}
@@ -0,0 +1,27 @@
+/*
+Package restapi implements a terraform provider for generic REST APIs.
+
+The HTTP client and object logic used by the provider are exported so
+other tools and custom providers can reuse the same authentication,
+retry and state handling without going through terraform:
+
+  client, err := restapi.NewAPIClient(&restapi.APIClientOpt{
+    URI:         "https://myapi.env.local/api/v1",
+    AuthHeader:  "Bearer " + token,
+    IDAttribute: "name",
+  })
+  if err != nil { return err }
+
+  obj, err := restapi.NewAPIObject(client, &restapi.APIObjectOpt{
+    Path: "/things",
+    Data: `{ "name": "foo", "size": 3 }`,
+  })
+  if err != nil { return err }
+
+  err = obj.CreateObject()
+
+APIObjectOpt and APIClientOpt mirror the resource and provider
+arguments documented in the README. An APIClient is safe to share
+between goroutines; an APIObject is not.
+*/
+package restapi
@@ -0,0 +1,54 @@
+package restapi
+
+import (
+  "sort"
+)
+
+/* The top level keys whose values the server no longer agrees with,
+   and data with the server's values in their place (keys the server
+   dropped are left out). With drift_detection "managed_keys" only
+   what the user manages is compared, so keys the server adds, at any
+   depth, are not drift. With "full" they are. The id, version_field
+   and ignore_keys are never compared */
+func (obj *APIObject) drift() ([]string, map[string]interface{}) {
+  full := obj.drift_detection == "full"
+  if (!full && obj.drift_detection != "managed_keys") || len(obj.data) == 0 || obj.api_data == nil { return nil, nil }
+  data, err := obj.outgoing(obj.data, "update")
+  if err != nil { return nil, nil }
+  if len(obj.ignore_keys) > 0 { data = without_keys(data, obj.ignore_keys) }
+
+  comparer := obj.api_client.comparer
+  skipped := func(k string) bool { return k == obj.id_attribute || (obj.version_field != "" && k == obj.version_field) }
+  drifted := make([]string, 0)
+  for k, v := range data {
+    if skipped(k) { continue }
+    server, ok := obj.api_data[k]
+    if !ok && v == nil { continue }
+    path := "/" + escape_pointer_token(k)
+    /* Servers often never return secrets at all */
+    if !ok && comparer.write_only[path] { continue }
+    if ok && full && comparer.equal_at(path, v, server) { continue }
+    if ok && !full && comparer.managed_equal_at(path, v, server) { continue }
+    drifted = append(drifted, k)
+  }
+  if full {
+    for k, server := range obj.api_data {
+      if _, ok := data[k]; ok || skipped(k) { continue }
+      if server == nil && comparer.null_equals_absent { continue }
+      drifted = append(drifted, k)
+    }
+  }
+  if len(drifted) == 0 { return nil, nil }
+  sort.Strings(drifted)
+
+  out := make(map[string]interface{}, len(obj.data))
+  for k, v := range obj.data { out[k] = v }
+  for _, k := range drifted {
+    if server, ok := obj.api_data[k]; ok {
+      out[k] = server
+    } else {
+      delete(out, k)
+    }
+  }
+  return drifted, out
+}
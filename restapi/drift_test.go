@@ -0,0 +1,60 @@
+package restapi
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestAPIObjectDrift(t *testing.T) {
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8111/", WriteOnlyFields: []string{ "password" } })
+  if err != nil { t.Fatalf("drift_test.go: %s", err) }
+  obj, err := NewAPIObject(client, &APIObjectOpt{
+    Path: "/api/objects",
+    Data: `{ "id": "1", "name": "web", "size": 2, "password": "hunter2", "settings": { "color": "red" }, "tags": [ "a" ] }`,
+    DriftDetection: "managed_keys",
+  })
+  if err != nil { t.Fatalf("drift_test.go: %s", err) }
+
+  obj.api_data = map[string]interface{}{
+    "id": 1.0, "name": "web", "size": 2.0, "password": "$2a$hashed", "created": "today",
+    "settings": map[string]interface{}{ "color": "red", "shade": "dark" }, "tags": []interface{}{ "a" },
+  }
+  if keys, _ := obj.drift(); keys != nil { t.Fatalf("drift_test.go: Keys the server added were reported as drift: %v", keys) }
+
+  obj.api_data["size"] = 3.0
+  obj.api_data["settings"] = map[string]interface{}{ "color": "blue" }
+  delete(obj.api_data, "tags")
+  keys, data := obj.drift()
+  if !reflect.DeepEqual(keys, []string{ "settings", "size", "tags" }) { t.Fatalf("drift_test.go: Unexpected drifted keys %v", keys) }
+  if data["size"] != 3.0 || data["name"] != "web" { t.Fatalf("drift_test.go: Unexpected drifted data %v", data) }
+  if _, ok := data["tags"]; ok { t.Fatalf("drift_test.go: A key the server dropped is still in the drifted data") }
+  if obj.data["size"] != 2.0 { t.Fatalf("drift_test.go: Original data was changed") }
+
+  obj.drift_detection = "full"
+  keys, data = obj.drift()
+  if !reflect.DeepEqual(keys, []string{ "created", "settings", "size", "tags" }) { t.Fatalf("drift_test.go: Unexpected drifted keys with full %v", keys) }
+  if data["created"] != "today" { t.Fatalf("drift_test.go: A key the server added is not in the drifted data %v", data) }
+
+  obj.drift_detection = "none"
+  if keys, _ := obj.drift(); keys != nil { t.Fatalf("drift_test.go: Drift was reported with drift_detection none") }
+
+  /* Secrets the server never returns, at any depth, are not drift */
+  nested, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8111/", WriteOnlyFields: []string{ "password", "/auth/token" } })
+  if err != nil { t.Fatalf("drift_test.go: %s", err) }
+  secret, err := NewAPIObject(nested, &APIObjectOpt{
+    Path: "/api/objects",
+    Data: `{ "id": "1", "password": "hunter2", "auth": { "user": "admin", "token": "t0ken" } }`,
+    DriftDetection: "managed_keys",
+  })
+  if err != nil { t.Fatalf("drift_test.go: %s", err) }
+  secret.api_data = map[string]interface{}{ "id": "1", "auth": map[string]interface{}{ "user": "admin" } }
+  for _, detection := range []string{ "managed_keys", "full" } {
+    secret.drift_detection = detection
+    if keys, _ := secret.drift(); keys != nil { t.Fatalf("drift_test.go: Secrets the server does not return were reported as drift with %s: %v", detection, keys) }
+  }
+  secret.api_data["auth"] = map[string]interface{}{ "user": "root" }
+  if keys, _ := secret.drift(); !reflect.DeepEqual(keys, []string{ "auth" }) { t.Fatalf("drift_test.go: Unexpected drifted keys next to a secret %v", keys) }
+
+  _, err = NewAPIObject(client, &APIObjectOpt{ Path: "/api/objects", Data: `{ "id": "1" }`, DriftDetection: "some" })
+  if err == nil { t.Fatalf("drift_test.go: Invalid drift_detection was accepted") }
+}
@@ -0,0 +1,41 @@
+package restapi
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "regexp"
+)
+
+/* ${env:NAME}. The name itself follows the usual shell rules */
+var env_reference = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+/* Replaces ${env:NAME} in s with the value of NAME, run through
+   escape. Values are resolved for each request, so a secret that
+   CI rotates mid-run is picked up, and are never logged. A variable
+   that is not set is an error rather than an empty string sent to
+   the API */
+func interpolate_env(s string, escape func(string) string) (string, error) {
+  var missing string
+  resolved := env_reference.ReplaceAllStringFunc(s, func(reference string) string {
+    name := env_reference.FindStringSubmatch(reference)[1]
+    value, ok := os.LookupEnv(name)
+    if !ok {
+      if missing == "" { missing = name }
+      return reference
+    }
+    add_log_redactions(nil, value, escape(value))
+    return escape(value)
+  })
+  if missing != "" { return "", fmt.Errorf("Environment variable '%s' referenced as ${env:%s} is not set", missing, missing) }
+  return resolved, nil
+}
+
+/* References in data are always inside JSON strings (anything else
+   would not have been valid JSON), so values are escaped for them */
+func json_string_escape(value string) string {
+  b, _ := json.Marshal(value)
+  return string(b[1:len(b) - 1])
+}
+
+func no_escape(value string) string { return value }
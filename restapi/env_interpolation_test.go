@@ -0,0 +1,48 @@
+package restapi
+
+import (
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "testing"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+  os.Setenv("REST_API_TEST_TOKEN", `s3cr"et`)
+  defer os.Unsetenv("REST_API_TEST_TOKEN")
+
+  res, err := interpolate_env(`{ "token": "${env:REST_API_TEST_TOKEN}", "other": "${HOME}" }`, json_string_escape)
+  if err != nil { t.Fatalf("env_interpolation_test.go: %s", err) }
+  if expected := `{ "token": "s3cr\"et", "other": "${HOME}" }`; res != expected {
+    t.Fatalf("env_interpolation_test.go: Got '%s' but expected '%s'", res, expected)
+  }
+
+  if _, err := interpolate_env("${env:REST_API_TEST_UNSET}", no_escape); err == nil {
+    t.Fatalf("env_interpolation_test.go: Reference to an unset variable did not fail")
+  }
+}
+
+func TestEnvInterpolationRequests(t *testing.T) {
+  os.Setenv("REST_API_TEST_TOKEN", "abc123")
+  defer os.Unsetenv("REST_API_TEST_TOKEN")
+
+  var auth, body string
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    auth = r.Header.Get("Authorization")
+    b, _ := ioutil.ReadAll(r.Body)
+    body = string(b)
+    w.Write([]byte("{}"))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, AuthHeader: "Bearer ${env:REST_API_TEST_TOKEN}", EnvInterpolation: true })
+  if err != nil { t.Fatalf("env_interpolation_test.go: %s", err) }
+  if _, err := client.SendRequest("POST", "/things", `{ "key": "${env:REST_API_TEST_TOKEN}" }`); err != nil { t.Fatalf("env_interpolation_test.go: %s", err) }
+  if auth != "Bearer abc123" || body != `{ "key": "abc123" }` { t.Fatalf("env_interpolation_test.go: Sent Authorization '%s' and body '%s'", auth, body) }
+
+  /* Off by default */
+  client, _ = NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  if _, err := client.SendRequest("POST", "/things", `{ "key": "${env:REST_API_TEST_TOKEN}" }`); err != nil { t.Fatalf("env_interpolation_test.go: %s", err) }
+  if body != `{ "key": "${env:REST_API_TEST_TOKEN}" }` { t.Fatalf("env_interpolation_test.go: Interpolated '%s' without env_interpolation", body) }
+}
@@ -0,0 +1,25 @@
+package restapi_test
+
+import (
+  "fmt"
+  "log"
+  "github.com/TrurlMcByte/terraform-provider-restapi/restapi"
+)
+
+func ExampleNewAPIObject() {
+  client, err := restapi.NewAPIClient(&restapi.APIClientOpt{
+    URI:                "http://127.0.0.1:8082/api",
+    Timeout:            5,
+    WriteReturnsObject: true,
+  })
+  if err != nil { log.Fatal(err) }
+
+  obj, err := restapi.NewAPIObject(client, &restapi.APIObjectOpt{
+    Path: "/objects",
+    Data: `{ "id": "1234", "first": "Foo" }`,
+  })
+  if err != nil { log.Fatal(err) }
+
+  if err := obj.CreateObject(); err != nil { log.Fatal(err) }
+  fmt.Println(obj.ID(), obj.APIData()["first"])
+}
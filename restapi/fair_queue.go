@@ -0,0 +1,113 @@
+package restapi
+
+import (
+  "context"
+  "sync"
+  "golang.org/x/time/rate"
+)
+
+/* Hands out rate limiter tokens round-robin between queues so
+   one busy queue (a refresh of a huge collection) cannot starve
+   the others (a handful of creates elsewhere). Within a queue
+   requests are served in the order they arrived */
+type fair_queue struct {
+  limiter  *rate.Limiter
+  mutex    sync.Mutex
+  queues   map[string][]chan struct{}
+  order    []string
+  next     int
+  running  bool
+}
+
+type queue_key_type struct{}
+
+/* Requests made with the returned context are queued under key */
+func with_queue_key(ctx context.Context, key string) context.Context {
+  return context.WithValue(ctx, queue_key_type{}, key)
+}
+
+func queue_key_from(ctx context.Context, fallback string) string {
+  if key, ok := ctx.Value(queue_key_type{}).(string); ok && key != "" {
+    return key
+  }
+  return fallback
+}
+
+func new_fair_queue(limiter *rate.Limiter) *fair_queue {
+  return &fair_queue{
+    limiter: limiter,
+    queues: make(map[string][]chan struct{}),
+  }
+}
+
+/* Blocks until it is key's turn and a token is available */
+func (q *fair_queue) wait(ctx context.Context, key string) error {
+  turn := make(chan struct{})
+
+  q.mutex.Lock()
+  if _, ok := q.queues[key]; !ok {
+    q.order = append(q.order, key)
+  }
+  q.queues[key] = append(q.queues[key], turn)
+  if !q.running {
+    q.running = true
+    go q.dispatch()
+  }
+  q.mutex.Unlock()
+
+  select {
+  case <-turn:
+    return nil
+  case <-ctx.Done():
+    q.remove(key, turn)
+    return ctx.Err()
+  }
+}
+
+func (q *fair_queue) remove(key string, turn chan struct{}) {
+  q.mutex.Lock()
+  defer q.mutex.Unlock()
+  waiting := q.queues[key]
+  for i, c := range waiting {
+    if c == turn {
+      q.queues[key] = append(waiting[:i], waiting[i+1:]...)
+      return
+    }
+  }
+}
+
+/* Runs while anything is waiting */
+func (q *fair_queue) dispatch() {
+  for {
+    q.limiter.Wait(context.Background())
+
+    q.mutex.Lock()
+    turn := q.pop()
+    if turn == nil {
+      q.running = false
+      q.mutex.Unlock()
+      return
+    }
+    q.mutex.Unlock()
+    close(turn)
+  }
+}
+
+/* Next waiter in round-robin order. Must hold the mutex.
+   Empty queues are dropped so the order does not grow forever */
+func (q *fair_queue) pop() chan struct{} {
+  for len(q.order) > 0 {
+    if q.next >= len(q.order) { q.next = 0 }
+    key := q.order[q.next]
+    waiting := q.queues[key]
+    if len(waiting) == 0 {
+      delete(q.queues, key)
+      q.order = append(q.order[:q.next], q.order[q.next+1:]...)
+      continue
+    }
+    q.queues[key] = waiting[1:]
+    q.next++
+    return waiting[0]
+  }
+  return nil
+}
@@ -0,0 +1,29 @@
+package restapi
+
+import (
+  "testing"
+  "golang.org/x/time/rate"
+)
+
+func TestFairQueueRoundRobin(t *testing.T) {
+  q := new_fair_queue(rate.NewLimiter(rate.Inf, 1))
+
+  /* Queue up three requests for a busy collection, then one elsewhere */
+  turns := make(map[chan struct{}]string)
+  for _, key := range []string{ "busy", "busy", "busy", "quiet" } {
+    turn := make(chan struct{})
+    if _, ok := q.queues[key]; !ok { q.order = append(q.order, key) }
+    q.queues[key] = append(q.queues[key], turn)
+    turns[turn] = key
+  }
+
+  expected := []string{ "busy", "quiet", "busy", "busy" }
+  for i, key := range expected {
+    turn := q.pop()
+    if turn == nil { t.Fatalf("fair_queue_test.go: Queue ran dry after %d turns", i) }
+    if turns[turn] != key {
+      t.Fatalf("fair_queue_test.go: Turn %d went to '%s' but expected '%s'", i, turns[turn], key)
+    }
+  }
+  if q.pop() != nil { t.Fatalf("fair_queue_test.go: Expected the queue to be empty") }
+}
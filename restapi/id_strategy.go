@@ -0,0 +1,51 @@
+package restapi
+
+import (
+  "crypto/sha256"
+  "encoding/json"
+  "fmt"
+)
+
+/* How ids of new objects come about. The server assigns them unless
+   the API wants the client to make them up */
+var id_strategies = map[string]bool{ "server": true, "uuid": true, "hash": true, "template": true }
+
+/* Makes up the id of an object about to be created and puts it in
+   data under id_field, where the API expects to find it. hash and
+   template give the same id for the same data, so an object created
+   again (say, after being lost from the state) is the same object */
+func (obj *APIObject) generate_id(strategy string, id_field string, id_fields []string, id_template string) error {
+  var id string
+  switch strategy {
+  case "uuid":
+    var err error
+    if id, err = new_uuid(); err != nil { return err }
+  case "hash":
+    if len(id_fields) == 0 { return fmt.Errorf("id_strategy 'hash' needs id_fields to hash") }
+    values := make([]interface{}, len(id_fields))
+    for i, field := range id_fields {
+      v, ok := object_value(map[string]interface{}(obj.data), field)
+      if !ok { return fmt.Errorf("id_strategy 'hash' uses '%s', but data has no such key", field) }
+      values[i] = v
+    }
+    /* Encoded as a list so ["a", "bc"] and ["ab", "c"] differ */
+    b, err := json.Marshal(values)
+    if err != nil { return err }
+    sum := sha256.Sum256(b)
+    id = fmt.Sprintf("%x", sum[:16])
+  case "template":
+    if id_template == "" { return fmt.Errorf("id_strategy 'template' needs an id_template") }
+    t, err := obj.api_client.name_templates.get(id_template)
+    if err != nil { return fmt.Errorf("Invalid id_template: %s", err) }
+    if id, err = apply_name_template(t, nil, obj.data); err != nil { return fmt.Errorf("id_template failed: %s", err) }
+    if id == "" { return fmt.Errorf("id_template '%s' made an empty id", id_template) }
+  default:
+    return nil
+  }
+
+  if id_field == "" { id_field = obj.id_attribute }
+  obj.data[id_field] = id
+  obj.id = id
+  log_info("id_strategy.go", "Generated the id of the new object", "strategy", strategy, "field", id_field, "id", id)
+  return nil
+}
@@ -0,0 +1,43 @@
+package restapi
+
+import (
+  "regexp"
+  "testing"
+)
+
+func TestIDStrategies(t *testing.T) {
+  client, _ := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:1", Timeout: 1 })
+  data := `{ "team": "Ops", "name": "Web Server" }`
+  new_object := func(opt *APIObjectOpt) *APIObject {
+    opt.Path = "/api/things"
+    if opt.Data == "" { opt.Data = data }
+    obj, err := NewAPIObject(client, opt)
+    if err != nil { t.Fatalf("id_strategy_test.go: %s", err) }
+    return obj
+  }
+
+  obj := new_object(&APIObjectOpt{ IDStrategy: "uuid", IDField: "uuid" })
+  if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4`).MatchString(obj.id) || obj.data["uuid"] != obj.id {
+    t.Fatalf("id_strategy_test.go: Expected a UUID in data under 'uuid' but got id '%s' and data %v", obj.id, obj.data)
+  }
+
+  first := new_object(&APIObjectOpt{ IDStrategy: "hash", IDFields: []string{ "team", "name" } })
+  again := new_object(&APIObjectOpt{ IDStrategy: "hash", IDFields: []string{ "team", "name" } })
+  other := new_object(&APIObjectOpt{ IDStrategy: "hash", IDFields: []string{ "team", "name" }, Data: `{ "team": "Ops", "name": "DB" }` })
+  if len(first.id) != 32 || first.id != again.id || first.id == other.id || first.data["id"] != first.id {
+    t.Fatalf("id_strategy_test.go: Expected stable, distinct hashes in data under 'id' but got '%s', '%s' and '%s'", first.id, again.id, other.id)
+  }
+
+  obj = new_object(&APIObjectOpt{ IDStrategy: "template", IDTemplate: "{{ .data.team | lower }}-{{ .data.name | slugify }}" })
+  if obj.id != "ops-web-server" { t.Fatalf("id_strategy_test.go: Expected the id 'ops-web-server' but got '%s'", obj.id) }
+
+  /* An id in data (or from the state) is never replaced */
+  obj = new_object(&APIObjectOpt{ IDStrategy: "uuid", ID: "7" })
+  if obj.id != "7" { t.Fatalf("id_strategy_test.go: The known id was replaced with '%s'", obj.id) }
+
+  for _, opt := range []*APIObjectOpt{ { IDStrategy: "random" }, { IDStrategy: "hash", IDFields: []string{ "owner" } }, { IDStrategy: "template" } } {
+    opt.Path = "/api/things"
+    opt.Data = data
+    if _, err := NewAPIObject(client, opt); err == nil { t.Fatalf("id_strategy_test.go: id_strategy '%s' was accepted with %v", opt.IDStrategy, opt) }
+  }
+}
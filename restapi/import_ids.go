@@ -0,0 +1,141 @@
+package restapi
+
+import (
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "regexp"
+  "strings"
+)
+
+// ImportIDsOpt selects the objects of a collection that ImportIDs
+// writes import commands for.
+type ImportIDsOpt struct {
+  Path       string
+  ResultsKey string
+
+  /* Only objects whose SearchKey (a key, or a JSON pointer such as
+     /meta/owner) is SearchValue are listed. Empty lists them all */
+  SearchKey   string
+  SearchValue string
+
+  /* The key used to name each resource. Defaults to the id */
+  NameKey string
+
+  /* Write terraform 1.5 import blocks instead of terraform import commands */
+  Blocks bool
+}
+
+var resource_name_chars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// ImportIDs lists the collection at opt.Path and writes a ready to
+// paste import for every matching object to out. It returns how
+// many objects were written.
+func ImportIDs(client *APIClient, opt *ImportIDsOpt, out io.Writer) (int, error) {
+  res_str, err := client.SendRequest("GET", opt.Path, "")
+  if err != nil { return 0, err }
+
+  objects, err := parse_collection(res_str, opt.Path, opt.ResultsKey)
+  if err != nil { return 0, err }
+
+  name_key := opt.NameKey
+  if name_key == "" { name_key = client.id_attribute }
+
+  used := make(map[string]bool)
+  count := 0
+  for i, o := range objects {
+    if opt.SearchKey != "" {
+      v, ok := object_value(o, opt.SearchKey)
+      if !ok || fmt.Sprint(v) != opt.SearchValue { continue }
+    }
+
+    id, ok := object_value(o, client.id_attribute)
+    if !ok { return count, fmt.Errorf("Object %d at '%s' has no '%s' to import it by", i, opt.Path, client.id_attribute) }
+    import_id := fmt.Sprintf("%s/%v", strings.TrimSuffix(opt.Path, "/"), id)
+
+    name_v, ok := object_value(o, name_key)
+    if !ok { name_v = id }
+    /* Two objects may well slugify to the same name, and the
+       numbered name may be taken by another object already */
+    base := resource_name(fmt.Sprint(name_v))
+    name := base
+    for n := 2; used[name]; n++ { name = fmt.Sprintf("%s_%d", base, n) }
+    used[name] = true
+
+    if opt.Blocks {
+      fmt.Fprintf(out, "import {\n  to = restapi_object.%s\n  id = %q\n}\n\n", name, import_id)
+    } else {
+      fmt.Fprintf(out, "terraform import restapi_object.%s '%s'\n", name, import_id)
+    }
+    count++
+  }
+  return count, nil
+}
+
+/* key is a key or dotted path as for id_attribute, or a JSON pointer */
+func object_value(o interface{}, key string) (interface{}, bool) {
+  if !strings.HasPrefix(key, "/") {
+    m, ok := o.(map[string]interface{})
+    if !ok { return nil, false }
+    v, ok := id_value(m, key)
+    return v, ok && v != nil
+  }
+  tokens, err := parse_pointer(key)
+  if err != nil { return nil, false }
+  v, err := pointer_get(o, tokens)
+  return v, err == nil && v != nil
+}
+
+/* Terraform names must start with a letter or underscore. Anything
+   but letters and digits becomes an underscore to be safe */
+func resource_name(s string) string {
+  name := strings.Trim(resource_name_chars.ReplaceAllString(strings.ToLower(s), "_"), "_")
+  if name == "" || (name[0] >= '0' && name[0] <= '9') { name = "object_" + name }
+  return name
+}
+
+// ImportIDsCommand implements the import-ids subcommand of the
+// provider binary. Connection settings are taken from the same
+// REST_API_* environment variables the provider reads. It returns
+// the process exit code.
+func ImportIDsCommand(args []string, out io.Writer, errout io.Writer) int {
+  flags := flag.NewFlagSet("import-ids", flag.ContinueOnError)
+  flags.SetOutput(errout)
+  uri := flags.String("uri", os.Getenv("REST_API_URI"), "URI of the REST API endpoint")
+  id_attribute := flags.String("id-attribute", os.Getenv("REST_API_ID_ATTRIBUTE"), "The key holding each object's id. Default is id")
+  opt := ImportIDsOpt{}
+  flags.StringVar(&opt.Path, "path", "", "The collection to list, such as /api/things")
+  flags.StringVar(&opt.ResultsKey, "results-key", "", "The key the collection is wrapped in, if any")
+  flags.StringVar(&opt.SearchKey, "search-key", "", "Only list objects where this key (or JSON pointer) ...")
+  flags.StringVar(&opt.SearchValue, "search-value", "", "... has this value")
+  flags.StringVar(&opt.NameKey, "name-key", "", "The key used to name each resource. Default is the id")
+  flags.BoolVar(&opt.Blocks, "blocks", false, "Write import blocks instead of terraform import commands")
+  if err := flags.Parse(args); err != nil { return 2 }
+
+  if opt.Path == "" {
+    fmt.Fprintln(errout, "import-ids: -path is required")
+    return 2
+  }
+
+  client, err := NewAPIClient(&APIClientOpt{
+    URI: *uri,
+    Username: os.Getenv("REST_API_USERNAME"),
+    Password: os.Getenv("REST_API_PASSWORD"),
+    AuthHeader: os.Getenv("REST_API_AUTH_HEADER"),
+    IDAttribute: *id_attribute,
+    Timeout: 60,
+  })
+  if err != nil {
+    fmt.Fprintf(errout, "import-ids: %s\n", err)
+    return 1
+  }
+
+  count, err := ImportIDs(client, &opt, out)
+  if err != nil {
+    fmt.Fprintf(errout, "import-ids: %s\n", err)
+    return 1
+  }
+  if count == 0 { fmt.Fprintf(errout, "import-ids: No objects at '%s' matched\n", opt.Path) }
+  return 0
+}
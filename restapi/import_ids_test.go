@@ -0,0 +1,63 @@
+package restapi
+
+import (
+  "bytes"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestImportIDs(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(`{"items": [
+      {"id": "1", "name": "Web Server", "meta": {"owner": "team-a"}},
+      {"id": "2", "name": "db", "meta": {"owner": "team-b"}},
+      {"id": "3", "name": "web server", "meta": {"owner": "team-a"}},
+      {"id": "4", "name": "7th", "meta": {"owner": "team-a"}}
+    ]}`))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  if err != nil { t.Fatalf("import_ids_test.go: %s", err) }
+
+  var out bytes.Buffer
+  count, err := ImportIDs(client, &ImportIDsOpt{ Path: "/api/things", ResultsKey: "items", SearchKey: "/meta/owner", SearchValue: "team-a", NameKey: "name" }, &out)
+  if err != nil { t.Fatalf("import_ids_test.go: %s", err) }
+  if count != 3 { t.Fatalf("import_ids_test.go: Expected 3 matching objects but got %d", count) }
+
+  expected := "terraform import restapi_object.web_server '/api/things/1'\n" +
+    "terraform import restapi_object.web_server_2 '/api/things/3'\n" +
+    "terraform import restapi_object.object_7th '/api/things/4'\n"
+  if out.String() != expected { t.Fatalf("import_ids_test.go: Got:\n%s\nbut expected:\n%s", out.String(), expected) }
+
+  out.Reset()
+  if _, err := ImportIDs(client, &ImportIDsOpt{ Path: "/api/things", ResultsKey: "items", SearchKey: "id", SearchValue: "2", Blocks: true }, &out); err != nil {
+    t.Fatalf("import_ids_test.go: %s", err)
+  }
+  expected = "import {\n  to = restapi_object.object_2\n  id = \"/api/things/2\"\n}\n\n"
+  if out.String() != expected { t.Fatalf("import_ids_test.go: Got:\n%s\nbut expected:\n%s", out.String(), expected) }
+}
+
+func TestImportIDsUniqueNames(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(`[
+      {"id": "1", "name": "web_2"},
+      {"id": "2", "name": "web"},
+      {"id": "3", "name": "web"},
+      {"id": "4", "name": "web"}
+    ]`))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  if err != nil { t.Fatalf("import_ids_test.go: %s", err) }
+
+  var out bytes.Buffer
+  if _, err := ImportIDs(client, &ImportIDsOpt{ Path: "/api/things", NameKey: "name" }, &out); err != nil { t.Fatalf("import_ids_test.go: %s", err) }
+  expected := "terraform import restapi_object.web_2 '/api/things/1'\n" +
+    "terraform import restapi_object.web '/api/things/2'\n" +
+    "terraform import restapi_object.web_3 '/api/things/3'\n" +
+    "terraform import restapi_object.web_4 '/api/things/4'\n"
+  if out.String() != expected { t.Fatalf("import_ids_test.go: Got:\n%s\nbut expected:\n%s", out.String(), expected) }
+}
@@ -0,0 +1,132 @@
+package restapi
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "sort"
+  "strings"
+)
+
+/* The order keys appeared in for every object of a JSON document,
+   indexed by the object's path ("" for the top, "/a/0/b" below) */
+type key_order map[string][]string
+
+/* Walks the user's original JSON and remembers the key order of
+   every object in it so it can be reproduced when serializing */
+func record_key_order(data string) (key_order, error) {
+  order := make(key_order)
+  d := json.NewDecoder(strings.NewReader(data))
+  d.UseNumber()
+  if err := record_value(d, "", order); err != nil { return nil, err }
+  return order, nil
+}
+
+func record_value(d *json.Decoder, path string, order key_order) error {
+  t, err := d.Token()
+  if err != nil { return err }
+
+  switch t {
+  case json.Delim('{'):
+    keys := make([]string, 0)
+    for d.More() {
+      kt, err := d.Token()
+      if err != nil { return err }
+      key := kt.(string)
+      keys = append(keys, key)
+      if err := record_value(d, path + "/" + key, order); err != nil { return err }
+    }
+    order[path] = keys
+    _, err = d.Token()
+    return err
+  case json.Delim('['):
+    for i := 0; d.More(); i++ {
+      if err := record_value(d, fmt.Sprintf("%s/%d", path, i), order); err != nil { return err }
+    }
+    _, err = d.Token()
+    return err
+  }
+  return nil
+}
+
+/* Serializes v with object keys sorted or, for objects found in
+   order, in the order they were originally given (keys that were
+   not in the original come after, sorted). Output is always the
+   same for the same input so logs and signatures are stable */
+func (client *APIClient) canonical_json(v interface{}, order key_order) ([]byte, error) {
+  var buffer bytes.Buffer
+  if err := client.write_json(&buffer, v, "", order); err != nil { return nil, err }
+  return buffer.Bytes(), nil
+}
+
+func (client *APIClient) write_json(buffer *bytes.Buffer, v interface{}, path string, order key_order) error {
+  switch value := v.(type) {
+  case map[string]interface{}:
+    buffer.WriteByte('{')
+    for i, key := range ordered_keys(value, order[path]) {
+      if i > 0 { buffer.WriteByte(',') }
+      if err := client.write_scalar(buffer, key); err != nil { return err }
+      buffer.WriteByte(':')
+      if err := client.write_json(buffer, value[key], path + "/" + key, order); err != nil { return err }
+    }
+    buffer.WriteByte('}')
+  case []interface{}:
+    buffer.WriteByte('[')
+    for i, elem := range value {
+      if i > 0 { buffer.WriteByte(',') }
+      if err := client.write_json(buffer, elem, fmt.Sprintf("%s/%d", path, i), order); err != nil { return err }
+    }
+    buffer.WriteByte(']')
+  default:
+    return client.write_scalar(buffer, value)
+  }
+  return nil
+}
+
+/* encoding/json escapes <, > and & by default and leaves other
+   non-ASCII characters alone. Strict parsers and signature checks
+   on some servers need one or both of those behaviors changed */
+func (client *APIClient) write_scalar(buffer *bytes.Buffer, v interface{}) error {
+  var scalar bytes.Buffer
+  encoder := json.NewEncoder(&scalar)
+  encoder.SetEscapeHTML(client.escape_html)
+  if err := encoder.Encode(v); err != nil { return err }
+  b := bytes.TrimSuffix(scalar.Bytes(), []byte("\n"))
+
+  if !client.escape_unicode {
+    buffer.Write(b)
+    return nil
+  }
+
+  for _, r := range string(b) {
+    switch {
+    case r < 0x80:
+      buffer.WriteRune(r)
+    case r > 0xFFFF:
+      /* Outside the BMP, this has to be a surrogate pair */
+      r -= 0x10000
+      fmt.Fprintf(buffer, "\\u%04x\\u%04x", 0xD800 + (r >> 10), 0xDC00 + (r & 0x3FF))
+    default:
+      fmt.Fprintf(buffer, "\\u%04x", r)
+    }
+  }
+  return nil
+}
+
+func ordered_keys(m map[string]interface{}, preferred []string) []string {
+  keys := make([]string, 0, len(m))
+  seen := make(map[string]bool)
+  for _, key := range preferred {
+    if _, ok := m[key]; ok && !seen[key] {
+      keys = append(keys, key)
+      seen[key] = true
+    }
+  }
+
+  rest := make([]string, 0)
+  for key := range m {
+    if !seen[key] { rest = append(rest, key) }
+  }
+  sort.Strings(rest)
+  return append(keys, rest...)
+}
@@ -0,0 +1,50 @@
+package restapi
+
+import (
+  "encoding/json"
+  "testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+  input := `{ "zebra": 1, "apple": { "y": true, "x": [ { "b": 1, "a": 2 } ] }, "mango": "yes" }`
+  var data map[string]interface{}
+  if err := json.Unmarshal([]byte(input), &data); err != nil { t.Fatalf("json_encode_test.go: %s", err) }
+  data["added"] = "later"
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1" })
+  b, err := client.encode_json(data, nil)
+  if err != nil { t.Fatalf("json_encode_test.go: %s", err) }
+  expected := `{"added":"later","apple":{"x":[{"a":2,"b":1}],"y":true},"mango":"yes","zebra":1}`
+  if string(b) != expected {
+    t.Fatalf("json_encode_test.go: Sorted output was '%s' but expected '%s'", string(b), expected)
+  }
+
+  order, err := record_key_order(input)
+  if err != nil { t.Fatalf("json_encode_test.go: %s", err) }
+  client.preserve_key_order = true
+  b, err = client.encode_json(data, order)
+  if err != nil { t.Fatalf("json_encode_test.go: %s", err) }
+  expected = `{"zebra":1,"apple":{"y":true,"x":[{"b":1,"a":2}]},"mango":"yes","added":"later"}`
+  if string(b) != expected {
+    t.Fatalf("json_encode_test.go: Ordered output was '%s' but expected '%s'", string(b), expected)
+  }
+}
+
+func TestJSONEscaping(t *testing.T) {
+  data := map[string]interface{}{ "html": "<a&b>", "text": "caf\u00e9 \U0001F600" }
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1" })
+  b, _ := client.encode_json(data, nil)
+  expected := `{"html":"\u003ca\u0026b\u003e","text":"` + "caf\u00e9 \U0001F600" + `"}`
+  if string(b) != expected {
+    t.Fatalf("json_encode_test.go: Default escaping was '%s' but expected '%s'", string(b), expected)
+  }
+
+  escape_html := false
+  client, _ = NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1", EscapeHTML: &escape_html, EscapeUnicode: true })
+  b, _ = client.encode_json(data, nil)
+  expected = `{"html":"<a&b>","text":"caf\u00e9 \ud83d\ude00"}`
+  if string(b) != expected {
+    t.Fatalf("json_encode_test.go: Custom escaping was '%s' but expected '%s'", string(b), expected)
+  }
+}
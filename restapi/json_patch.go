@@ -0,0 +1,287 @@
+package restapi
+
+import (
+  "encoding/json"
+  "fmt"
+  "reflect"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/* Applies overlays, in order, on top of a base JSON document. Each
+   overlay is either a JSON object, applied as an RFC 7386 merge
+   patch, or a JSON array, applied as RFC 6902 JSON Patch operations */
+func compose_overlays(base string, overlays []string) (string, error) {
+  var doc interface{}
+  if err := json.Unmarshal([]byte(base), &doc); err != nil {
+    return "", fmt.Errorf("data is not valid JSON: %s", err)
+  }
+
+  for i, overlay := range overlays {
+    var patch interface{}
+    if err := json.Unmarshal([]byte(overlay), &patch); err != nil {
+      return "", fmt.Errorf("data_overlays[%d] is not valid JSON: %s", i, err)
+    }
+
+    switch p := patch.(type) {
+    case map[string]interface{}:
+      doc = apply_merge_patch(doc, p)
+    case []interface{}:
+      var err error
+      if doc, err = apply_json_patch(doc, p); err != nil {
+        return "", fmt.Errorf("data_overlays[%d]: %s", i, err)
+      }
+    default:
+      return "", fmt.Errorf("data_overlays[%d] must be a JSON object (merge patch) or array (JSON Patch)", i)
+    }
+  }
+
+  b, err := json.Marshal(doc)
+  if err != nil { return "", err }
+  return string(b), nil
+}
+
+/* RFC 7386: objects merge recursively, null removes a key and
+   anything else replaces what was there */
+func apply_merge_patch(target interface{}, patch interface{}) interface{} {
+  p, ok := patch.(map[string]interface{})
+  if !ok { return patch }
+
+  t, ok := target.(map[string]interface{})
+  if !ok { t = make(map[string]interface{}) }
+
+  for k, v := range p {
+    if v == nil {
+      delete(t, k)
+    } else {
+      t[k] = apply_merge_patch(t[k], v)
+    }
+  }
+  return t
+}
+
+/* RFC 6902 */
+func apply_json_patch(doc interface{}, ops []interface{}) (interface{}, error) {
+  for i, raw := range ops {
+    op, ok := raw.(map[string]interface{})
+    if !ok { return nil, fmt.Errorf("operation %d is not an object", i) }
+
+    name, _ := op["op"].(string)
+    path, ok := op["path"].(string)
+    if !ok { return nil, fmt.Errorf("operation %d (%s) has no path", i, name) }
+    tokens, err := parse_pointer(path)
+    if err != nil { return nil, err }
+
+    switch name {
+    case "add":
+      doc, err = pointer_add(doc, tokens, deep_copy(op["value"]))
+    case "remove":
+      doc, err = pointer_remove(doc, tokens)
+    case "replace":
+      if doc, err = pointer_remove(doc, tokens); err == nil {
+        doc, err = pointer_add(doc, tokens, deep_copy(op["value"]))
+      }
+    case "move", "copy":
+      from, ok := op["from"].(string)
+      if !ok { return nil, fmt.Errorf("operation %d (%s) has no from", i, name) }
+      from_tokens, err := parse_pointer(from)
+      if err != nil { return nil, err }
+      value, err := pointer_get(doc, from_tokens)
+      if err != nil { return nil, err }
+      if name == "move" {
+        if doc, err = pointer_remove(doc, from_tokens); err != nil { return nil, err }
+      } else {
+        value = deep_copy(value)
+      }
+      doc, err = pointer_add(doc, tokens, value)
+    case "test":
+      value, err := pointer_get(doc, tokens)
+      if err != nil { return nil, err }
+      if !reflect.DeepEqual(value, op["value"]) {
+        return nil, fmt.Errorf("test operation %d failed: '%s' is %v, not %v", i, path, value, op["value"])
+      }
+    default:
+      return nil, fmt.Errorf("operation %d has unknown op '%s'", i, name)
+    }
+    if err != nil { return nil, fmt.Errorf("operation %d (%s %s): %s", i, name, path, err) }
+  }
+  return doc, nil
+}
+
+/* The RFC 6902 operations that turn from into to. Objects are
+   compared key by key (in sorted order, so the same change always
+   makes the same patch). Anything else that differs, arrays
+   included, is replaced as a whole - index by index patches are
+   easily misapplied when the server reordered the array */
+func json_patch_diff(path string, from interface{}, to interface{}) []interface{} {
+  ops := make([]interface{}, 0)
+  if reflect.DeepEqual(from, to) { return ops }
+
+  from_map, from_ok := from.(map[string]interface{})
+  to_map, to_ok := to.(map[string]interface{})
+  if !from_ok || !to_ok {
+    return append(ops, map[string]interface{}{ "op": "replace", "path": path, "value": to })
+  }
+
+  keys := make([]string, 0, len(from_map) + len(to_map))
+  for k := range from_map { keys = append(keys, k) }
+  for k := range to_map {
+    if _, ok := from_map[k]; !ok { keys = append(keys, k) }
+  }
+  sort.Strings(keys)
+
+  for _, k := range keys {
+    key_path := path + "/" + escape_pointer_token(k)
+    from_v, in_from := from_map[k]
+    to_v, in_to := to_map[k]
+    switch {
+    case !in_to:
+      ops = append(ops, map[string]interface{}{ "op": "remove", "path": key_path })
+    case !in_from:
+      ops = append(ops, map[string]interface{}{ "op": "add", "path": key_path, "value": to_v })
+    default:
+      ops = append(ops, json_patch_diff(key_path, from_v, to_v)...)
+    }
+  }
+  return ops
+}
+
+/* The RFC 7386 merge patch that turns from into to: only changed
+   keys, with null for the ones that were removed. Objects that are
+   equal give an empty patch. Since null means remove, a key that
+   was changed to null is removed too */
+func merge_patch_diff(from map[string]interface{}, to map[string]interface{}) map[string]interface{} {
+  patch := make(map[string]interface{})
+  for k := range from {
+    if _, ok := to[k]; !ok { patch[k] = nil }
+  }
+  for k, to_v := range to {
+    from_v, ok := from[k]
+    if ok && reflect.DeepEqual(from_v, to_v) { continue }
+
+    from_map, from_ok := from_v.(map[string]interface{})
+    to_map, to_ok := to_v.(map[string]interface{})
+    if ok && from_ok && to_ok {
+      patch[k] = merge_patch_diff(from_map, to_map)
+    } else {
+      patch[k] = to_v
+    }
+  }
+  return patch
+}
+
+/* RFC 6901. "" is the whole document */
+func parse_pointer(pointer string) ([]string, error) {
+  if pointer == "" { return []string{}, nil }
+  if !strings.HasPrefix(pointer, "/") {
+    return nil, fmt.Errorf("JSON pointer '%s' must start with /", pointer)
+  }
+  tokens := strings.Split(pointer[1:], "/")
+  for i, t := range tokens {
+    tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+  }
+  return tokens, nil
+}
+
+func escape_pointer_token(token string) string {
+  return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func pointer_get(doc interface{}, tokens []string) (interface{}, error) {
+  current := doc
+  for _, t := range tokens {
+    switch c := current.(type) {
+    case map[string]interface{}:
+      v, ok := c[t]
+      if !ok { return nil, fmt.Errorf("key '%s' does not exist", t) }
+      current = v
+    case []interface{}:
+      i, err := array_index(t, len(c) - 1)
+      if err != nil { return nil, err }
+      current = c[i]
+    default:
+      return nil, fmt.Errorf("cannot look up '%s' in a scalar value", t)
+    }
+  }
+  return current, nil
+}
+
+/* Runs change on the container holding the last token and puts
+   whatever container it returns back in its place */
+func pointer_change(doc interface{}, tokens []string, change func(interface{}, string) (interface{}, error)) (interface{}, error) {
+  if len(tokens) == 1 { return change(doc, tokens[0]) }
+
+  child, err := pointer_get(doc, tokens[:1])
+  if err != nil { return nil, err }
+  child, err = pointer_change(child, tokens[1:], change)
+  if err != nil { return nil, err }
+
+  switch c := doc.(type) {
+  case map[string]interface{}:
+    c[tokens[0]] = child
+  case []interface{}:
+    i, _ := array_index(tokens[0], len(c) - 1)
+    c[i] = child
+  }
+  return doc, nil
+}
+
+func pointer_add(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+  if len(tokens) == 0 { return value, nil }
+  return pointer_change(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+    switch p := parent.(type) {
+    case map[string]interface{}:
+      p[key] = value
+      return p, nil
+    case []interface{}:
+      if key == "-" { return append(p, value), nil }
+      i, err := array_index(key, len(p))
+      if err != nil { return nil, err }
+      p = append(p, nil)
+      copy(p[i+1:], p[i:])
+      p[i] = value
+      return p, nil
+    }
+    return nil, fmt.Errorf("cannot add '%s' to a scalar value", key)
+  })
+}
+
+func pointer_remove(doc interface{}, tokens []string) (interface{}, error) {
+  if len(tokens) == 0 { return nil, nil }
+  return pointer_change(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+    switch p := parent.(type) {
+    case map[string]interface{}:
+      if _, ok := p[key]; !ok { return nil, fmt.Errorf("key '%s' does not exist", key) }
+      delete(p, key)
+      return p, nil
+    case []interface{}:
+      i, err := array_index(key, len(p) - 1)
+      if err != nil { return nil, err }
+      return append(p[:i], p[i+1:]...), nil
+    }
+    return nil, fmt.Errorf("cannot remove '%s' from a scalar value", key)
+  })
+}
+
+func array_index(token string, max int) (int, error) {
+  i, err := strconv.Atoi(token)
+  if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+    return 0, fmt.Errorf("'%s' is not a valid array index", token)
+  }
+  return i, nil
+}
+
+func deep_copy(v interface{}) interface{} {
+  switch value := v.(type) {
+  case map[string]interface{}:
+    c := make(map[string]interface{}, len(value))
+    for k, e := range value { c[k] = deep_copy(e) }
+    return c
+  case []interface{}:
+    c := make([]interface{}, len(value))
+    for i, e := range value { c[i] = deep_copy(e) }
+    return c
+  }
+  return v
+}
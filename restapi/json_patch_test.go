@@ -0,0 +1,81 @@
+package restapi
+
+import (
+  "encoding/json"
+  "reflect"
+  "testing"
+)
+
+func TestComposeOverlays(t *testing.T) {
+  base := `{ "name": "web", "tags": [ "a", "b" ], "settings": { "size": 1, "color": "red" } }`
+  overlays := []string{
+    `{ "settings": { "size": 3, "color": null }, "env": "prod" }`,
+    `[ { "op": "add", "path": "/tags/1", "value": "x" },
+       { "op": "remove", "path": "/tags/0" },
+       { "op": "copy", "from": "/name", "path": "/settings/owner" },
+       { "op": "test", "path": "/env", "value": "prod" } ]`,
+  }
+
+  res, err := compose_overlays(base, overlays)
+  if err != nil { t.Fatalf("json_patch_test.go: %s", err) }
+  expected := `{"env":"prod","name":"web","settings":{"owner":"web","size":3},"tags":["x","b"]}`
+  if res != expected {
+    t.Fatalf("json_patch_test.go: Composed data was '%s' but expected '%s'", res, expected)
+  }
+
+  _, err = compose_overlays(base, []string{ `[ { "op": "test", "path": "/name", "value": "db" } ]` })
+  if err == nil { t.Fatalf("json_patch_test.go: Failing test operation did not return an error") }
+}
+
+func TestJSONPatchDiff(t *testing.T) {
+  from := map[string]interface{}{
+    "name": "web",
+    "tags": []interface{}{ "a", "b" },
+    "settings": map[string]interface{}{ "size": 1.0, "color": "red", "a/b": true },
+    "old": "x",
+  }
+  to := map[string]interface{}{
+    "name": "web",
+    "tags": []interface{}{ "b" },
+    "settings": map[string]interface{}{ "size": 2.0, "color": "red", "a/b": false },
+    "new": map[string]interface{}{ "k": "v" },
+  }
+
+  ops := json_patch_diff("", from, to)
+  b, _ := json.Marshal(ops)
+  expected := `[{"op":"add","path":"/new","value":{"k":"v"}},{"op":"remove","path":"/old"},{"op":"replace","path":"/settings/a~1b","value":false},{"op":"replace","path":"/settings/size","value":2},{"op":"replace","path":"/tags","value":["b"]}]`
+  if string(b) != expected { t.Fatalf("json_patch_test.go: Diff was '%s' but expected '%s'", string(b), expected) }
+
+  /* Applying the diff gets from to to */
+  res, err := apply_json_patch(deep_copy(from), ops)
+  if err != nil { t.Fatalf("json_patch_test.go: %s", err) }
+  if !reflect.DeepEqual(res, to) { t.Fatalf("json_patch_test.go: Applying the diff gave %v, not %v", res, to) }
+
+  if ops := json_patch_diff("", to, to); len(ops) != 0 { t.Fatalf("json_patch_test.go: Diff of equal documents was %v", ops) }
+}
+
+func TestMergePatchDiff(t *testing.T) {
+  from := map[string]interface{}{
+    "name": "web",
+    "tags": []interface{}{ "a", "b" },
+    "settings": map[string]interface{}{ "size": 1.0, "color": "red" },
+    "old": "x",
+  }
+  to := map[string]interface{}{
+    "name": "web",
+    "tags": []interface{}{ "b" },
+    "settings": map[string]interface{}{ "size": 2.0, "color": "red" },
+    "new": "y",
+  }
+
+  patch := merge_patch_diff(from, to)
+  b, _ := json.Marshal(patch)
+  expected := `{"new":"y","old":null,"settings":{"size":2},"tags":["b"]}`
+  if string(b) != expected { t.Fatalf("json_patch_test.go: Merge patch was '%s' but expected '%s'", string(b), expected) }
+
+  /* Applying the patch gets from to to */
+  if res := apply_merge_patch(deep_copy(from), patch); !reflect.DeepEqual(res, to) {
+    t.Fatalf("json_patch_test.go: Applying the merge patch gave %v, not %v", res, to)
+  }
+  if patch := merge_patch_diff(to, to); len(patch) != 0 { t.Fatalf("json_patch_test.go: Merge patch of equal objects was %v", patch) }
+}
@@ -0,0 +1,97 @@
+package restapi
+
+import (
+  "bytes"
+  "fmt"
+  "io"
+  "log"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+)
+
+/* Terraform filters provider output on these prefixes (TF_LOG=INFO
+   and so on), so every message carries one */
+const (
+  level_trace = "TRACE"
+  level_debug = "DEBUG"
+  level_info  = "INFO"
+  level_warn  = "WARN"
+  level_error = "ERROR"
+)
+
+/* One message plus key/value pairs, written as a single line:
+     [DEBUG] api_client.go: Sending request method=GET path=/things
+   Values are quoted when they would otherwise be ambiguous */
+func log_at(level string, source string, msg string, fields ...interface{}) {
+  var buffer bytes.Buffer
+  buffer.WriteString("[" + level + "] " + source + ": " + msg)
+  for i := 0; i < len(fields); i += 2 {
+    key := fmt.Sprintf("%v", fields[i])
+    value := "<missing>"
+    if i + 1 < len(fields) { value = fmt.Sprintf("%v", fields[i+1]) }
+    buffer.WriteString(" " + key + "=" + quote_log_value(value))
+  }
+  log.Print(buffer.String())
+}
+
+func log_trace(source string, msg string, fields ...interface{}) { log_at(level_trace, source, msg, fields...) }
+func log_debug(source string, msg string, fields ...interface{}) { log_at(level_debug, source, msg, fields...) }
+func log_info(source string, msg string, fields ...interface{})  { log_at(level_info, source, msg, fields...) }
+func log_warn(source string, msg string, fields ...interface{})  { log_at(level_warn, source, msg, fields...) }
+func log_error(source string, msg string, fields ...interface{}) { log_at(level_error, source, msg, fields...) }
+
+func quote_log_value(value string) string {
+  if value == "" || strings.ContainsAny(value, " \t\r\n\"=") { return strconv.Quote(value) }
+  return value
+}
+
+/* Redaction happens on the way out of the log package, so nothing -
+   not even a stray log.Printf - can write a secret the provider knows
+   about. Patterns from every configured provider (aliases included)
+   are applied, since they all share the process' log output */
+var redact_mutex sync.RWMutex
+var redact_patterns = make(map[string]*regexp.Regexp)
+var redact_install sync.Once
+
+type redacting_writer struct {
+  out io.Writer
+}
+
+func (w redacting_writer) Write(p []byte) (int, error) {
+  if _, err := w.out.Write([]byte(redact(string(p)))); err != nil { return 0, err }
+  return len(p), nil
+}
+
+func redact(s string) string {
+  redact_mutex.RLock()
+  defer redact_mutex.RUnlock()
+
+  /* Longest first so a secret containing another is fully hidden */
+  keys := make([]string, 0, len(redact_patterns))
+  for k := range redact_patterns { keys = append(keys, k) }
+  sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+  for _, k := range keys {
+    s = redact_patterns[k].ReplaceAllString(s, "REDACTED")
+  }
+  return s
+}
+
+/* Registers regular expressions to hide in the logs. secrets are
+   literal values (passwords, tokens) that are always hidden */
+func add_log_redactions(patterns []*regexp.Regexp, secrets ...string) {
+  redact_install.Do(func() { log.SetOutput(redacting_writer{ out: log.Writer() }) })
+
+  redact_mutex.Lock()
+  defer redact_mutex.Unlock()
+  for _, re := range patterns { redact_patterns[re.String()] = re }
+  for _, secret := range secrets {
+    /* Short "secrets" would redact half of every message */
+    if len(secret) < 4 { continue }
+    re := regexp.MustCompile(regexp.QuoteMeta(secret))
+    redact_patterns[re.String()] = re
+  }
+}
@@ -0,0 +1,27 @@
+package restapi
+
+import (
+  "bytes"
+  "log"
+  "regexp"
+  "strings"
+  "testing"
+)
+
+func TestLogRedaction(t *testing.T) {
+  var buffer bytes.Buffer
+  add_log_redactions([]*regexp.Regexp{ regexp.MustCompile(`tok_[a-z0-9]+`) }, "hunter22")
+  original := log.Writer()
+  log.SetOutput(redacting_writer{ out: &buffer })
+  defer log.SetOutput(original)
+
+  log_debug("logging_test.go", "Sending request", "password", "hunter22", "body", `{"token": "tok_abc123"}`)
+  out := buffer.String()
+
+  if strings.Contains(out, "hunter22") || strings.Contains(out, "tok_abc123") {
+    t.Fatalf("logging_test.go: Secret was not redacted: %s", out)
+  }
+  if !strings.Contains(out, `[DEBUG] logging_test.go: Sending request password=REDACTED body="{\"token\": \"REDACTED\"}"`) {
+    t.Fatalf("logging_test.go: Unexpected log line: %s", out)
+  }
+}
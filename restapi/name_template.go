@@ -0,0 +1,73 @@
+package restapi
+
+import (
+  "bytes"
+  "regexp"
+  "strings"
+  "sync"
+  "text/template"
+  "unicode"
+)
+
+/* Functions available in name_template, so names can be made to
+   look like what the API would turn them into anyway */
+var name_template_funcs = template.FuncMap{
+  "slugify":  slugify,
+  "truncate": truncate_runes,
+  "lower":    strings.ToLower,
+  "upper":    strings.ToUpper,
+  "trim":     strings.TrimSpace,
+  "replace":  func(old string, new string, s string) string { return strings.Replace(s, old, new, -1) },
+}
+
+var slug_separators = regexp.MustCompile(`[^a-z0-9]+`)
+
+/* "My Cool  Name!" -> "my-cool-name" */
+func slugify(s string) string {
+  return strings.Trim(slug_separators.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+/* Used as {{ .value | truncate 32 }}, so the length comes first */
+func truncate_runes(n int, s string) string {
+  r := []rune(s)
+  if n < 0 || len(r) <= n { return s }
+  return string(r[:n])
+}
+
+/* Names that only differ in case and punctuation are the same name
+   as far as APIs that normalize them are concerned */
+func normalize_name(s string) string {
+  var buffer strings.Builder
+  for _, r := range strings.ToLower(s) {
+    if unicode.IsLetter(r) || unicode.IsDigit(r) { buffer.WriteRune(r) }
+  }
+  return buffer.String()
+}
+
+/* Templates are parsed once per client no matter how many objects
+   (or operations on them) use the same one */
+type template_cache struct {
+  mutex     sync.Mutex
+  templates map[string]*template.Template
+}
+
+func (c *template_cache) get(text string) (*template.Template, error) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  if t, ok := c.templates[text]; ok { return t, nil }
+  t, err := template.New("name_template").Funcs(name_template_funcs).Option("missingkey=error").Parse(text)
+  if err != nil { return nil, err }
+  if c.templates == nil { c.templates = make(map[string]*template.Template) }
+  c.templates[text] = t
+  return t, nil
+}
+
+/* .value is the field's current value and .data the whole object */
+func apply_name_template(t *template.Template, value interface{}, data map[string]interface{}) (string, error) {
+  var buffer bytes.Buffer
+  if err := t.Execute(&buffer, map[string]interface{}{ "value": value, "data": data }); err != nil {
+    return "", err
+  }
+  return buffer.String(), nil
+}
@@ -0,0 +1,24 @@
+package restapi
+
+import (
+  "testing"
+)
+
+func TestNameTemplate(t *testing.T) {
+  cache := template_cache{}
+  tmpl, err := cache.get(`{{ .data.env }}-{{ .value | slugify | truncate 12 }}`)
+  if err != nil { t.Fatalf("name_template_test.go: %s", err) }
+
+  name, err := apply_name_template(tmpl, "My Cool  Service!", map[string]interface{}{ "env": "prod" })
+  if err != nil { t.Fatalf("name_template_test.go: %s", err) }
+  if name != "prod-my-cool-serv" {
+    t.Fatalf("name_template_test.go: Got '%s' but expected 'prod-my-cool-serv'", name)
+  }
+
+  again, _ := cache.get(`{{ .data.env }}-{{ .value | slugify | truncate 12 }}`)
+  if again != tmpl { t.Fatalf("name_template_test.go: Template was parsed twice") }
+
+  if normalize_name("Prod_My-Cool") != normalize_name("prod my cool") {
+    t.Fatalf("name_template_test.go: Names differing in case and punctuation did not match")
+  }
+}
@@ -0,0 +1,56 @@
+package restapi
+
+import (
+  "fmt"
+)
+
+/* What a null in data means, per JSON pointer ("*" for everything
+   not listed):
+     null   - send null (the default)
+     omit   - leave the key out of the request
+     delete - leave it out of creates, but send null on updates so
+              servers that treat null as "clear" drop their value */
+type null_policy map[string]string
+
+func new_null_policy(policy map[string]string) (null_policy, error) {
+  for path, p := range policy {
+    if p != "null" && p != "omit" && p != "delete" {
+      return nil, fmt.Errorf("Invalid null_policy '%s' for '%s': must be null, omit or delete", p, path)
+    }
+  }
+  return null_policy(policy), nil
+}
+
+func (policy null_policy) for_path(path string) string {
+  if p, ok := policy[path]; ok { return p }
+  if p, ok := policy["*"]; ok { return p }
+  return "null"
+}
+
+/* Returns a copy of data with the policy applied for op ("create"
+   or "update"). data itself is left alone */
+func (policy null_policy) apply(data map[string]interface{}, op string) map[string]interface{} {
+  if len(policy) == 0 { return data }
+  return policy.apply_value(data, "", op).(map[string]interface{})
+}
+
+func (policy null_policy) apply_value(v interface{}, path string, op string) interface{} {
+  switch value := v.(type) {
+  case map[string]interface{}:
+    out := make(map[string]interface{}, len(value))
+    for k, e := range value {
+      child := path + "/" + escape_pointer_token(k)
+      if e == nil {
+        p := policy.for_path(child)
+        if p == "omit" || (p == "delete" && op != "update") { continue }
+      }
+      out[k] = policy.apply_value(e, child, op)
+    }
+    return out
+  case []interface{}:
+    out := make([]interface{}, len(value))
+    for i, e := range value { out[i] = policy.apply_value(e, fmt.Sprintf("%s/%d", path, i), op) }
+    return out
+  }
+  return v
+}
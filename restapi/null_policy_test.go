@@ -0,0 +1,29 @@
+package restapi
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestNullPolicy(t *testing.T) {
+  policy, err := new_null_policy(map[string]string{ "*": "omit", "/keep": "null", "/settings/color": "delete" })
+  if err != nil { t.Fatalf("null_policy_test.go: %s", err) }
+
+  data := map[string]interface{}{
+    "name": "web",
+    "keep": nil,
+    "drop": nil,
+    "settings": map[string]interface{}{ "color": nil, "size": 1 },
+  }
+
+  created := policy.apply(data, "create")
+  expected := map[string]interface{}{ "name": "web", "keep": nil, "settings": map[string]interface{}{ "size": 1 } }
+  if !reflect.DeepEqual(created, expected) { t.Fatalf("null_policy_test.go: Unexpected create data %v", created) }
+
+  updated := policy.apply(data, "update")
+  expected["settings"] = map[string]interface{}{ "color": nil, "size": 1 }
+  if !reflect.DeepEqual(updated, expected) { t.Fatalf("null_policy_test.go: Unexpected update data %v", updated) }
+
+  if _, ok := data["drop"]; !ok { t.Fatalf("null_policy_test.go: Original data was changed") }
+  if _, err := new_null_policy(map[string]string{ "/x": "maybe" }); err == nil { t.Fatalf("null_policy_test.go: Invalid policy was accepted") }
+}
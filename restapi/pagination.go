@@ -0,0 +1,81 @@
+package restapi
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/url"
+  "regexp"
+  "strings"
+)
+
+/* Stops a server that always has a next page from reading forever */
+const max_object_pages = 1000
+
+var link_next = regexp.MustCompile(`<([^>]*)>[^,]*;\s*rel="?next"?`)
+
+/* Objects too big for one response (groups with thousands of members)
+   come back a page at a time. Each further page's list_key is added
+   to the first page's, so the object is compared as a whole. The next
+   page is found in next_key of the body or, without one, the Link header */
+func (obj *APIObject) read_pages(first *api_response) (string, error) {
+  var object map[string]interface{}
+  if err := json.Unmarshal([]byte(first.body), &object); err != nil { return "", err }
+  items, ok := object[obj.page_list_key].([]interface{})
+  if !ok { return "", fmt.Errorf("Response for '%s' has no list under page_list_key '%s'", obj.id, obj.page_list_key) }
+
+  page := object
+  res := first
+  current := add_query(obj.op_path(obj.read_path), obj.read_query_string())
+  for pages := 1; ; pages++ {
+    next, err := obj.next_page(current, page, res)
+    if err != nil { return "", err }
+    if next == "" { break }
+    if pages >= max_object_pages { return "", fmt.Errorf("Object '%s' has more than %d pages", obj.id, max_object_pages) }
+
+    /* A next link that is just ?page=2 would lose read_query_string */
+    next = add_query(next, obj.read_query_string())
+    if obj.logs("polling") { log_debug("pagination.go", "Reading next page of object", "id", obj.id, "page", pages + 1, "path", next) }
+    if res, err = obj.send_op("read", obj.read_method, next, "", nil); err != nil { return "", err }
+    page = make(map[string]interface{})
+    if err := json.Unmarshal([]byte(res.body), &page); err != nil { return "", err }
+    more, ok := page[obj.page_list_key].([]interface{})
+    if !ok { return "", fmt.Errorf("Page %d of '%s' has no list under page_list_key '%s'", pages + 1, obj.id, obj.page_list_key) }
+    items = append(items, more...)
+    current = next
+  }
+
+  object[obj.page_list_key] = items
+  /* Where the next page was is not part of the object */
+  if obj.page_next_key != "" { delete(object, obj.page_next_key) }
+  b, err := json.Marshal(object)
+  return string(b), err
+}
+
+/* The path (relative to the client's uri) of the page after this one,
+   or "" when this is the last */
+func (obj *APIObject) next_page(current string, page map[string]interface{}, res *api_response) (string, error) {
+  next := ""
+  if obj.page_next_key != "" {
+    if v, ok := page[obj.page_next_key].(string); ok { next = v }
+  } else if match := link_next.FindStringSubmatch(res.headers.Get("Link")); match != nil {
+    next = match[1]
+  }
+  if next == "" { return "", nil }
+  return relative_page_path(obj.api_client.uri, current, next)
+}
+
+/* Next links come as full URLs, absolute paths or just a new query
+   string. Resolve them like a browser would, then make them relative
+   to base again since that is how requests are made */
+func relative_page_path(base string, current string, next string) (string, error) {
+  current_url, err := url.Parse(base + current)
+  if err != nil { return "", err }
+  next_url, err := url.Parse(next)
+  if err != nil { return "", fmt.Errorf("Invalid next page '%s': %s", next, err) }
+
+  resolved := current_url.ResolveReference(next_url).String()
+  if !strings.HasPrefix(resolved, base) {
+    return "", fmt.Errorf("Next page '%s' is not under the provider's uri '%s'", next, base)
+  }
+  return strings.TrimPrefix(resolved, base), nil
+}
@@ -0,0 +1,43 @@
+package restapi
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestReadPages(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path + "?" + r.URL.RawQuery {
+    case "/api/groups/1?":
+      w.Header().Set("Link", `</api/groups/1?page=2>; rel="next"`)
+      w.Write([]byte(`{ "id": "1", "members": [ "a", "b" ], "next": "?page=2" }`))
+    case "/api/groups/1?page=2":
+      w.Header().Set("Link", `<http://` + r.Host + `/api/groups/1?page=3>; rel="next", </api/groups/1>; rel="first"`)
+      w.Write([]byte(`{ "id": "1", "members": [ "c" ], "next": "?page=3" }`))
+    case "/api/groups/1?page=3":
+      w.Write([]byte(`{ "id": "1", "members": [ "d" ] }`))
+    default:
+      w.WriteHeader(404)
+    }
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5 })
+  for _, next_key := range []string{ "", "next" } {
+    obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/api/groups", Data: `{ "id": "1" }`, PageListKey: "members", PageNextKey: next_key })
+    if err != nil { t.Fatalf("pagination_test.go: %s", err) }
+    if err := obj.ReadObject(); err != nil { t.Fatalf("pagination_test.go: %s", err) }
+
+    members, _ := obj.APIData()["members"].([]interface{})
+    if len(members) != 4 || members[3] != "d" { t.Fatalf("pagination_test.go: Expected all 4 members (page_next_key '%s') but got %v", next_key, members) }
+    if _, ok := obj.APIData()["next"]; ok && next_key != "" { t.Fatalf("pagination_test.go: page_next_key was left in api_data") }
+  }
+
+  if _, err := relative_page_path("http://api/v1", "/things/1", "http://elsewhere/v1/things/1?page=2"); err == nil {
+    t.Fatalf("pagination_test.go: Next page on another host was followed")
+  }
+  if p, _ := relative_page_path("http://api/v1", "/things/1?page=1", "/v1/things/1?page=2"); p != "/things/1?page=2" {
+    t.Fatalf("pagination_test.go: Absolute next path resolved to '%s'", p)
+  }
+}
@@ -0,0 +1,27 @@
+package restapi
+
+import (
+  "sync"
+)
+
+/* One mutex per collection path, made on first use, for APIs that
+   fall over when siblings are created or changed at the same time */
+type path_locks struct {
+  mutex sync.Mutex
+  locks map[string]*sync.Mutex
+}
+
+/* Blocks until nothing else holds path and returns the unlock */
+func (p *path_locks) lock(path string) func() {
+  p.mutex.Lock()
+  if p.locks == nil { p.locks = make(map[string]*sync.Mutex) }
+  l, ok := p.locks[path]
+  if !ok {
+    l = &sync.Mutex{}
+    p.locks[path] = l
+  }
+  p.mutex.Unlock()
+
+  l.Lock()
+  return l.Unlock
+}
@@ -0,0 +1,38 @@
+package restapi
+
+import (
+  "sync"
+  "testing"
+  "time"
+)
+
+func TestPathLocks(t *testing.T) {
+  var locks path_locks
+  var mutex sync.Mutex
+  in_flight := map[string]int{}
+  most := map[string]int{}
+
+  var wg sync.WaitGroup
+  for i := 0; i < 6; i++ {
+    path := "/api/a"
+    if i % 2 == 1 { path = "/api/b" }
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      defer locks.lock(path)()
+      mutex.Lock()
+      in_flight[path]++
+      if in_flight[path] > most[path] { most[path] = in_flight[path] }
+      mutex.Unlock()
+      time.Sleep(10 * time.Millisecond)
+      mutex.Lock()
+      in_flight[path]--
+      mutex.Unlock()
+    }()
+  }
+  wg.Wait()
+
+  for path, n := range most {
+    if n != 1 { t.Fatalf("path_lock_test.go: %d operations on '%s' ran at once", n, path) }
+  }
+}
@@ -1,6 +1,8 @@
 package restapi
 
 import (
+ "os"
+ "strings"
  "github.com/hashicorp/terraform/helper/schema"
  "github.com/hashicorp/terraform/terraform"
 )
@@ -12,7 +14,13 @@ func Provider() terraform.ResourceProvider {
         Type: schema.TypeString,
         Required: true,
         DefaultFunc: schema.EnvDefaultFunc("REST_API_URI", nil),
-        Description: "URI of the REST API endpoint. This serves as the base of all requests.",
+        Description: "URI of the REST API endpoint. This serves as the base of all requests. Use unix:///path/to/socket to talk to an API listening on a unix domain socket.",
+      },
+      "unix_socket_base_url": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_UNIX_SOCKET_BASE_URL", "http://localhost"),
+        Description: "When uri is a unix socket, requests are made to this URL (virtual host and optional path prefix, such as http://docker/v1.41) over the socket.",
       },
       "insecure": &schema.Schema{
         Type: schema.TypeBool,
@@ -48,7 +56,7 @@ func Provider() terraform.ResourceProvider {
         Type: schema.TypeString,
         Optional: true,
         DefaultFunc: schema.EnvDefaultFunc("REST_API_ID_ATTRIBUTE", nil),
-        Description: "When set, this key will be used to operate on REST objects. For example, if the ID is set to 'name', changes to the API object will be to http://foo.com/bar/VALUE_OF_NAME",
+        Description: "When set, this key will be used to operate on REST objects. For example, if the ID is set to 'name', changes to the API object will be to http://foo.com/bar/VALUE_OF_NAME. A dotted path such as 'data.attributes.uuid' finds the id in nested objects.",
       },
       "copy_keys": &schema.Schema{
         Type: schema.TypeList,
@@ -69,6 +77,446 @@ func Provider() terraform.ResourceProvider {
         DefaultFunc: schema.EnvDefaultFunc("REST_API_CRO", nil),
         Description: "Set this when the API returns the object created only on creation operations (POST). This is used by the provider to refresh internal data structures.",
       },
+      "create_method": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CREATE_METHOD", "POST"),
+        Description: "The HTTP method used to create objects.",
+      },
+      "read_method": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_READ_METHOD", "GET"),
+        Description: "The HTTP method used to read objects.",
+      },
+      "update_method": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_UPDATE_METHOD", "PUT"),
+        Description: "The HTTP method used to update objects, such as PATCH.",
+      },
+      "destroy_method": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_DESTROY_METHOD", "DELETE"),
+        Description: "The HTTP method used to delete objects.",
+      },
+      "max_retry_after": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_RETRY_AFTER", 60),
+        Description: "When the API responds with 429 or 503 and a Retry-After header, the client will wait and retry the request as long as the total time spent waiting (in seconds) stays below this value. Set to 0 to disable.",
+      },
+      "rate_limit": &schema.Schema{
+        Type: schema.TypeFloat,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_RATE_LIMIT", 0),
+        Description: "When set, limits the number of requests per second sent to the API. This limit is shared by all objects managed by the provider. Default is 0 (no limit).",
+      },
+      "rate_limit_burst": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_RATE_LIMIT_BURST", 1),
+        Description: "When rate_limit is set, this many requests may be sent at once before the limit applies.",
+      },
+      "read_rate_limit": &schema.Schema{
+        Type: schema.TypeFloat,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_READ_RATE_LIMIT", 0),
+        Description: "When set, limits the number of reads (GET, HEAD and OPTIONS requests) per second sent to the API, on top of rate_limit. Default is 0 (no limit).",
+      },
+      "write_rate_limit": &schema.Schema{
+        Type: schema.TypeFloat,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_WRITE_RATE_LIMIT", 0),
+        Description: "When set, limits the number of writes (every other request) per second sent to the API, on top of rate_limit. Default is 0 (no limit).",
+      },
+      "fair_queueing": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_FAIR_QUEUEING", nil),
+        Description: "When set along with rate_limit, reads and writes for each resource path queue separately and take turns at the rate limit, so a refresh of a huge collection does not starve other operations.",
+      },
+      "max_concurrent_requests": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_CONCURRENT_REQUESTS", 0),
+        Description: "When set, at most this many requests are in flight to the API at once, whatever terraform's -parallelism is. Others wait their turn. Default is 0 (no limit).",
+      },
+      "circuit_breaker_threshold": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CIRCUIT_BREAKER_THRESHOLD", 0),
+        Description: "When set, after this many consecutive failed requests (connection errors or 5xx responses) the provider stops sending requests to the API and fails immediately. Default is 0 (disabled).",
+      },
+      "proxy_url": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_PROXY_URL", nil),
+        Description: "When set, all requests are sent through this proxy (for example, http://proxy.local:3128 or socks5://bastion.local:1080) instead of any proxy set in the HTTP_PROXY/HTTPS_PROXY environment variables.",
+      },
+      "proxy_username": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_PROXY_USERNAME", nil),
+        Description: "When set, will use this username to authenticate to the proxy set in proxy_url.",
+      },
+      "proxy_password": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        Sensitive: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_PROXY_PASSWORD", nil),
+        Description: "When set, will use this password to authenticate to the proxy set in proxy_url.",
+      },
+      "max_api_data_size": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_API_DATA_SIZE", 0),
+        Description: "When set, the total size (in bytes) of the values stored in each object's api_data is capped at this value. Values past the cap are truncated and api_data_truncated is set. Default is 0 (no limit).",
+      },
+      "read_only": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_READ_ONLY", nil),
+        Description: "When set, the provider refuses to send any request that could change the API (anything other than GET, HEAD or OPTIONS). Reads and data sources work as usual.",
+      },
+      "ip_family": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_IP_FAMILY", "auto"),
+        Description: "Which IP versions to connect with: auto (the default), ipv4, ipv6, prefer_ipv4 or prefer_ipv6. The preferred family gets 2 seconds before the other is tried.",
+      },
+      "local_address": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_LOCAL_ADDRESS", nil),
+        Description: "The local IP address, or the name of the network interface, to connect to the API from. Useful when the API only allows a specific egress address.",
+      },
+      "http2": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_HTTP2", "auto"),
+        Description: "Controls HTTP/2 use. 'auto' negotiates it over TLS, 'force' only speaks HTTP/2 over TLS, 'disable' only speaks HTTP/1.1 and 'h2c' speaks cleartext HTTP/2 with prior knowledge.",
+      },
+      "max_idle_conns": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_IDLE_CONNS", 100),
+        Description: "The maximum number of idle (keep-alive) connections kept open across all hosts.",
+      },
+      "max_idle_conns_per_host": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_IDLE_CONNS_PER_HOST", 0),
+        Description: "The maximum number of idle (keep-alive) connections kept open to the API host. Raise this for large applies so connections are reused instead of exhausting ephemeral ports. Default is 0 (net/http default of 2).",
+      },
+      "max_conns_per_host": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_CONNS_PER_HOST", 0),
+        Description: "The maximum number of connections (idle or in use) to the API host. Default is 0 (no limit).",
+      },
+      "idle_conn_timeout": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_IDLE_CONN_TIMEOUT", 90),
+        Description: "How long (in seconds) an idle connection is kept open before it is closed.",
+      },
+      "keep_alive": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_KEEP_ALIVE", 30),
+        Description: "The interval (in seconds) between TCP keep-alive probes on open connections. A negative value disables the probes.",
+      },
+      "disable_keep_alives": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_DISABLE_KEEP_ALIVES", nil),
+        Description: "When set, a new connection is opened for every request.",
+      },
+      "retry_body_patterns": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "A list of regular expressions. When any of them matches the body of a response (no matter the status code), the request is retried after retry_body_interval seconds, up to retry_body_attempts times.",
+      },
+      "retry_body_attempts": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_BODY_ATTEMPTS", 3),
+        Description: "The maximum number of times a request is retried because its response matched retry_body_patterns.",
+      },
+      "retry_body_interval": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_BODY_INTERVAL", 1),
+        Description: "How long (in seconds) to wait before retrying a request whose response matched retry_body_patterns.",
+      },
+      "compress_requests": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_COMPRESS_REQUESTS", nil),
+        Description: "When set, request bodies are gzip compressed and sent with Content-Encoding: gzip.",
+      },
+      "accept_encoding": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_ACCEPT_ENCODING", nil),
+        Description: "When set, this is sent as the Accept-Encoding header instead of letting the client negotiate gzip on its own. gzip and deflate responses are still decompressed. Use 'identity' to ask for uncompressed responses.",
+      },
+      "host_overrides": &schema.Schema{
+        Type: schema.TypeMap,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "A map of hostname to IP or IP:port. Connections to a hostname in this map are made to the given address instead of what DNS returns, while TLS verification and the Host header still use the hostname.",
+      },
+      "tls_server_name": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_TLS_SERVER_NAME", nil),
+        Description: "When set, this name is sent as the TLS SNI and used to verify the server's certificate instead of the host in uri.",
+      },
+      "host_header": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_HOST_HEADER", nil),
+        Description: "When set, this is sent as the HTTP Host header instead of the host in uri.",
+      },
+      "follow_redirects": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_FOLLOW_REDIRECTS", true),
+        Description: "Whether redirects returned by the API are followed. When false, any 3xx response is an error.",
+      },
+      "max_redirects": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_REDIRECTS", 5),
+        Description: "The maximum number of redirects followed for a single request.",
+      },
+      "redirect_auth_across_hosts": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_REDIRECT_AUTH_ACROSS_HOSTS", nil),
+        Description: "When set, the Authorization header (authorization_header or BASIC credentials) is sent again when a redirect points to a different host. By default it is dropped so credentials do not leak to other hosts.",
+      },
+      "pretty_json": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_PRETTY_JSON", nil),
+        Description: "When set, JSON sent to the API is indented instead of minified.",
+      },
+      "preserve_key_order": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_PRESERVE_KEY_ORDER", nil),
+        Description: "JSON sent to the API always has its keys in a deterministic order. By default keys are sorted; when set, keys keep the order they have in the data attribute and any others (such as copy_keys) follow, sorted.",
+      },
+      "json_escape_html": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_JSON_ESCAPE_HTML", true),
+        Description: "Whether <, > and & in strings sent to the API are escaped as \\u003c, \\u003e and \\u0026.",
+      },
+      "json_escape_unicode": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_JSON_ESCAPE_UNICODE", nil),
+        Description: "When set, every non-ASCII character in strings sent to the API is escaped as \\uXXXX.",
+      },
+      "content_type_charset": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CONTENT_TYPE_CHARSET", nil),
+        Description: "When set, this charset is added to the Content-Type header of requests with a body (for example, 'utf-8' sends 'application/json; charset=utf-8'). By default no charset is sent.",
+      },
+      "correlation_id_header": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CORRELATION_ID_HEADER", nil),
+        Description: "When set (for example, to 'X-Request-ID'), every request carries this header with an id built from correlation_id_template so API-side logs can be tied back to terraform operations.",
+      },
+      "request_id_header": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_REQUEST_ID_HEADER", "X-Request-Id"),
+        Description: "The response header holding the API's id for each request, recorded in last_operation. When a response has none, the correlation_id_header of the response is used.",
+      },
+      "correlation_id_template": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CORRELATION_ID_TEMPLATE", "{uuid}"),
+        Description: "The value sent in correlation_id_header. {run_id}, {uuid}, {method} and {path} are replaced for each request.",
+      },
+      "otlp_endpoint": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_OTLP_ENDPOINT", nil),
+        Description: "When set (for example, to 'http://collector:4318'), an OpenTelemetry span is sent to this OTLP/HTTP endpoint for every API call.",
+      },
+      "otlp_headers": &schema.Schema{
+        Type: schema.TypeMap,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Sensitive: true,
+        Description: "Headers (such as an API key for the collector) sent with every export to otlp_endpoint.",
+      },
+      "tracing_service_name": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_TRACING_SERVICE_NAME", "terraform-provider-restapi"),
+        Description: "The service.name spans sent to otlp_endpoint are reported under.",
+      },
+      "skip_exists_check": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_SKIP_EXISTS_CHECK", nil),
+        Description: "When set, the separate existence check before each refresh is skipped for every object and the read alone decides whether an object still exists.",
+      },
+      "skip_refresh": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_SKIP_REFRESH", "tagged"),
+        Description: "Which objects are not read from the API during refresh: 'tagged' (the default) skips those with refresh = \"never\", 'all' skips every object (for a quick plan when the API is known not to have changed) and 'none' refreshes everything, tags or not.",
+      },
+      "cache_ttl": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CACHE_TTL", 0),
+        Description: "When set, successful GET responses are reused for this many seconds instead of being fetched again. Any other request clears the cache. Default is 0 (no caching).",
+      },
+      "delete_retry_statuses": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeInt},
+        Optional: true,
+        Description: "Status codes (such as 409) that mean a delete failed because the object still has dependents. Such deletes are retried for up to delete_retry_timeout seconds.",
+      },
+      "delete_retry_body_patterns": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "A list of regular expressions. A delete whose error response body matches any of them is retried for up to delete_retry_timeout seconds.",
+      },
+      "delete_retry_timeout": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_DELETE_RETRY_TIMEOUT", 60),
+        Description: "How long (in seconds) deletes refused because of dependents are retried.",
+      },
+      "delete_retry_interval": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_DELETE_RETRY_INTERVAL", 5),
+        Description: "How long (in seconds) to wait between retries of deletes refused because of dependents.",
+      },
+      "create_read_retries": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CREATE_READ_RETRIES", 0),
+        Description: "For eventually consistent APIs, how many times the read that follows a create is retried when it answers 404.",
+      },
+      "create_read_retry_interval": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CREATE_READ_RETRY_INTERVAL", 1),
+        Description: "How long (in seconds) to wait before each retry of create_read_retries.",
+      },
+      "transport_retries": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_TRANSPORT_RETRIES", 0),
+        Description: "How many times a request is retried when the network fails it in a way that may pass: a connection reset or refused, an unexpected EOF, a DNS lookup that timed out or a TLS handshake timeout. Creates are only retried when the request cannot have reached the server. Certificate errors and unknown hosts are never retried.",
+      },
+      "transport_retry_interval": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_TRANSPORT_RETRY_INTERVAL", 1),
+        Description: "How long (in seconds) to wait before the first retry of transport_retries. Each retry after that waits twice as long.",
+      },
+      "conditional_reads": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_CONDITIONAL_READS", nil),
+        Description: "When set, refreshes send the ETag last seen for each object in If-None-Match, and a 304 response keeps what is in the state instead of fetching the object again.",
+      },
+      "timestamp_formats": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "Timestamp layouts (Go reference time layouts, or names such as 'RFC3339Nano'). When set, strings that parse with any of them are compared as points in time, so '2024-01-01T00:00:00Z' and '2024-01-01T00:00:00.000+00:00' are equal.",
+      },
+      "timestamp_timezone": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_TIMESTAMP_TIMEZONE", "UTC"),
+        Description: "The timezone (such as 'Europe/Berlin') of timestamps matching timestamp_formats that do not include one.",
+      },
+      "number_epsilon": &schema.Schema{
+        Type: schema.TypeFloat,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_NUMBER_EPSILON", 0),
+        Description: "Numbers whose difference is at most this are considered equal when comparing what is wanted with what the API has, so 0.3 matches 0.30000000000000004. Default is 0 (exact).",
+      },
+      "null_equals_absent": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_NULL_EQUALS_ABSENT", nil),
+        Description: "When set, a key that is null on one side and missing on the other is considered equal when comparing what is wanted with what the API has.",
+      },
+      "value_aliases": &schema.Schema{
+        Type: schema.TypeMap,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "Values the API canonicalizes, by JSON pointer (such as '/enabled'). Each value is a JSON object of configured values and what the server returns instead, such as '{\"on\": true}', so the two compare equal.",
+      },
+      "write_only_fields": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "Keys (or JSON pointers, such as '/auth/password') of secrets the API only returns hashed or encrypted. Any non-empty value the server has for them matches what is configured.",
+      },
+      "max_response_size": &schema.Schema{
+        Type: schema.TypeInt,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_RESPONSE_SIZE", 0),
+        Description: "When set, any response body larger than this many bytes (after decompression) fails the request instead of being read into memory. Default is 0 (no limit).",
+      },
+      "vcr_mode": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_VCR_MODE", nil),
+        Description: "'record' writes every HTTP interaction with the API to vcr_cassette. 'replay' answers requests from vcr_cassette without touching the API.",
+      },
+      "vcr_cassette": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_VCR_CASSETTE", nil),
+        Description: "The file vcr_mode records to or replays from.",
+      },
+      "log_redact_patterns": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "A list of regular expressions. Anything matching them is replaced with REDACTED in the provider's log output. The provider's own credentials are always redacted.",
+      },
+      "expect_content_type": &schema.Schema{
+        Type: schema.TypeString,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_EXPECT_CONTENT_TYPE", nil),
+        Description: "When set (such as to 'application/json'), successful responses of any other media type are an error instead of being parsed. With application/json, +json types such as application/hal+json are also accepted.",
+      },
+      "env_interpolation": &schema.Schema{
+        Type: schema.TypeBool,
+        Optional: true,
+        DefaultFunc: schema.EnvDefaultFunc("REST_API_ENV_INTERPOLATION", nil),
+        Description: "When set, ${env:NAME} in request bodies, headers and auth_header is replaced with the NAME environment variable as each request is sent, so secrets injected by CI never appear in the plan or state. Write it as $${env:NAME} in terraform strings.",
+      },
+      "log_categories": &schema.Schema{
+        Type: schema.TypeList,
+        Elem: &schema.Schema{Type: schema.TypeString},
+        Optional: true,
+        Description: "Turns on debug logging for only some areas of the provider: http (requests and responses), drift (how state is compared and updated), auth (which credentials are sent) and polling (retries, waits and paging). The REST_API_LOG_CATEGORIES environment variable takes a comma separated list. debug turns on all of them.",
+      },
       "debug": &schema.Schema{
         Type: schema.TypeBool,
         Optional: true,
@@ -80,7 +528,15 @@ func Provider() terraform.ResourceProvider {
       /* Could only get terraform to recognize this resource if
          the name began with the provider's name and had at least
 	 one underscore. This is not documented anywhere I could find */
-      "restapi_object": resourceRestApi(),
+      "restapi_object": flush_traces(resourceRestApi()),
+      "restapi_restore": flush_traces(resourceRestApiRestore()),
+      "restapi_collection": flush_traces(resourceRestApiCollection()),
+      "restapi_api_key": flush_traces(resourceRestApiKey()),
+    },
+    DataSourcesMap: map[string]*schema.Resource{
+      "restapi_assertion": flush_traces(dataSourceRestApiAssertion()),
+      "restapi_snapshot": flush_traces(dataSourceRestApiSnapshot()),
+      "restapi_extract": flush_traces(dataSourceRestApiExtract()),
     },
     ConfigureFunc: configureProvider,
   }
@@ -97,17 +553,166 @@ func configureProvider(d *schema.ResourceData) (interface{}, error) {
     }
   }
 
-  return NewAPIClient(
-    d.Get("uri").(string),
-    d.Get("insecure").(bool),
-    d.Get("username").(string),
-    d.Get("password").(string),
-    d.Get("authorization_header").(string),
-    d.Get("timeout").(int),
-    d.Get("id_attribute").(string),
-    copy_keys,
-    d.Get("write_returns_object").(bool),
-    d.Get("create_returns_object").(bool),
-    d.Get("debug").(bool),
-  ), nil
+  retry_body_patterns := make([]string, 0)
+  if i_patterns := d.Get("retry_body_patterns"); i_patterns != nil {
+    for _, v := range i_patterns.([]interface{}) {
+      retry_body_patterns = append(retry_body_patterns, v.(string))
+    }
+  }
+
+  log_redact_patterns := make([]string, 0)
+  if i_patterns := d.Get("log_redact_patterns"); i_patterns != nil {
+    for _, v := range i_patterns.([]interface{}) {
+      log_redact_patterns = append(log_redact_patterns, v.(string))
+    }
+  }
+
+  log_categories := make([]string, 0)
+  if i_categories := d.Get("log_categories"); i_categories != nil {
+    for _, v := range i_categories.([]interface{}) {
+      log_categories = append(log_categories, v.(string))
+    }
+  }
+  /* Lists can't have an EnvDefaultFunc */
+  if len(log_categories) == 0 && os.Getenv("REST_API_LOG_CATEGORIES") != "" {
+    for _, v := range strings.Split(os.Getenv("REST_API_LOG_CATEGORIES"), ",") {
+      if v = strings.TrimSpace(v); v != "" { log_categories = append(log_categories, v) }
+    }
+  }
+
+  delete_retry_statuses := make([]int, 0)
+  if i_statuses := d.Get("delete_retry_statuses"); i_statuses != nil {
+    for _, v := range i_statuses.([]interface{}) {
+      delete_retry_statuses = append(delete_retry_statuses, v.(int))
+    }
+  }
+
+  delete_retry_body_patterns := make([]string, 0)
+  if i_patterns := d.Get("delete_retry_body_patterns"); i_patterns != nil {
+    for _, v := range i_patterns.([]interface{}) {
+      delete_retry_body_patterns = append(delete_retry_body_patterns, v.(string))
+    }
+  }
+
+  timestamp_formats := make([]string, 0)
+  if i_formats := d.Get("timestamp_formats"); i_formats != nil {
+    for _, v := range i_formats.([]interface{}) {
+      timestamp_formats = append(timestamp_formats, v.(string))
+    }
+  }
+
+  write_only_fields := make([]string, 0)
+  for _, v := range d.Get("write_only_fields").([]interface{}) { write_only_fields = append(write_only_fields, v.(string)) }
+
+  value_aliases := make(map[string]string)
+  if i_aliases := d.Get("value_aliases"); i_aliases != nil {
+    for k, v := range i_aliases.(map[string]interface{}) {
+      value_aliases[k] = v.(string)
+    }
+  }
+
+  host_overrides := make(map[string]string)
+  if i_overrides := d.Get("host_overrides"); i_overrides != nil {
+    for k, v := range i_overrides.(map[string]interface{}) {
+      host_overrides[k] = v.(string)
+    }
+  }
+
+  otlp_headers := make(map[string]string)
+  if i_headers := d.Get("otlp_headers"); i_headers != nil {
+    for k, v := range i_headers.(map[string]interface{}) {
+      otlp_headers[k] = v.(string)
+    }
+  }
+
+  follow_redirects := d.Get("follow_redirects").(bool)
+  escape_html := d.Get("json_escape_html").(bool)
+
+  return NewAPIClient(&APIClientOpt{
+    URI:                     d.Get("uri").(string),
+    Insecure:                d.Get("insecure").(bool),
+    Username:                d.Get("username").(string),
+    Password:                d.Get("password").(string),
+    AuthHeader:              d.Get("authorization_header").(string),
+    Timeout:                 d.Get("timeout").(int),
+    IDAttribute:             d.Get("id_attribute").(string),
+    CopyKeys:                copy_keys,
+    WriteReturnsObject:      d.Get("write_returns_object").(bool),
+    CreateReturnsObject:     d.Get("create_returns_object").(bool),
+    CreateMethod:            d.Get("create_method").(string),
+    ReadMethod:              d.Get("read_method").(string),
+    UpdateMethod:            d.Get("update_method").(string),
+    DestroyMethod:           d.Get("destroy_method").(string),
+    MaxRetryAfter:           d.Get("max_retry_after").(int),
+    RateLimit:               d.Get("rate_limit").(float64),
+    RateLimitBurst:          d.Get("rate_limit_burst").(int),
+    ReadRateLimit:           d.Get("read_rate_limit").(float64),
+    WriteRateLimit:          d.Get("write_rate_limit").(float64),
+    CircuitBreakerThreshold: d.Get("circuit_breaker_threshold").(int),
+    ProxyURL:                d.Get("proxy_url").(string),
+    ProxyUsername:           d.Get("proxy_username").(string),
+    ProxyPassword:           d.Get("proxy_password").(string),
+    MaxAPIDataSize:          d.Get("max_api_data_size").(int),
+    UnixSocketBaseURL:       d.Get("unix_socket_base_url").(string),
+    ReadOnly:                d.Get("read_only").(bool),
+    HTTP2:                   d.Get("http2").(string),
+    IPFamily:                d.Get("ip_family").(string),
+    LocalAddress:            d.Get("local_address").(string),
+    MaxIdleConns:            d.Get("max_idle_conns").(int),
+    MaxIdleConnsPerHost:     d.Get("max_idle_conns_per_host").(int),
+    MaxConnsPerHost:         d.Get("max_conns_per_host").(int),
+    IdleConnTimeout:         d.Get("idle_conn_timeout").(int),
+    KeepAlive:               d.Get("keep_alive").(int),
+    DisableKeepAlives:       d.Get("disable_keep_alives").(bool),
+    RetryBodyPatterns:       retry_body_patterns,
+    RetryBodyAttempts:       d.Get("retry_body_attempts").(int),
+    RetryBodyInterval:       d.Get("retry_body_interval").(int),
+    FairQueueing:            d.Get("fair_queueing").(bool),
+    MaxConcurrentRequests:   d.Get("max_concurrent_requests").(int),
+    CompressRequests:        d.Get("compress_requests").(bool),
+    AcceptEncoding:          d.Get("accept_encoding").(string),
+    HostOverrides:           host_overrides,
+    TLSServerName:           d.Get("tls_server_name").(string),
+    HostHeader:              d.Get("host_header").(string),
+    FollowRedirects:         &follow_redirects,
+    MaxRedirects:            d.Get("max_redirects").(int),
+    RedirectAuthAcrossHosts: d.Get("redirect_auth_across_hosts").(bool),
+    PrettyJSON:              d.Get("pretty_json").(bool),
+    PreserveKeyOrder:        d.Get("preserve_key_order").(bool),
+    EscapeHTML:              &escape_html,
+    EscapeUnicode:           d.Get("json_escape_unicode").(bool),
+    ContentTypeCharset:      d.Get("content_type_charset").(string),
+    CorrelationIDHeader:     d.Get("correlation_id_header").(string),
+    RequestIDHeader:         d.Get("request_id_header").(string),
+    CorrelationIDTemplate:   d.Get("correlation_id_template").(string),
+    OTLPEndpoint:            d.Get("otlp_endpoint").(string),
+    OTLPHeaders:             otlp_headers,
+    TracingServiceName:      d.Get("tracing_service_name").(string),
+    SkipExistsCheck:         d.Get("skip_exists_check").(bool),
+    SkipRefresh:             d.Get("skip_refresh").(string),
+    LogRedactPatterns:       log_redact_patterns,
+    CacheTTL:                d.Get("cache_ttl").(int),
+    DeleteRetryStatuses:     delete_retry_statuses,
+    DeleteRetryBodyPatterns: delete_retry_body_patterns,
+    DeleteRetryTimeout:      d.Get("delete_retry_timeout").(int),
+    DeleteRetryInterval:     d.Get("delete_retry_interval").(int),
+    CreateReadRetries:       d.Get("create_read_retries").(int),
+    CreateReadRetryInterval: d.Get("create_read_retry_interval").(int),
+    TransportRetries:        d.Get("transport_retries").(int),
+    TransportRetryInterval:  d.Get("transport_retry_interval").(int),
+    ConditionalReads:        d.Get("conditional_reads").(bool),
+    TimestampFormats:        timestamp_formats,
+    TimestampTimezone:       d.Get("timestamp_timezone").(string),
+    NumberEpsilon:           d.Get("number_epsilon").(float64),
+    MaxResponseSize:         int64(d.Get("max_response_size").(int)),
+    NullEqualsAbsent:        d.Get("null_equals_absent").(bool),
+    ValueAliases:            value_aliases,
+    WriteOnlyFields:         write_only_fields,
+    VCRMode:                 d.Get("vcr_mode").(string),
+    VCRCassette:             d.Get("vcr_cassette").(string),
+    LogCategories:           log_categories,
+    EnvInterpolation:        d.Get("env_interpolation").(bool),
+    ExpectContentType:       d.Get("expect_content_type").(string),
+    Debug:                   d.Get("debug").(bool),
+  })
 }
@@ -0,0 +1,248 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "context"
+  "encoding/json"
+  "fmt"
+  "sort"
+  "time"
+)
+
+func resourceRestApiCollection() *schema.Resource {
+  return &schema.Resource{
+    Create: resourceRestApiCollectionApply,
+    Read:   resourceRestApiCollectionRead,
+    Update: resourceRestApiCollectionApply,
+    Delete: resourceRestApiCollectionDelete,
+
+    Timeouts: &schema.ResourceTimeout{
+      Create: schema.DefaultTimeout(20 * time.Minute),
+      Read:   schema.DefaultTimeout(20 * time.Minute),
+      Update: schema.DefaultTimeout(20 * time.Minute),
+    },
+
+    Schema: map[string]*schema.Schema{
+      "path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The API path on top of the base URL set in the provider of the collection to reconcile.",
+        Required:    true,
+        ForceNew:    true,
+      },
+      "desired_state": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A JSON array of the objects the collection should hold (for example, file(\"things.json\")). Every object must have the provider's id_attribute.",
+        Required:    true,
+      },
+      "results_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When the collection is wrapped in an object (for example, { \"items\": [...] }), the key holding the list of objects. By default the response must be a JSON array.",
+        Optional:    true,
+      },
+      "delete_unmanaged": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, objects on the server that are not in desired_state are deleted. By default they are left alone.",
+        Optional:    true,
+      },
+      "protected_ids": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Ids of objects that are never deleted, even with delete_unmanaged set.",
+        Optional:    true,
+      },
+      "debug": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Whether to emit verbose debug output while reconciling the collection.",
+        Optional:    true,
+      },
+      "actions": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "What the last apply did to each object, by id: create, update, delete, unchanged, unmanaged or protected.",
+        Computed:    true,
+      },
+    }, /* End schema */
+
+  }
+}
+
+/* What reconciling would do, computed from one listing of the
+   collection. desired holds the objects by id, in file order */
+type collection_plan struct {
+  ids     []string
+  desired map[string]map[string]interface{}
+  server  map[string]map[string]interface{}
+  actions map[string]string
+}
+
+func plan_collection(ctx context.Context, d *schema.ResourceData, client *APIClient) (*collection_plan, error) {
+  path := d.Get("path").(string)
+  plan := collection_plan{
+    desired: make(map[string]map[string]interface{}),
+    server: make(map[string]map[string]interface{}),
+    actions: make(map[string]string),
+  }
+
+  var desired []interface{}
+  if err := json.Unmarshal([]byte(d.Get("desired_state").(string)), &desired); err != nil {
+    return nil, fmt.Errorf("resource_api_collection.go: desired_state is not a JSON array: %s", err)
+  }
+  for i, o := range desired {
+    data, ok := o.(map[string]interface{})
+    if !ok { return nil, fmt.Errorf("resource_api_collection.go: desired_state[%d] is not a JSON object", i) }
+    id_val, ok := id_value(data, client.id_attribute)
+    if !ok { return nil, fmt.Errorf("resource_api_collection.go: desired_state[%d] has no '%s' to match it with the server", i, client.id_attribute) }
+    id := fmt.Sprintf("%v", id_val)
+    if _, dup := plan.desired[id]; dup { return nil, fmt.Errorf("resource_api_collection.go: '%s' is in desired_state more than once", id) }
+    plan.ids = append(plan.ids, id)
+    plan.desired[id] = data
+  }
+
+  res, err := client.send_request(ctx, "GET", path, "", nil)
+  if err != nil { return nil, err }
+  objects, err := parse_collection(res.body, path, d.Get("results_key").(string))
+  if err != nil { return nil, err }
+  for _, o := range objects {
+    data, ok := o.(map[string]interface{})
+    if !ok { continue }
+    if id_val, ok := id_value(data, client.id_attribute); ok {
+      plan.server[fmt.Sprintf("%v", id_val)] = data
+    }
+  }
+
+  protected := make(map[string]bool)
+  for _, id := range d.Get("protected_ids").([]interface{}) { protected[id.(string)] = true }
+
+  for _, id := range plan.ids {
+    server, ok := plan.server[id]
+    if !ok {
+      plan.actions[id] = "create"
+    } else if collection_object_matches(client.comparer, plan.desired[id], server) {
+      plan.actions[id] = "unchanged"
+    } else {
+      plan.actions[id] = "update"
+    }
+    if client.logs("drift") { log_debug("resource_api_collection.go", "Compared collection object", "id", id, "action", plan.actions[id], "desired", plan.desired[id], "server", server) }
+  }
+  for id := range plan.server {
+    if _, ok := plan.desired[id]; ok { continue }
+    if protected[id] {
+      plan.actions[id] = "protected"
+    } else if d.Get("delete_unmanaged").(bool) {
+      plan.actions[id] = "delete"
+    } else {
+      plan.actions[id] = "unmanaged"
+    }
+  }
+  return &plan, nil
+}
+
+/* Servers add keys of their own, so only the keys the
+   user manages take part in the comparison */
+func collection_object_matches(comparer *value_comparer, desired map[string]interface{}, server map[string]interface{}) bool {
+  for k, v := range desired {
+    if !comparer.equal_at("/" + escape_pointer_token(k), v, server[k]) { return false }
+  }
+  return true
+}
+
+func (plan *collection_plan) in_sync() bool {
+  for _, action := range plan.actions {
+    if action == "create" || action == "update" || action == "delete" { return false }
+  }
+  return true
+}
+
+/* Create and update are the same thing: make the server match */
+func resourceRestApiCollectionApply(d *schema.ResourceData, meta interface{}) error {
+  client := meta.(*APIClient)
+  path := d.Get("path").(string)
+  debug := d.Get("debug").(bool)
+
+  timeout := schema.TimeoutUpdate
+  if d.IsNewResource() { timeout = schema.TimeoutCreate }
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(timeout))
+  defer cancel()
+
+  plan, err := plan_collection(ctx, d, client)
+  if err != nil { return err }
+
+  /* Deterministic order makes logs and partial failures easier to follow */
+  ids := make([]string, 0, len(plan.actions))
+  for id := range plan.actions { ids = append(ids, id) }
+  sort.Strings(ids)
+
+  done := make(map[string]string)
+  for _, id := range ids {
+    action := plan.actions[id]
+    log_info("resource_api_collection.go", "Reconciling object", "action", action, "id", id, "path", path)
+
+    var err error
+    switch action {
+    case "create", "update":
+      var b []byte
+      if b, err = json.Marshal(plan.desired[id]); err != nil { break }
+      var obj *APIObject
+      obj, err = NewAPIObject(client, &APIObjectOpt{ Path: path, ID: id, Data: string(b), Debug: debug, Context: ctx })
+      if err != nil { break }
+      if action == "create" {
+        err = obj.CreateObject()
+      } else {
+        err = obj.UpdateObject()
+      }
+    case "delete":
+      var obj *APIObject
+      obj, err = NewAPIObject(client, &APIObjectOpt{ Path: path, ID: id, Data: "{}", Debug: debug, Context: ctx })
+      if err == nil { err = obj.DeleteObject() }
+    }
+
+    if err != nil {
+      /* Record what did happen so the next plan starts from there */
+      d.SetId(path)
+      d.Set("actions", done)
+      return fmt.Errorf("resource_api_collection.go: Could not %s '%s' in '%s': %s", action, id, path, err)
+    }
+    done[id] = action
+  }
+
+  d.SetId(path)
+  d.Set("actions", done)
+  return nil
+}
+
+/* When the server has drifted, the state takes the server's version
+   of the managed objects so the plan shows what apply will change */
+func resourceRestApiCollectionRead(d *schema.ResourceData, meta interface{}) error {
+  client := meta.(*APIClient)
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+  defer cancel()
+
+  plan, err := plan_collection(ctx, d, client)
+  if err != nil { return err }
+  if plan.in_sync() { return nil }
+
+  actual := make([]interface{}, 0, len(plan.ids))
+  for _, id := range plan.ids {
+    server, ok := plan.server[id]
+    if !ok { continue }
+    projected := make(map[string]interface{})
+    for k := range plan.desired[id] { projected[k] = server[k] }
+    actual = append(actual, projected)
+  }
+  for id, action := range plan.actions {
+    if action == "delete" { actual = append(actual, plan.server[id]) }
+  }
+
+  b, err := json.Marshal(actual)
+  if err != nil { return err }
+  log_info("resource_api_collection.go", "Collection has drifted from desired_state", "path", d.Get("path").(string))
+  d.Set("desired_state", string(b))
+  return nil
+}
+
+/* Objects are left on the server. Removing the resource only
+   stops reconciling the collection */
+func resourceRestApiCollectionDelete(d *schema.ResourceData, meta interface{}) error {
+  d.SetId("")
+  return nil
+}
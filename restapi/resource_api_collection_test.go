@@ -0,0 +1,55 @@
+package restapi
+
+import (
+  "github.com/TrurlMcByte/terraform-provider-restapi/fakeserver"
+  "strings"
+  "testing"
+)
+
+func TestCollection(t *testing.T) {
+  objects := map[string]map[string]interface{}{
+    "1": { "id": "1", "name": "web", "created": "by the server" },
+    "2": { "id": "2", "name": "db" },
+    "3": { "id": "3", "name": "made by hand" },
+    "4": { "id": "4", "name": "admin" },
+  }
+  svr := fakeserver.NewFakeServer(8083, objects, true, false)
+  defer svr.Shutdown()
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8083", Timeout: 5, IDAttribute: "id", WriteReturnsObject: true })
+  if err != nil { t.Fatalf("resource_api_collection_test.go: %s", err) }
+  exists := func(id string) bool {
+    _, err := client.SendRequest("GET", "/api/objects/" + id, "")
+    return err == nil
+  }
+
+  config := map[string]interface{}{
+    "path": "/api/objects",
+    "desired_state": `[ { "id": "1", "name": "web" }, { "id": "2", "name": "cache" }, { "id": "5", "name": "queue" } ]`,
+    "protected_ids": []interface{}{ "4" },
+  }
+  state, err := apply_resource(t, resourceRestApiCollection(), nil, config, client)
+  if err != nil { t.Fatalf("resource_api_collection_test.go: %s", err) }
+  for id, action := range map[string]string{ "1": "unchanged", "2": "update", "3": "unmanaged", "4": "protected", "5": "create" } {
+    if state.Attributes["actions." + id] != action { t.Fatalf("resource_api_collection_test.go: Expected '%s' for '%s' but got %v", action, id, state.Attributes) }
+  }
+  if !exists("3") || !exists("5") { t.Fatalf("resource_api_collection_test.go: Unexpected objects on the server after the first apply") }
+
+  /* Only what is not protected goes */
+  config["delete_unmanaged"] = true
+  state, err = apply_resource(t, resourceRestApiCollection(), state, config, client)
+  if err != nil { t.Fatalf("resource_api_collection_test.go: %s", err) }
+  if state.Attributes["actions.3"] != "delete" || exists("3") { t.Fatalf("resource_api_collection_test.go: The unmanaged object was not deleted %v", state.Attributes) }
+  if state.Attributes["actions.4"] != "protected" || !exists("4") { t.Fatalf("resource_api_collection_test.go: The protected object was deleted %v", state.Attributes) }
+
+  /* In sync, a refresh leaves desired_state alone */
+  refreshed, err := resourceRestApiCollection().Refresh(state, client)
+  if err != nil { t.Fatalf("resource_api_collection_test.go: %s", err) }
+  if refreshed.Attributes["desired_state"] != state.Attributes["desired_state"] { t.Fatalf("resource_api_collection_test.go: desired_state changed without drift to %s", refreshed.Attributes["desired_state"]) }
+
+  /* Changed outside of terraform, the server's version is what the state holds */
+  if _, err := client.SendRequest("PUT", "/api/objects/2", `{ "id": "2", "name": "changed by hand" }`); err != nil { t.Fatalf("resource_api_collection_test.go: %s", err) }
+  refreshed, err = resourceRestApiCollection().Refresh(state, client)
+  if err != nil { t.Fatalf("resource_api_collection_test.go: %s", err) }
+  desired := refreshed.Attributes["desired_state"]
+  if !strings.Contains(desired, "changed by hand") || strings.Contains(desired, "by the server") { t.Fatalf("resource_api_collection_test.go: Unexpected desired_state after drift %s", desired) }
+}
@@ -0,0 +1,207 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "time"
+)
+
+func resourceRestApiKey() *schema.Resource {
+  return &schema.Resource{
+    Create: resourceRestApiKeyCreate,
+    Read:   resourceRestApiKeyRead,
+    Update: resourceRestApiKeyUpdate,
+    Delete: resourceRestApiKeyDelete,
+    CustomizeDiff: resourceRestApiKeyCustomizeDiff,
+
+    Timeouts: &schema.ResourceTimeout{
+      Create: schema.DefaultTimeout(20 * time.Minute),
+      Read:   schema.DefaultTimeout(20 * time.Minute),
+      Update: schema.DefaultTimeout(20 * time.Minute),
+      Delete: schema.DefaultTimeout(20 * time.Minute),
+    },
+
+    Schema: map[string]*schema.Schema{
+      "path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The API path on top of the base URL set in the provider where keys are created. Each key is read and deleted at path/{id}.",
+        Required:    true,
+        ForceNew:    true,
+      },
+      "data": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Valid JSON data sent to create the key, such as its name and scopes.",
+        Required:    true,
+        ForceNew:    true,
+      },
+      "secret_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key (or dotted path) of the create response holding the secret. Default is 'secret'.",
+        Optional:    true,
+        Default:     "secret",
+      },
+      "id_attribute": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key holding the key's id, overriding the provider's id_attribute.",
+        Optional:    true,
+        ForceNew:    true,
+      },
+      "regenerate_on": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Arbitrary values that get a new secret when any of them changes, such as a rotation date. Without rotate_path the key is replaced.",
+        Optional:    true,
+      },
+      "rotate_path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When set, a new secret is requested here (such as /keys/{id}/rotate) when regenerate_on changes instead of replacing the key. The response must hold the new secret under secret_key.",
+        Optional:    true,
+      },
+      "rotate_method": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The HTTP method used with rotate_path. Default is POST.",
+        Optional:    true,
+        Default:     "POST",
+      },
+      "debug": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Whether to emit verbose debug output while working with the key.",
+        Optional:    true,
+      },
+      "secret": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The secret, as returned when the key was created or last rotated.",
+        Computed:    true,
+        Sensitive:   true,
+      },
+      "api_data": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "The key as the API last returned it, without the secret.",
+        Computed:    true,
+      },
+    }, /* End schema */
+
+  }
+}
+
+func make_api_key_object(ctx context.Context, d *schema.ResourceData, meta interface{}) (*APIObject, error) {
+  /* The secret is only ever in the create response */
+  returns_object := true
+  return NewAPIObject(meta.(*APIClient), &APIObjectOpt{
+    Path: d.Get("path").(string),
+    ID: d.Id(),
+    IDAttribute: d.Get("id_attribute").(string),
+    Data: d.Get("data").(string),
+    Debug: d.Get("debug").(bool),
+    CreateReturnsObject: &returns_object,
+    Context: ctx,
+  })
+}
+
+func resourceRestApiKeyCreate(d *schema.ResourceData, meta interface{}) error {
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+  defer cancel()
+  obj, err := make_api_key_object(ctx, d, meta)
+  if err != nil { return err }
+
+  if err := obj.CreateObject(); err != nil { return err }
+  /* The key exists now whether or not the secret can be found */
+  d.SetId(obj.id)
+  secret_key := d.Get("secret_key").(string)
+  secret, ok := id_value(obj.api_data, secret_key)
+  if !ok {
+    return fmt.Errorf("resource_api_key.go: Key '%s' was created but the response has no '%s'. The secret is only shown once, so the key should be deleted and created again", obj.id, secret_key)
+  }
+  log_info("resource_api_key.go", "Created API key", "id", obj.id)
+  d.Set("secret", fmt.Sprintf("%v", secret))
+  set_api_key_state(obj, d)
+  return nil
+}
+
+/* Reads keep api_data current and notice deleted keys. The secret
+   in the state is left alone - APIs return it masked, if at all */
+func resourceRestApiKeyRead(d *schema.ResourceData, meta interface{}) error {
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+  defer cancel()
+  obj, err := make_api_key_object(ctx, d, meta)
+  if err != nil { return err }
+
+  err = obj.ReadObject()
+  var api_err *APIError
+  if errors.As(err, &api_err) && api_err.StatusCode == 404 {
+    log_warn("resource_api_key.go", "API key no longer exists. Removing it from the state", "id", obj.id)
+    d.SetId("")
+    return nil
+  }
+  if err != nil { return err }
+  set_api_key_state(obj, d)
+  return nil
+}
+
+/* Only regenerate_on changing asks for a new secret. Without a
+   rotate_path that is a replacement (see the CustomizeDiff) */
+func resourceRestApiKeyUpdate(d *schema.ResourceData, meta interface{}) error {
+  if !d.HasChange("regenerate_on") { return nil }
+
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+  defer cancel()
+  obj, err := make_api_key_object(ctx, d, meta)
+  if err != nil { return err }
+
+  res, err := obj.send(method_or(d.Get("rotate_method").(string), "POST"), obj.op_path(d.Get("rotate_path").(string)), "", nil)
+  if err != nil { return err }
+  rotated := make(map[string]interface{})
+  if err := json.Unmarshal([]byte(res.body), &rotated); err != nil {
+    return fmt.Errorf("resource_api_key.go: Rotating '%s' did not return a JSON object: %s", obj.id, err)
+  }
+  secret_key := d.Get("secret_key").(string)
+  secret, ok := id_value(rotated, secret_key)
+  if !ok { return fmt.Errorf("resource_api_key.go: Rotating '%s' returned no '%s'", obj.id, secret_key) }
+
+  /* Some APIs issue a new key (and id) instead of a new secret */
+  if id, ok := id_value(rotated, obj.id_attribute); ok && fmt.Sprintf("%v", id) != obj.id {
+    log_info("resource_api_key.go", "Rotation replaced the API key", "old_id", obj.id, "id", id)
+    obj.id = fmt.Sprintf("%v", id)
+    d.SetId(obj.id)
+  }
+  log_info("resource_api_key.go", "Rotated API key", "id", obj.id)
+  d.Set("secret", fmt.Sprintf("%v", secret))
+
+  if err := obj.ReadObject(); err != nil { return err }
+  set_api_key_state(obj, d)
+  return nil
+}
+
+func resourceRestApiKeyDelete(d *schema.ResourceData, meta interface{}) error {
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+  defer cancel()
+  obj, err := make_api_key_object(ctx, d, meta)
+  if err != nil { return err }
+
+  err = obj.DeleteObject()
+  var api_err *APIError
+  if errors.As(err, &api_err) && api_err.StatusCode == 404 { err = nil }
+  return err
+}
+
+/* A new secret shows as known after apply, whether it comes from
+   rotate_path or from replacing the key */
+func resourceRestApiKeyCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+  if d.Id() == "" || !d.HasChange("regenerate_on") { return nil }
+  if d.Get("rotate_path").(string) == "" {
+    if err := d.ForceNew("regenerate_on"); err != nil { return err }
+  }
+  return d.SetNewComputed("secret")
+}
+
+func set_api_key_state(obj *APIObject, d *schema.ResourceData) {
+  api_data := make(map[string]string)
+  for k, v := range without_key(obj.api_data, d.Get("secret_key").(string)) {
+    api_data[k] = fmt.Sprintf("%v", v)
+  }
+  d.Set("api_data", api_data)
+}
@@ -0,0 +1,107 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/terraform"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync"
+  "testing"
+)
+
+/* Hands out secrets on create and rotate (at /keys/{id}/rotate, as a
+   new key) and never returns them on reads */
+func new_api_key_server() *httptest.Server {
+  var mutex sync.Mutex
+  keys := make(map[string]map[string]interface{})
+  issued := 0
+  issue := func(name interface{}) map[string]interface{} {
+    issued++
+    id := fmt.Sprintf("k%d", issued)
+    keys[id] = map[string]interface{}{ "id": id, "name": name }
+    return map[string]interface{}{ "id": id, "name": name, "secret": fmt.Sprintf("s%d", issued) }
+  }
+
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    mutex.Lock()
+    defer mutex.Unlock()
+    parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+    switch {
+    case len(parts) == 1 && r.Method == "POST":
+      data := make(map[string]interface{})
+      json.NewDecoder(r.Body).Decode(&data)
+      json.NewEncoder(w).Encode(issue(data["name"]))
+    case len(parts) < 2 || keys[parts[1]] == nil:
+      w.WriteHeader(404)
+    case len(parts) == 3 && r.Method == "POST":
+      name := keys[parts[1]]["name"]
+      delete(keys, parts[1])
+      json.NewEncoder(w).Encode(issue(name))
+    case r.Method == "GET":
+      json.NewEncoder(w).Encode(keys[parts[1]])
+    case r.Method == "DELETE":
+      delete(keys, parts[1])
+    }
+  }))
+}
+
+func TestAPIKey(t *testing.T) {
+  server := new_api_key_server()
+  defer server.Close()
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id" })
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+
+  config := map[string]interface{}{
+    "path": "/keys",
+    "data": `{"name":"ci"}`,
+    "regenerate_on": map[string]interface{}{ "date": "1" },
+    "rotate_path": "/keys/{id}/rotate",
+  }
+  state, err := apply_resource(t, resourceRestApiKey(), nil, config, client)
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+  if state.ID != "k1" || state.Attributes["secret"] != "s1" { t.Fatalf("resource_api_key_test.go: Unexpected state after create %v", state.Attributes) }
+  if _, ok := state.Attributes["api_data.secret"]; ok { t.Fatalf("resource_api_key_test.go: The secret is in api_data") }
+  if state.Attributes["api_data.name"] != "ci" { t.Fatalf("resource_api_key_test.go: Unexpected api_data %v", state.Attributes) }
+
+  /* Rotation here issues a new key, so the id changes too */
+  config["regenerate_on"] = map[string]interface{}{ "date": "2" }
+  diff, err := plan_resource(t, resourceRestApiKey(), state, config, client)
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+  if diff.RequiresNew() { t.Fatalf("resource_api_key_test.go: regenerate_on with rotate_path planned a replacement") }
+  state, err = apply_resource(t, resourceRestApiKey(), state, config, client)
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+  if state.ID != "k2" || state.Attributes["secret"] != "s2" { t.Fatalf("resource_api_key_test.go: Unexpected state after rotation %v", state.Attributes) }
+
+  /* Without rotate_path the only way to a new secret is a new key */
+  delete(config, "rotate_path")
+  config["regenerate_on"] = map[string]interface{}{ "date": "3" }
+  diff, err = plan_resource(t, resourceRestApiKey(), state, config, client)
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+  if !diff.RequiresNew() { t.Fatalf("resource_api_key_test.go: regenerate_on without rotate_path did not plan a replacement") }
+
+  /* Keys deleted outside of terraform leave the state */
+  refreshed, err := resourceRestApiKey().Refresh(&terraform.InstanceState{ ID: "k1", Attributes: map[string]string{ "id": "k1", "path": "/keys", "data": `{"name":"ci"}` } }, client)
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+  if refreshed != nil { t.Fatalf("resource_api_key_test.go: A key the API answers 404 for is still in the state") }
+  refreshed, err = resourceRestApiKey().Refresh(state, client)
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+  if refreshed == nil || refreshed.Attributes["secret"] != "s2" { t.Fatalf("resource_api_key_test.go: Read lost the secret") }
+}
+
+func TestAPIKeyMissingSecret(t *testing.T) {
+  server := new_api_key_server()
+  defer server.Close()
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id" })
+  if err != nil { t.Fatalf("resource_api_key_test.go: %s", err) }
+
+  state, err := apply_resource(t, resourceRestApiKey(), nil, map[string]interface{}{
+    "path": "/keys",
+    "data": `{"name":"ci"}`,
+    "secret_key": "token",
+  }, client)
+  if err == nil || !strings.Contains(err.Error(), "has no 'token'") { t.Fatalf("resource_api_key_test.go: Expected an error about the missing secret but got %v", err) }
+  /* The key was created, so terraform has to know about it */
+  if state == nil || state.ID != "k1" { t.Fatalf("resource_api_key_test.go: The created key is not in the state") }
+}
@@ -2,10 +2,15 @@ package restapi
 
 import (
   "github.com/hashicorp/terraform/helper/schema"
+  "context"
+  "encoding/json"
   "fmt"
+  "reflect"
   "strings"
+  "sort"
   "errors"
-  "log"
+  "time"
+  "unicode/utf8"
 )
 
 func resourceRestApi() *schema.Resource {
@@ -15,22 +20,51 @@ func resourceRestApi() *schema.Resource {
     Update: resourceRestApiUpdate,
     Delete: resourceRestApiDelete,
     Exists: resourceRestApiExists,
+    CustomizeDiff: resourceRestApiCustomizeDiff,
+
+    /* 1 tells this provider's state apart from the upstream provider's */
+    SchemaVersion: 1,
+    MigrateState: resourceRestApiMigrateState,
 
     Importer: &schema.ResourceImporter{
       State: resourceRestApiImport,
     },
 
+    Timeouts: &schema.ResourceTimeout{
+      Create: schema.DefaultTimeout(20 * time.Minute),
+      Read:   schema.DefaultTimeout(20 * time.Minute),
+      Update: schema.DefaultTimeout(20 * time.Minute),
+      Delete: schema.DefaultTimeout(20 * time.Minute),
+    },
+
 
     Schema: map[string]*schema.Schema{
       "path": &schema.Schema{
         Type:        schema.TypeString,
-        Description: "The API path on top of the base URL set in the provider that represents objects of this type on the API server.",
+        Description: "The API path on top of the base URL set in the provider that represents objects of this type on the API server. Keys of data in braces, such as /orgs/{org_id}/projects, are replaced with their values.",
         Required:    true,
       },
       "data": &schema.Schema{
         Type:        schema.TypeString,
         Description: "Valid JSON data that this provider will manage with the API server.",
         Required:    true,
+        DiffSuppressFunc: suppress_ignored_keys,
+      },
+      "update_data": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Valid JSON data sent on updates instead of data, for APIs that want a different shape than on create. data is still what the object is compared with.",
+        Optional:    true,
+      },
+      "destroy_data": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Valid JSON data sent as the body of deletes, such as a reason.",
+        Optional:    true,
+      },
+      "data_overlays": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "A list of patches applied, in order, on top of data before it is sent to the API. A JSON object is applied as a merge patch (RFC 7386) and a JSON array as JSON Patch operations (RFC 6902).",
+        Optional:    true,
       },
       "debug": &schema.Schema{
         Type:        schema.TypeBool,
@@ -48,6 +82,403 @@ func resourceRestApi() *schema.Resource {
         Description: "After data from the API server is read, this map will include k/v pairs usable in other terraform resources as readable objects. Currently the value is the golang fmt package's representation of the value (simple primitives are set as expected, but complex types like arrays and maps contain golang formatting).",
 	Computed:    true,
       },
+      "idempotency_header": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When set (for example, to 'Idempotency-Key'), idempotency_key is sent in this header when the object is created so retried creates are not applied twice. Updates send a key derived from it and the update body.",
+        Optional:    true,
+      },
+      "idempotency_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key sent in idempotency_header when the object is created. Unless set, it is derived from the create request, so a create that failed sends the same key when it is applied again.",
+        Optional:    true,
+        Computed:    true,
+      },
+      "name_field": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key in data that name_template is applied to.",
+        Optional:    true,
+      },
+      "name_template": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A Go template whose output replaces the name_field value before it is sent, such as '{{ .value | slugify | truncate 63 }}'. The name the API returns is matched without regard to case or punctuation.",
+        Optional:    true,
+      },
+      "if_match": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, updates and deletes send the ETag from the last read in If-Match so changes made outside of terraform are not silently overwritten.",
+        Optional:    true,
+      },
+      "version_field": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When set, the value of this key from the last read is sent in the body of updates so the API can refuse them if the object changed since.",
+        Optional:    true,
+      },
+      "version": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The JSON encoded value of version_field from the last read.",
+        Computed:    true,
+      },
+      "null_policy": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "What a null in data means, by JSON pointer (such as '/settings/color', or '*' for everything else): 'null' sends it (the default), 'omit' leaves the key out of requests and 'delete' leaves it out of creates but sends null on updates.",
+        Optional:    true,
+      },
+      "coerce": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "The JSON type to send values in data as, by JSON pointer (such as '/enabled', or '/ports/*' for every element): 'string', 'number' or 'boolean'. For APIs that want \"true\" or \"8080\" where HCL has a boolean or number, or the other way around.",
+        Optional:    true,
+      },
+      "query_string": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Query string parameters (such as api_version = 2) added to every request made for this object.",
+        Optional:    true,
+      },
+      "create_query_string": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Query string parameters added only to creates, winning over query_string.",
+        Optional:    true,
+      },
+      "read_query_string": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Query string parameters added only to reads (such as expand = all), winning over query_string.",
+        Optional:    true,
+      },
+      "update_query_string": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Query string parameters added only to updates, winning over query_string.",
+        Optional:    true,
+      },
+      "destroy_query_string": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Query string parameters added only to deletes (such as force = true), winning over query_string.",
+        Optional:    true,
+      },
+      "create_success_codes": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeInt },
+        Description: "The statuses that count as success for creates, such as [201, 409] for APIs that answer 409 when the object is already there. Any 2xx when not set. The object is read after a status that is not 2xx.",
+        Optional:    true,
+      },
+      "read_success_codes": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeInt },
+        Description: "The statuses that count as success for reads. Any 2xx when not set.",
+        Optional:    true,
+      },
+      "update_success_codes": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeInt },
+        Description: "The statuses that count as success for updates. Any 2xx when not set. The object is read after a status that is not 2xx.",
+        Optional:    true,
+      },
+      "destroy_success_codes": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeInt },
+        Description: "The statuses that count as success for deletes, such as [200, 204, 410]. Any 2xx when not set.",
+        Optional:    true,
+      },
+      "id_attribute": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key holding this object's id, overriding the provider's id_attribute. A dotted path such as 'data.attributes.uuid' finds it in nested objects.",
+        Optional:    true,
+      },
+      "id_strategy": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Where the ids of new objects come from when data has none: 'server' (the default) has the API assign them, 'uuid' generates a random UUID, 'hash' hashes the values of id_fields and 'template' uses id_template. Generated ids are put in data under id_field.",
+        Optional:    true,
+        Default:     "server",
+      },
+      "id_field": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key of data a generated id is put in. Defaults to id_attribute.",
+        Optional:    true,
+      },
+      "id_fields": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "With id_strategy 'hash', the keys (dotted paths or JSON pointers) of data whose values make up the id.",
+        Optional:    true,
+      },
+      "id_template": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "With id_strategy 'template', a template (as for name_template) given .data, such as '{{ .data.team }}-{{ .data.name | slugify }}'.",
+        Optional:    true,
+      },
+      "create_id_attribute": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "For APIs that name the id differently when an object is created, the key holding it in the create response. Defaults to id_attribute.",
+        Optional:    true,
+      },
+      "read_id_attribute": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The key holding the id when the object is read (and in data). Defaults to id_attribute.",
+        Optional:    true,
+      },
+      "create_path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Where creates are sent, when not to path. {id} is replaced with the object's id, if it is known.",
+        Optional:    true,
+      },
+      "read_path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Where reads are sent, when not to path/{id}. {id} is replaced with the object's id.",
+        Optional:    true,
+      },
+      "update_path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Where updates are sent, when not to path/{id}. {id} is replaced with the object's id.",
+        Optional:    true,
+      },
+      "destroy_path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "Where deletes are sent, when not to path/{id}. {id} is replaced with the object's id.",
+        Optional:    true,
+      },
+      "page_list_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "For objects whose GET is paginated, the key of the list spread across the pages (such as 'members'). Every page is read and the lists are joined before the object is compared.",
+        Optional:    true,
+      },
+      "page_next_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "With page_list_key, the key holding the URL of the next page. By default the Link header's rel=\"next\" is followed.",
+        Optional:    true,
+      },
+      "read_search": &schema.Schema{
+        Type:        schema.TypeList,
+        MaxItems:    1,
+        Description: "For APIs where the id is not known until the object is searched for: reads list search_path and use the object whose search_key is search_value.",
+        Optional:    true,
+        Elem: &schema.Resource{
+          Schema: map[string]*schema.Schema{
+            "search_path": &schema.Schema{
+              Type:        schema.TypeString,
+              Description: "The path listing the objects to search, such as /users?name={name}. Defaults to path.",
+              Optional:    true,
+            },
+            "search_key": &schema.Schema{
+              Type:        schema.TypeString,
+              Description: "The key (dotted path or JSON pointer) of each listed object compared with search_value.",
+              Required:    true,
+            },
+            "search_value": &schema.Schema{
+              Type:        schema.TypeString,
+              Description: "The value search_key must have. {key} placeholders are replaced from data.",
+              Required:    true,
+            },
+            "results_key": &schema.Schema{
+              Type:        schema.TypeString,
+              Description: "When the list is wrapped in an object, the key holding it.",
+              Optional:    true,
+            },
+          },
+        },
+      },
+      "create_method": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The HTTP method used to create this object, such as PUT. Defaults to the provider's create_method.",
+        Optional:    true,
+      },
+      "read_method": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The HTTP method used to read this object. Defaults to the provider's read_method.",
+        Optional:    true,
+      },
+      "update_method": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The HTTP method used to update this object, such as PATCH. Defaults to the provider's update_method.",
+        Optional:    true,
+      },
+      "destroy_method": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The HTTP method used to delete this object, such as POST. Defaults to the provider's destroy_method.",
+        Optional:    true,
+      },
+      "create_returns_object": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Overrides the provider's create_returns_object for this object: whether the response to the create is the object itself, or it must be read back with a GET.",
+        Optional:    true,
+      },
+      "write_returns_object": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Overrides the provider's write_returns_object for this object: whether responses to creates and updates are the object itself, or it must be read back with a GET (for example, when the API answers 204 or returns stale data).",
+        Optional:    true,
+      },
+      "location_id_pattern": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A regular expression whose first capture group (or whole match) is the new object's id in the Location header of a create response that has no id. By default the last path segment is used. Setting it also allows data without an id when the provider does not read objects from responses.",
+        Optional:    true,
+      },
+      "wait_for_empty": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A path (such as /projects/{id}/items) listed before the object is deleted, until it is empty. For APIs that refuse to delete parents with children.",
+        Optional:    true,
+      },
+      "wait_for_empty_results_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "When the wait_for_empty list is wrapped in an object, the key holding it.",
+        Optional:    true,
+      },
+      "clear_children_path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "With wait_for_empty, a call (such as /projects/{id}/items) made first to have the API delete the children.",
+        Optional:    true,
+      },
+      "clear_children_method": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The HTTP method used with clear_children_path. Default is DELETE.",
+        Optional:    true,
+      },
+      "wait_for": &schema.Schema{
+        Type:        schema.TypeList,
+        MaxItems:    1,
+        Description: "After creates and updates, read the object until a field has one of the given values, such as a status that goes from 'provisioning' to 'ready'.",
+        Optional:    true,
+        Elem: &schema.Resource{
+          Schema: map[string]*schema.Schema{
+            "jsonpath": &schema.Schema{
+              Type:        schema.TypeString,
+              Description: "The field to check: a key, dotted path (or $.status.phase) or JSON pointer.",
+              Required:    true,
+            },
+            "values": &schema.Schema{
+              Type:        schema.TypeList,
+              Elem:        &schema.Schema{ Type: schema.TypeString },
+              Description: "The values that mean the object is ready.",
+              Required:    true,
+            },
+            "timeout": &schema.Schema{
+              Type:        schema.TypeInt,
+              Description: "How long (in seconds) to wait at most. By default only the create or update timeout applies.",
+              Optional:    true,
+            },
+            "interval": &schema.Schema{
+              Type:        schema.TypeInt,
+              Description: "How long (in seconds) to wait between reads. Default is 5.",
+              Optional:    true,
+              Default:     5,
+            },
+          },
+        },
+      },
+      "async_status_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "For APIs that answer creates with 202 and finish them in the background: the key (dotted path or JSON pointer) of the status in the Operation-Location or Location that is polled until it is async_done_value.",
+        Optional:    true,
+      },
+      "async_done_value": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "With async_status_key, the status of a finished create. Default is 'done'.",
+        Optional:    true,
+      },
+      "async_failed_value": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "With async_status_key, the status of a failed create.",
+        Optional:    true,
+      },
+      "async_id_key": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "With async_status_key, the key of the finished operation holding the new object's id. Without it, what is polled is taken to be the object itself.",
+        Optional:    true,
+      },
+      "async_poll_interval": &schema.Schema{
+        Type:        schema.TypeInt,
+        Description: "With async_status_key, the seconds before the first poll. Later polls back off up to 30 seconds apart. Default is 1.",
+        Optional:    true,
+      },
+      "wait_for_deletion": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, a delete only finishes once reading the object answers 404, for APIs that tear objects down in the background. It is read every delete_retry_interval seconds.",
+        Optional:    true,
+      },
+      "wait_for_deletion_timeout": &schema.Schema{
+        Type:        schema.TypeInt,
+        Description: "With wait_for_deletion, how long (in seconds) to wait at most. By default only the delete timeout applies.",
+        Optional:    true,
+      },
+      "update_mode": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "How updates are sent: 'put' sends the whole of data (the default), 'json_patch' sends the RFC 6902 operations that turn the data last applied into the new data, as a PATCH with Content-Type application/json-patch+json, and 'merge_patch' sends just what changed as an RFC 7386 merge patch (application/merge-patch+json).",
+        Optional:    true,
+        Default:     "put",
+      },
+      "partial_update": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, updates send only the top level keys of data that changed since the last apply (null for removed keys) instead of the whole object.",
+        Optional:    true,
+      },
+      "conflict_retries": &schema.Schema{
+        Type:        schema.TypeInt,
+        Description: "How many times an update answered with 409 is retried after reading the object again (so copy_keys picks up the new revision). Never done with if_match or version_field set.",
+        Optional:    true,
+      },
+      "serialize_writes": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, creates, updates and deletes of objects under the same path are made one at a time, for APIs that fail when siblings are changed concurrently.",
+        Optional:    true,
+      },
+      "timeout": &schema.Schema{
+        Type:        schema.TypeInt,
+        Description: "When set, each request for this object is aborted after this many seconds instead of the provider's timeout.",
+        Optional:    true,
+      },
+      "skip_exists_check": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "When set, the separate existence check before each refresh is skipped and the read alone decides whether the object still exists. This halves refresh traffic for APIs with expensive or rate-limited reads.",
+        Optional:    true,
+      },
+      "ignore_keys": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Keys (dotted paths or JSON pointers) the server sets on its own, such as timestamps, etags or links, that are left out of api_data and api_response so refreshes do not report them as changed. They are not sent when data has them, and data only differing in them is not a change.",
+        Optional:    true,
+      },
+      "drift_detection": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "How refreshes look for changes made outside of terraform: 'none' (the default) only updates api_data, 'managed_keys' compares the keys in data with what the server has and 'full' also counts keys the server added. The server's values for what differs are put in data so the plan shows an update to put them back.",
+        Optional:    true,
+        Default:     "none",
+      },
+      "force_new": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "Top level keys of data the API does not allow to change. When any of them changes, the object is destroyed and created again instead of updated.",
+        Optional:    true,
+      },
+      "refresh": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "'always' (the default) or 'never'. Objects set to never are not read from the API during refresh unless the provider's skip_refresh is none, so huge states against slow APIs plan quickly.",
+        Optional:    true,
+        Default:     "always",
+      },
+      "etag": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The ETag the API sent with the object when it was last read or written.",
+        Computed:    true,
+      },
+      "api_response": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The object as the API last returned it, as JSON. Empty when it is bigger than the provider's max_api_data_size.",
+        Computed:    true,
+      },
+      "last_operation": &schema.Schema{
+        Type:        schema.TypeMap,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "The last create or update request made for the object during an apply: operation, method, path, status_code, timestamp (RFC 3339), duration_ms and request_id (see the provider's request_id_header).",
+        Computed:    true,
+      },
+      "api_data_truncated": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Set when the values in api_data were truncated because they exceeded the provider's max_api_data_size.",
+        Computed:    true,
+      },
     }, /* End schema */
 
   }
@@ -56,37 +487,303 @@ func resourceRestApi() *schema.Resource {
 /* Simple helper routine to build an api_object struct
    for the various calls terraform will use. Unfortunately,
    terraform cannot just reuse objects, so each CRUD operation
-   results in a new object created */
-func make_api_object(d *schema.ResourceData, m interface{}) (*api_object, error) {
-  log.Printf("resource_api_object.go: make_api_object routine called for id '%s'\n", d.Id())
-  obj, err := NewAPIObject (
-    m.(*api_client),
-    d.Get("path").(string),
-    d.Id(),
-    d.Get("data").(string),
-    d.Get("debug").(bool),
-    d.Get("ext").(string),
-  )
+   results in a new object created. Requests for the object
+   are abandoned once ctx is done */
+func make_api_object(ctx context.Context, d *schema.ResourceData, m interface{}) (*APIObject, error) {
+  log_debug("resource_api_object.go", "make_api_object routine called", "id", d.Id())
+
+  data, err := resource_data(d.Get("data"), d.Get("data_overlays"))
+  if err != nil { return nil, err }
+
+  /* What was sent last time, for update_mode = json_patch to diff with */
+  old_data := ""
+  if d.Id() != "" {
+    old_raw, _ := d.GetChange("data")
+    old_overlays, _ := d.GetChange("data_overlays")
+    if old_data, err = resource_data(old_raw, old_overlays); err != nil { return nil, err }
+  }
+
+  /* When data changes, etag and version are planned as unknown (see
+     resourceRestApiCustomizeDiff). The update still needs the ones
+     from the last read, which only the old side has */
+  etag, _ := d.GetChange("etag")
+  version, _ := d.GetChange("version")
+
+  null_policy := make(map[string]string)
+  for k, v := range d.Get("null_policy").(map[string]interface{}) { null_policy[k] = v.(string) }
+
+  /* Unset means the provider's setting, so false must be told apart */
+  var create_returns_object, write_returns_object *bool
+  if v, ok := d.GetOkExists("create_returns_object"); ok {
+    b := v.(bool)
+    create_returns_object = &b
+  }
+  if v, ok := d.GetOkExists("write_returns_object"); ok {
+    b := v.(bool)
+    write_returns_object = &b
+  }
+
+  search := make(map[string]interface{})
+  if blocks := d.Get("read_search").([]interface{}); len(blocks) > 0 && blocks[0] != nil {
+    search = blocks[0].(map[string]interface{})
+  }
+  search_path, _ := search["search_path"].(string)
+  search_key, _ := search["search_key"].(string)
+  search_value, _ := search["search_value"].(string)
+  search_results_key, _ := search["results_key"].(string)
+
+  wait_for := make(map[string]interface{})
+  if blocks := d.Get("wait_for").([]interface{}); len(blocks) > 0 && blocks[0] != nil {
+    wait_for = blocks[0].(map[string]interface{})
+  }
+  wait_for_key, _ := wait_for["jsonpath"].(string)
+  wait_for_values := make([]string, 0)
+  if values, ok := wait_for["values"].([]interface{}); ok {
+    for _, v := range values { wait_for_values = append(wait_for_values, fmt.Sprintf("%v", v)) }
+  }
+  wait_for_timeout, _ := wait_for["timeout"].(int)
+  wait_for_interval, _ := wait_for["interval"].(int)
+
+  ignore_keys := string_list(d.Get("ignore_keys"))
+  id_fields := make([]string, 0)
+  for _, v := range d.Get("id_fields").([]interface{}) { id_fields = append(id_fields, v.(string)) }
+
+  obj, err := NewAPIObject (m.(*APIClient), &APIObjectOpt{
+    Path:  d.Get("path").(string),
+    ID:    d.Id(),
+    IDAttribute: d.Get("id_attribute").(string),
+    CreateIDAttribute: d.Get("create_id_attribute").(string),
+    IDStrategy: d.Get("id_strategy").(string),
+    IDField: d.Get("id_field").(string),
+    IDFields: id_fields,
+    IDTemplate: d.Get("id_template").(string),
+    ReadIDAttribute: d.Get("read_id_attribute").(string),
+    LocationIDPattern: d.Get("location_id_pattern").(string),
+    CreateReturnsObject: create_returns_object,
+    CreatePath: d.Get("create_path").(string),
+    ReadPath: d.Get("read_path").(string),
+    UpdatePath: d.Get("update_path").(string),
+    DestroyPath: d.Get("destroy_path").(string),
+    SearchPath: search_path,
+    SearchKey: search_key,
+    SearchValue: search_value,
+    SearchResultsKey: search_results_key,
+    PageListKey: d.Get("page_list_key").(string),
+    PageNextKey: d.Get("page_next_key").(string),
+    CreateMethod: d.Get("create_method").(string),
+    ReadMethod: d.Get("read_method").(string),
+    UpdateMethod: d.Get("update_method").(string),
+    DestroyMethod: d.Get("destroy_method").(string),
+    WriteReturnsObject: write_returns_object,
+    Data:  data,
+    Debug: d.Get("debug").(bool),
+    Ext:   d.Get("ext").(string),
+    QueryString: string_map(d.Get("query_string")),
+    CreateQueryString: string_map(d.Get("create_query_string")),
+    ReadQueryString: string_map(d.Get("read_query_string")),
+    UpdateQueryString: string_map(d.Get("update_query_string")),
+    DestroyQueryString: string_map(d.Get("destroy_query_string")),
+    CreateSuccessCodes: int_list(d.Get("create_success_codes")),
+    ReadSuccessCodes: int_list(d.Get("read_success_codes")),
+    UpdateSuccessCodes: int_list(d.Get("update_success_codes")),
+    DestroySuccessCodes: int_list(d.Get("destroy_success_codes")),
+    IdempotencyHeader: d.Get("idempotency_header").(string),
+    IdempotencyKey: d.Get("idempotency_key").(string),
+    Timeout: d.Get("timeout").(int),
+    SerializeWrites: d.Get("serialize_writes").(bool),
+    ConflictRetries: d.Get("conflict_retries").(int),
+    UpdateMode: d.Get("update_mode").(string),
+    UpdateData: d.Get("update_data").(string),
+    PartialUpdate: d.Get("partial_update").(bool),
+    DestroyData: d.Get("destroy_data").(string),
+    WaitForEmpty: d.Get("wait_for_empty").(string),
+    WaitForEmptyKey: d.Get("wait_for_empty_results_key").(string),
+    ClearChildrenPath: d.Get("clear_children_path").(string),
+    ClearChildrenMethod: d.Get("clear_children_method").(string),
+    WaitForDeletion: d.Get("wait_for_deletion").(bool),
+    WaitForDeletionTimeout: d.Get("wait_for_deletion_timeout").(int),
+    AsyncStatusKey: d.Get("async_status_key").(string),
+    AsyncDoneValue: d.Get("async_done_value").(string),
+    AsyncFailedValue: d.Get("async_failed_value").(string),
+    AsyncIDKey: d.Get("async_id_key").(string),
+    AsyncPollInterval: d.Get("async_poll_interval").(int),
+    WaitForKey: wait_for_key,
+    WaitForValues: wait_for_values,
+    WaitForTimeout: wait_for_timeout,
+    WaitForInterval: wait_for_interval,
+    OldData: old_data,
+    NullPolicy: null_policy,
+    Coerce: string_map(d.Get("coerce")),
+    ETag: etag.(string),
+    IfMatch: d.Get("if_match").(bool),
+    VersionField: d.Get("version_field").(string),
+    IgnoreKeys: ignore_keys,
+    DriftDetection: d.Get("drift_detection").(string),
+    Version: version.(string),
+    NameField: d.Get("name_field").(string),
+    NameTemplate: d.Get("name_template").(string),
+    Context: ctx,
+  })
   return obj, err
 }
 
+/* Whether to trust the state instead of reading the object. The
+   provider's skip_refresh decides what refresh = "never" means */
+func refresh_skipped(d *schema.ResourceData, meta interface{}) (bool, error) {
+  refresh, _ := d.Get("refresh").(string)
+  if refresh != "" && refresh != "always" && refresh != "never" {
+    return false, fmt.Errorf("Invalid refresh '%s': must be always or never", refresh)
+  }
+
+  skip := false
+  switch meta.(*APIClient).skip_refresh {
+  case "all":
+    skip = true
+  case "tagged":
+    skip = refresh == "never"
+  }
+  /* Without an id there is nothing in the state to trust */
+  if skip && d.Id() != "" {
+    log_debug("resource_api_object.go", "Skipping refresh", "id", d.Id(), "refresh", refresh)
+    return true, nil
+  }
+  return false, nil
+}
+
+/* data with data_overlays applied */
+func resource_data(data interface{}, overlays interface{}) (string, error) {
+  s, _ := data.(string)
+  raw, _ := overlays.([]interface{})
+  if len(raw) == 0 { return s, nil }
+
+  composed := make([]string, len(raw))
+  for i, v := range raw { composed[i] = v.(string) }
+  return compose_overlays(s, composed)
+}
+
+/* Immutable fields can only be changed by replacing the object.
+   Until data is known, there is nothing to compare yet */
+func force_new_keys(d *schema.ResourceDiff) error {
+  keys, _ := d.Get("force_new").([]interface{})
+  if len(keys) == 0 || !d.NewValueKnown("data") || !d.NewValueKnown("data_overlays") { return nil }
+  if !d.HasChange("data") && !d.HasChange("data_overlays") { return nil }
+
+  old_raw, new_raw := d.GetChange("data")
+  old_overlays, new_overlays := d.GetChange("data_overlays")
+  old_data, err := resource_data(old_raw, old_overlays)
+  if err != nil { return err }
+  new_data, err := resource_data(new_raw, new_overlays)
+  if err != nil { return err }
+
+  var old_object, new_object map[string]interface{}
+  if err := json.Unmarshal([]byte(old_data), &old_object); err != nil { return nil }
+  if err := json.Unmarshal([]byte(new_data), &new_object); err != nil { return err }
+  for _, key := range keys {
+    k, _ := key.(string)
+    if reflect.DeepEqual(old_object[k], new_object[k]) { continue }
+    log_info("resource_api_object.go", "Key in force_new changed. The object will be replaced", "id", d.Id(), "key", k)
+    /* ForceNew refuses attributes that did not change, and the
+       key may have changed through data_overlays alone */
+    if d.HasChange("data") { return d.ForceNew("data") }
+    return d.ForceNew("data_overlays")
+  }
+  return nil
+}
+
+/* TypeMap values of strings come back as map[string]interface{} */
+func string_map(v interface{}) map[string]string {
+  out := make(map[string]string)
+  m, _ := v.(map[string]interface{})
+  for k, v := range m { out[k] = v.(string) }
+  return out
+}
+
+func string_list(v interface{}) []string {
+  out := make([]string, 0)
+  l, _ := v.([]interface{})
+  for _, v := range l { out = append(out, v.(string)) }
+  return out
+}
+
+func int_list(v interface{}) []int {
+  out := make([]int, 0)
+  l, _ := v.([]interface{})
+  for _, v := range l { out = append(out, v.(int)) }
+  return out
+}
+
 /* After any operation that returns API data, we'll stuff
    all the k,v pairs into the api_data map so users can
-   consume the values elsewhere if they'd like */
-func set_resource_state(obj *api_object, d *schema.ResourceData) {
+   consume the values elsewhere if they'd like. Objects with
+   huge values would bloat the state, so once the provider's
+   max_api_data_size is used up the rest is truncated */
+func set_resource_state(obj *APIObject, d *schema.ResourceData) {
+  max_size := obj.api_client.max_api_data_size
+  truncated := false
+  used := 0
+
+  /* Sort so the same keys get truncated on every run */
+  keys := make([]string, 0, len(obj.api_data))
+  for k := range obj.api_data { keys = append(keys, k) }
+  sort.Strings(keys)
+
   api_data := make(map[string]string)
-  for k, v := range obj.api_data {
-    api_data[k] = fmt.Sprintf("%v", v)
+  for _, k := range keys {
+    v := fmt.Sprintf("%v", obj.api_data[k])
+    if max_size > 0 && used + len(v) > max_size {
+      remaining := max_size - used
+      if remaining < 0 { remaining = 0 }
+      /* Never in the middle of a multi-byte character */
+      for remaining > 0 && !utf8.RuneStart(v[remaining]) { remaining-- }
+      v = v[:remaining] + "...(truncated)"
+      truncated = true
+    }
+    used += len(v)
+    api_data[k] = v
+  }
+
+  /* As JSON, for restapi_extract and jsondecode(). Cutting it short
+     would make it invalid, so an oversized one is left out */
+  api_response := ""
+  if b, err := json.Marshal(obj.api_data); err == nil {
+    if max_size > 0 && len(b) > max_size {
+      truncated = true
+    } else {
+      api_response = string(b)
+    }
+  }
+
+  if truncated {
+    log_warn("resource_api_object.go", "api_data exceeded max_api_data_size and was truncated", "id", obj.id, "max_api_data_size", max_size)
   }
   d.Set("api_data", api_data)
+  d.Set("api_response", api_response)
+  d.Set("api_data_truncated", truncated)
+  d.Set("etag", obj.etag)
+  d.Set("version", obj.version)
 }
 
 
+/* Kept through refreshes, so the state says what the last apply that
+   touched the object did. Updates that had nothing to send keep the
+   one from before, which the plan had as unknown */
+func set_last_operation(obj *APIObject, d *schema.ResourceData) {
+  last := obj.LastOperation()
+  if last == nil {
+    old, _ := d.GetChange("last_operation")
+    d.Set("last_operation", old)
+    return
+  }
+  d.Set("last_operation", last)
+}
+
 /* Since there is nothing in the ResourceData structure other
    than the "id" passed on the command line, we have to use an opinionated
    view of the API paths to figure out how to read that object
-   from the API */
+   from the API. Everything is then filled in from what the API
+   has, so terraform plan -generate-config-out writes usable config */
 func resourceRestApiImport(d *schema.ResourceData, meta interface{}) (imported []*schema.ResourceData, err error) {
+  client := meta.(*APIClient)
   input := d.Id()
   n := strings.LastIndex(input, "/")
   if n == -1 { return imported, errors.New("Invalid path to import api_object. Must be /<full path from server root>/<object id><ext>") }
@@ -94,20 +791,38 @@ func resourceRestApiImport(d *schema.ResourceData, meta interface{}) (imported [
   path := input[0:n]
   d.Set("path", path)
 
+  /* What has a default would otherwise be planned as a change to it */
+  for k, s := range resourceRestApi().Schema {
+    if s.Default != nil { d.Set(k, s.Default) }
+  }
+
   id := input[n+1:len(input)]
-  d.Set("data", fmt.Sprintf(`{ "id": "%s" }`, id))
+  b, err := json.Marshal(map[string]string{ client.id_attribute: id })
+  if err != nil { return imported, err }
+  d.Set("data", string(b))
   d.SetId(id)
 
-  /* Troubleshooting is hard enough. Emit log messages so TF_LOG
-     has useful information in case an import isn't working */
-  d.Set("debug", true)
-
-  obj, err := make_api_object(d, meta)
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+  defer cancel()
+  obj, err := make_api_object(ctx, d, meta)
   if err != nil { return imported, err }
-  log.Printf("resource_api_object.go: Import routine called. Object built:\n%s\n", obj.toString())
 
-  err = obj.read_object()
+  /* Troubleshooting is hard enough. Emit log messages so TF_LOG
+     has useful information in case an import isn't working. This
+     is not kept in the state, or generated config would have it */
+  obj.debug = true
+  log_info("resource_api_object.go", "Import routine called. Object built:\n" + obj.describe())
+
+  err = obj.ReadObject()
   if err == nil {
+    /* The object as the API has it becomes what is managed, but for
+       the id, which is already in the path */
+    b, err := client.encode_json(without_keys(obj.api_data, []string{ obj.id_attribute }), nil)
+    if err != nil { return imported, err }
+    d.Set("data", string(b))
+    /* Nothing has been written yet */
+    d.Set("last_operation", map[string]string{})
+
     set_resource_state(obj, d)
     /* Data that we set in the state above must be passed along
        as an item in the stack of imported data */
@@ -117,64 +832,144 @@ func resourceRestApiImport(d *schema.ResourceData, meta interface{}) (imported [
   return imported, err
 }
 
+/* data filled in on import is the whole object, keys the server
+   manages included. Those in ignore_keys are not a difference */
+func suppress_ignored_keys(k, old, new string, d *schema.ResourceData) bool {
+  return only_ignored_keys_differ(old, new, string_list(d.Get("ignore_keys")))
+}
+
+/* Whether old and new data are the same once keys are left out */
+func only_ignored_keys_differ(old string, new string, keys []string) bool {
+  if len(keys) == 0 || old == "" || new == "" { return false }
+
+  var old_data, new_data map[string]interface{}
+  if json.Unmarshal([]byte(old), &old_data) != nil || json.Unmarshal([]byte(new), &new_data) != nil { return false }
+  return reflect.DeepEqual(without_keys(old_data, keys), without_keys(new_data, keys))
+}
+
+/* What the API will say about the object is only known after apply.
+   When data changes - or depends on resources that do not exist yet -
+   the outputs from the last read are stale, so plan them as unknown
+   rather than let other resources plan against the old values */
+func resourceRestApiCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+  if d.Id() == "" { return nil }
+  if err := force_new_keys(d); err != nil { return err }
+
+  stale := false
+  for _, k := range []string{ "data", "data_overlays", "null_policy", "coerce", "name_template" } {
+    if !d.NewValueKnown(k) { stale = true }
+    if !d.HasChange(k) { continue }
+    /* As in the plan, data only differing in ignore_keys is no change */
+    if old, new := d.GetChange(k); k == "data" && only_ignored_keys_differ(old.(string), new.(string), string_list(d.Get("ignore_keys"))) { continue }
+    stale = true
+  }
+  if !stale { return nil }
+
+  for _, k := range []string{ "api_data", "api_response", "api_data_truncated", "etag", "version", "last_operation" } {
+    if err := d.SetNewComputed(k); err != nil { return err }
+  }
+  return nil
+}
+
 func resourceRestApiCreate(d *schema.ResourceData, meta interface{}) error {
-  obj, err := make_api_object(d, meta)
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+  defer cancel()
+  obj, err := make_api_object(ctx, d, meta)
   if err != nil { return err }
-  log.Printf("resource_api_object.go: Create routine called. Object built:\n%s\n", obj.toString())
+  log_info("resource_api_object.go", "Create routine called. Object built:\n" + obj.describe())
 
-  err = obj.create_object()
+  err = obj.CreateObject()
   if err == nil {
     /* Setting terraform ID tells terraform the object was created or it exists */
     d.SetId(obj.id)
+    d.Set("idempotency_key", obj.IdempotencyKey())
+    set_last_operation(obj, d)
+    /* Still tracked (and tainted) when it never becomes ready */
+    err = obj.WaitForValues()
     set_resource_state(obj, d)
   }
   return err
 }
 
 func resourceRestApiRead(d *schema.ResourceData, meta interface{}) error {
-  obj, err := make_api_object(d, meta)
+  if skip, err := refresh_skipped(d, meta); skip || err != nil { return err }
+
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+  defer cancel()
+  obj, err := make_api_object(ctx, d, meta)
   if err != nil { return err }
-  log.Printf("resource_api_object.go: Read routine called. Object built:\n%s\n", obj.toString())
+  log_info("resource_api_object.go", "Read routine called. Object built:\n" + obj.describe())
 
-  err = obj.read_object()
+  err = obj.RefreshObject()
+  var api_err *APIError
+  if errors.As(err, &api_err) && api_err.StatusCode == 404 {
+    /* Normally Exists catches this first, but not when it is skipped */
+    log_warn("resource_api_object.go", "Object no longer exists. Removing it from the state", "id", obj.id)
+    d.SetId("")
+    return nil
+  }
+  if err == nil && obj.NotModified() {
+    /* What is in the state is still what the API has */
+    log_debug("resource_api_object.go", "Object not modified since the last read", "id", obj.id)
+    return nil
+  }
   if err == nil {
     /* Setting terraform ID tells terraform the object was created or it exists */
-    log.Printf("resource_api_object.go: Read resource. Returned id is '%s'\n", obj.id);
+    log_debug("resource_api_object.go", "Read resource", "id", obj.id)
     d.SetId(obj.id)
     set_resource_state(obj, d)
+    set_drift(obj, d)
   }
   return err
 }
 
+/* data in the state is what the server has, so it differs from the
+   configuration and the plan shows the update that fixes it */
+func set_drift(obj *APIObject, d *schema.ResourceData) {
+  keys, data := obj.drift()
+  if len(keys) == 0 { return }
+  b, err := json.Marshal(data)
+  if err != nil { return }
+  log_warn("resource_api_object.go", "Object drifted from its configuration", "id", obj.id, "keys", strings.Join(keys, ", "))
+  d.Set("data", string(b))
+}
+
 func resourceRestApiUpdate(d *schema.ResourceData, meta interface{}) error {
-  obj, err := make_api_object(d, meta)
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+  defer cancel()
+  obj, err := make_api_object(ctx, d, meta)
   if err != nil { return err }
 
   /* If copy_keys is not empty, we have to grab the latest 
      data so we can copy anything needed before the update */
-  client := meta.(*api_client)
+  client := meta.(*APIClient)
   if len(client.copy_keys) > 0 {
-    err = obj.read_object()
+    err = obj.ReadObject()
     if err != nil { return err }
   }
 
-  log.Printf("resource_api_object.go: Update routine called. Object built:\n%s\n", obj.toString())
+  log_info("resource_api_object.go", "Update routine called. Object built:\n" + obj.describe())
 
-  err = obj.update_object()
+  err = obj.UpdateObject()
   if err == nil {
+    set_last_operation(obj, d)
+    err = obj.WaitForValues()
     set_resource_state(obj, d)
   }
   return err
 }
 
 func resourceRestApiDelete(d *schema.ResourceData, meta interface{}) error {
-  obj, err := make_api_object(d, meta)
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+  defer cancel()
+  obj, err := make_api_object(ctx, d, meta)
   if err != nil { return err }
-  log.Printf("resource_api_object.go: Delete routine called. Object built:\n%s\n", obj.toString())
+  log_info("resource_api_object.go", "Delete routine called. Object built:\n" + obj.describe())
 
-  err = obj.delete_object()
+  err = obj.DeleteObject()
   if err != nil {
-    if strings.Contains(err.Error(), "404") {
+    var api_err *APIError
+    if errors.As(err, &api_err) && api_err.StatusCode == 404 {
       /* 404 means it doesn't exist. Call that good enough */
       err = nil
     }
@@ -183,16 +978,32 @@ func resourceRestApiDelete(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceRestApiExists(d *schema.ResourceData, meta interface{}) (b bool, e error) {
+  if skip, err := refresh_skipped(d, meta); skip || err != nil { return err == nil, err }
+
+  /* Read will find out soon enough - see resourceRestApiRead */
+  if meta.(*APIClient).skip_exists_check || d.Get("skip_exists_check").(bool) {
+    log_debug("resource_api_object.go", "Skipping exists check", "id", d.Id())
+    return true, nil
+  }
+
   exists := false
-  obj, err := make_api_object(d, meta)
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+  defer cancel()
+  obj, err := make_api_object(ctx, d, meta)
   if err != nil { return false, err }
-  log.Printf("resource_api_object.go: Exists routine called. Object built: %s\n", obj.toString())
+  log_info("resource_api_object.go", "Exists routine called. Object built:\n" + obj.describe())
 
-  err = obj.read_object()
-  /* Assume all errors indicate the object just doesn't exist.
-     This may not be a good assumption... */
+  err = obj.ReadObject()
   if err == nil {
     exists = true
   }
+  /* Only the API saying so means the object is gone. Being refused, a
+     5xx, a timeout or an open circuit breaker says nothing about whether
+     it is there, and calling it missing would have terraform create it
+     all over again */
+  var api_err *APIError
+  if err != nil && !(errors.As(err, &api_err) && api_err.IsNotFound()) {
+    return false, err
+  }
   return exists, nil
 }
@@ -0,0 +1,350 @@
+package restapi
+
+import (
+  "github.com/TrurlMcByte/terraform-provider-restapi/fakeserver"
+  "github.com/hashicorp/terraform/config"
+  "github.com/hashicorp/terraform/helper/schema"
+  "github.com/hashicorp/terraform/terraform"
+  "bytes"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "unicode/utf8"
+)
+
+/* Plans raw against state, as terraform does, so CustomizeDiff
+   and computed attributes are part of it */
+func plan_resource(t *testing.T, r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) (*terraform.InstanceDiff, error) {
+  t.Helper()
+  c, err := config.NewRawConfig(raw)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  return r.Diff(state, terraform.NewResourceConfig(c), meta)
+}
+
+/* Plans raw against state and applies the plan */
+func apply_resource(t *testing.T, r *schema.Resource, state *terraform.InstanceState, raw map[string]interface{}, meta interface{}) (*terraform.InstanceState, error) {
+  t.Helper()
+  diff, err := plan_resource(t, r, state, raw, meta)
+  if err != nil { return nil, err }
+  if diff == nil { return state, nil }
+  return r.Apply(state, diff, meta)
+}
+
+func TestUpdateSendsLastETagAndVersion(t *testing.T) {
+  if_match := ""
+  var body map[string]interface{}
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "PUT" {
+      if_match = r.Header.Get("If-Match")
+      json.NewDecoder(r.Body).Decode(&body)
+    }
+    w.Header().Set("ETag", `"2"`)
+    w.Write([]byte(`{"id":"1","name":"new","rev":2}`))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id", WriteReturnsObject: true })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+
+  state := &terraform.InstanceState{
+    ID: "1",
+    Attributes: map[string]string{
+      "id": "1",
+      "path": "/things",
+      "data": `{"id":"1","name":"old"}`,
+      "if_match": "true",
+      "version_field": "rev",
+      "etag": `"1"`,
+      "version": "1",
+    },
+  }
+  /* The change to data plans etag and version as unknown */
+  state, err = apply_resource(t, resourceRestApi(), state, map[string]interface{}{
+    "path": "/things",
+    "data": `{"id":"1","name":"new"}`,
+    "if_match": true,
+    "version_field": "rev",
+  }, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+
+  if if_match != `"1"` { t.Fatalf("resource_api_object_test.go: Expected If-Match \"1\" but got '%s'", if_match) }
+  if body["rev"] != float64(1) { t.Fatalf("resource_api_object_test.go: Expected the version 1 in the update but got %v", body) }
+  if state.Attributes["etag"] != `"2"` { t.Fatalf("resource_api_object_test.go: Expected the new etag in the state but got '%s'", state.Attributes["etag"]) }
+}
+
+func TestForceNew(t *testing.T) {
+  state := &terraform.InstanceState{
+    ID: "1",
+    Attributes: map[string]string{
+      "id": "1",
+      "path": "/things",
+      "data": `{"id":"1","name":"web","region":"us"}`,
+      "data_overlays.#": "1",
+      "data_overlays.0": `{"size":"small"}`,
+      "force_new.#": "1",
+      "force_new.0": "region",
+    },
+  }
+
+  for name, test := range map[string]struct{ data string; overlay string; replace bool }{
+    "data changed the key": { `{"id":"1","name":"web","region":"eu"}`, `{"size":"small"}`, true },
+    "data_overlays changed the key": { `{"id":"1","name":"web","region":"us"}`, `{"region":"eu"}`, true },
+    "another key changed": { `{"id":"1","name":"db","region":"us"}`, `{"size":"large"}`, false },
+  } {
+    diff, err := plan_resource(t, resourceRestApi(), state, map[string]interface{}{
+      "path": "/things",
+      "data": test.data,
+      "data_overlays": []interface{}{ test.overlay },
+      "force_new": []interface{}{ "region" },
+    }, nil)
+    if err != nil { t.Fatalf("resource_api_object_test.go: %s: %s", name, err) }
+    if diff.RequiresNew() != test.replace { t.Fatalf("resource_api_object_test.go: %s: Expected replacement to be %t", name, test.replace) }
+  }
+}
+
+func TestTruncateAPIData(t *testing.T) {
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8080", MaxAPIDataSize: 2 })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  obj := &APIObject{ api_client: client, api_data: map[string]interface{}{ "name": "héllo" } }
+
+  d := resourceRestApi().TestResourceData()
+  set_resource_state(obj, d)
+  name := d.Get("api_data").(map[string]interface{})["name"].(string)
+  if !utf8.ValidString(name) { t.Fatalf("resource_api_object_test.go: Truncating made invalid UTF-8 of %q", name) }
+  if name != "h...(truncated)" { t.Fatalf("resource_api_object_test.go: Expected 'h...(truncated)' but got '%s'", name) }
+  if !d.Get("api_data_truncated").(bool) { t.Fatalf("resource_api_object_test.go: api_data_truncated was not set") }
+}
+
+func TestAPIResponse(t *testing.T) {
+  api_data := map[string]interface{}{ "id": "1", "spec": map[string]interface{}{ "replicas": 3.0 } }
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8080" })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  d := resourceRestApi().TestResourceData()
+  set_resource_state(&APIObject{ api_client: client, api_data: api_data }, d)
+  if res := d.Get("api_response").(string); res != `{"id":"1","spec":{"replicas":3}}` { t.Fatalf("resource_api_object_test.go: Unexpected api_response '%s'", res) }
+
+  /* Cut short it would not be JSON, so it is left out */
+  client.max_api_data_size = 20
+  d = resourceRestApi().TestResourceData()
+  set_resource_state(&APIObject{ api_client: client, api_data: api_data }, d)
+  if res := d.Get("api_response").(string); res != "" { t.Fatalf("resource_api_object_test.go: api_response over max_api_data_size was set to '%s'", res) }
+  if !d.Get("api_data_truncated").(bool) { t.Fatalf("resource_api_object_test.go: api_data_truncated was not set") }
+}
+
+func TestRefreshSkipped(t *testing.T) {
+  requests := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    requests++
+    w.Write([]byte(`{"id":"1","name":"web"}`))
+  }))
+  defer server.Close()
+
+  for _, test := range []struct{ skip_refresh string; refresh string; reads bool }{
+    { "tagged", "never", false },
+    { "all", "never", false },
+    { "all", "always", false },
+    { "tagged", "always", true },
+    { "none", "never", true },
+  } {
+    client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id", SkipRefresh: test.skip_refresh })
+    if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+    state := &terraform.InstanceState{
+      ID: "1",
+      Attributes: map[string]string{ "id": "1", "path": "/things", "data": `{"id":"1","name":"web"}`, "refresh": test.refresh },
+    }
+
+    requests = 0
+    refreshed, err := resourceRestApi().Refresh(state, client)
+    if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+    if refreshed == nil || refreshed.ID != "1" { t.Fatalf("resource_api_object_test.go: The object left the state with skip_refresh %s and refresh %s", test.skip_refresh, test.refresh) }
+    if (requests > 0) != test.reads { t.Fatalf("resource_api_object_test.go: Expected reads to be %t with skip_refresh %s and refresh %s but %d requests were made", test.reads, test.skip_refresh, test.refresh, requests) }
+  }
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id" })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  state := &terraform.InstanceState{ ID: "1", Attributes: map[string]string{ "id": "1", "path": "/things", "data": "{}", "refresh": "sometimes" } }
+  if _, err := resourceRestApi().Refresh(state, client); err == nil { t.Fatalf("resource_api_object_test.go: Invalid refresh was accepted") }
+}
+
+func TestLastOperation(t *testing.T) {
+  methods := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    methods = append(methods, r.Method + " " + r.URL.Path)
+    w.Write([]byte(`{"id":"1","name":"web"}`))
+  }))
+  defer server.Close()
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id" })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+
+  /* The read that follows the create is a POST too, but not a write */
+  config := map[string]interface{}{
+    "path": "/things",
+    "data": `{"id":"1","name":"web"}`,
+    "read_method": "POST",
+    "update_mode": "merge_patch",
+  }
+  state, err := apply_resource(t, resourceRestApi(), nil, config, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  if state.Attributes["last_operation.operation"] != "create" || state.Attributes["last_operation.path"] != "/things" {
+    t.Fatalf("resource_api_object_test.go: Unexpected last_operation after create %v (requests %v)", state.Attributes, methods)
+  }
+  timestamp := state.Attributes["last_operation.timestamp"]
+
+  /* A patch with nothing in it is not sent, and the create is still the last operation */
+  config["null_policy"] = map[string]interface{}{ "*": "omit" }
+  methods = methods[:0]
+  state, err = apply_resource(t, resourceRestApi(), state, config, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  for _, m := range methods {
+    if strings.HasPrefix(m, "PATCH") { t.Fatalf("resource_api_object_test.go: An empty patch was sent") }
+  }
+  if state.Attributes["last_operation.operation"] != "create" || state.Attributes["last_operation.timestamp"] != timestamp {
+    t.Fatalf("resource_api_object_test.go: last_operation was not kept through an update that sent nothing %v", state.Attributes)
+  }
+}
+
+func TestExistsErrors(t *testing.T) {
+  status := 200
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(status)
+    w.Write([]byte(`{"id":"1","name":"web"}`))
+  }))
+  defer server.Close()
+  state := &terraform.InstanceState{ ID: "1", Attributes: map[string]string{ "id": "1", "path": "/things", "data": `{"id":"1","name":"web"}` } }
+
+  for _, test := range []struct{ status int; gone bool }{
+    { 404, true },
+    { 410, true },
+    { 500, false },
+    { 503, false },
+  } {
+    status = test.status
+    client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id" })
+    if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+    refreshed, err := resourceRestApi().Refresh(state, client)
+    if test.gone && (err != nil || refreshed != nil) { t.Fatalf("resource_api_object_test.go: Expected a %d to remove the object but got %v, %v", test.status, refreshed, err) }
+    if !test.gone && err == nil { t.Fatalf("resource_api_object_test.go: A %d made the object look deleted", test.status) }
+  }
+
+  /* Once the breaker is open nothing is asked, so nothing is known */
+  status = 500
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id", CircuitBreakerThreshold: 1 })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  client.SendRequest("GET", "/things/2", "")
+  status = 200
+  _, err = resourceRestApi().Refresh(state, client)
+  if err == nil || !strings.Contains(err.Error(), "Circuit breaker is open") { t.Fatalf("resource_api_object_test.go: Expected the open breaker to fail the refresh but got %v", err) }
+}
+
+func TestReadMethodIsARead(t *testing.T) {
+  methods := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    methods = append(methods, r.Method + " " + r.URL.Path)
+    w.Write([]byte(`{"id":"1","name":"web"}`))
+  }))
+  defer server.Close()
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id", ReadMethod: "POST", ReadOnly: true, CacheTTL: 60 })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  state := &terraform.InstanceState{ ID: "1", Attributes: map[string]string{ "id": "1", "path": "/things", "data": `{"id":"1","name":"web"}` } }
+  refreshed, err := resourceRestApi().Refresh(state, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: read_only refused a read by POST: %s", err) }
+  if refreshed == nil || refreshed.Attributes["api_data.name"] != "web" { t.Fatalf("resource_api_object_test.go: Unexpected state after refresh %v", refreshed) }
+
+  /* Reads leave the cache alone */
+  client.response_cache.put("/other", &api_response{ status: 200, body: "{}" }, client.response_cache.current())
+  if _, err := resourceRestApi().Refresh(state, client); err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  if client.response_cache.get("/other") == nil { t.Fatalf("resource_api_object_test.go: A read by POST emptied the response cache") }
+
+  /* Polls read the same way */
+  obj, err := NewAPIObject(client, &APIObjectOpt{ Path: "/things", ID: "1", Data: `{"id":"1"}` })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  methods = methods[:0]
+  if _, err := obj.poll("/things/1"); err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  if len(methods) != 1 || methods[0] != "POST /things/1" { t.Fatalf("resource_api_object_test.go: Expected the poll to POST but it sent %v", methods) }
+
+  /* Writes are still refused, whatever their method */
+  if _, err := apply_resource(t, resourceRestApi(), nil, map[string]interface{}{ "path": "/things", "data": `{"id":"2"}`, "create_method": "GET" }, client); err == nil || !strings.Contains(err.Error(), "read_only") {
+    t.Fatalf("resource_api_object_test.go: Expected read_only to refuse a create by GET but got %v", err)
+  }
+}
+
+func TestIdempotencyKeyAfterFailedCreate(t *testing.T) {
+  keys := make([]string, 0)
+  fail := true
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "POST" { keys = append(keys, r.Header.Get("Idempotency-Key")) }
+    /* Created, but the answer never makes it back */
+    if fail { w.WriteHeader(502); return }
+    w.Write([]byte(`{"id":"1","name":"web"}`))
+  }))
+  defer server.Close()
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, IDAttribute: "id", WriteReturnsObject: true })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+
+  config := map[string]interface{}{ "path": "/things", "data": `{"name":"web"}`, "idempotency_header": "Idempotency-Key" }
+  if _, err := apply_resource(t, resourceRestApi(), nil, config, client); err == nil { t.Fatalf("resource_api_object_test.go: Expected the create to fail") }
+  fail = false
+  state, err := apply_resource(t, resourceRestApi(), nil, config, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] { t.Fatalf("resource_api_object_test.go: Expected the retried create to send the same key but got %v", keys) }
+  if state.Attributes["idempotency_key"] != keys[0] { t.Fatalf("resource_api_object_test.go: Expected idempotency_key %s in the state but got %v", keys[0], state.Attributes) }
+
+  /* Another request is another key, unless one is given */
+  config["data"] = `{"name":"db"}`
+  apply_resource(t, resourceRestApi(), nil, config, client)
+  if keys[2] == keys[0] { t.Fatalf("resource_api_object_test.go: Different creates sent the same key") }
+  config["idempotency_key"] = "mine"
+  apply_resource(t, resourceRestApi(), nil, config, client)
+  if keys[3] != "mine" { t.Fatalf("resource_api_object_test.go: Expected the configured key but got %s", keys[3]) }
+}
+
+func TestImportThenPlan(t *testing.T) {
+  objects := map[string]map[string]interface{}{
+    "1": { "id": "1", "name": "web" },
+    "2": { "id": "2", "name": "db", "updated_at": "2026-10-01T00:00:00Z" },
+  }
+  svr := fakeserver.NewFakeServer(8084, objects, true, false)
+  defer svr.Shutdown()
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8084", Timeout: 5, IDAttribute: "id", WriteReturnsObject: true })
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+
+  import_object := func(id string) *terraform.InstanceState {
+    r := resourceRestApi()
+    imported, err := r.Importer.State(r.Data(&terraform.InstanceState{ ID: "/api/objects/" + id }), client)
+    if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+    state, err := r.Refresh(imported[0].State(), client)
+    if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+    return state
+  }
+
+  state := import_object("1")
+  if state.Attributes["data"] != `{"name":"web"}` { t.Fatalf("resource_api_object_test.go: Unexpected data after import '%s'", state.Attributes["data"]) }
+  diff, err := plan_resource(t, resourceRestApi(), state, map[string]interface{}{ "path": "/api/objects", "data": `{"name":"web"}` }, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  if !diff.Empty() { t.Fatalf("resource_api_object_test.go: The plan after import is not empty: %#v", diff.Attributes) }
+
+  /* Only ignore_keys itself is new, not what it leaves out of data */
+  state = import_object("2")
+  config := map[string]interface{}{ "path": "/api/objects", "data": `{"name":"db"}`, "ignore_keys": []interface{}{ "updated_at" } }
+  diff, err = plan_resource(t, resourceRestApi(), state, config, client)
+  if err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  for k := range diff.Attributes {
+    if !strings.HasPrefix(k, "ignore_keys") { t.Fatalf("resource_api_object_test.go: Unexpected change to %s after import", k) }
+  }
+
+  /* Applying it does not send the server's timestamp back */
+  sent := ""
+  svr.AddHook(func(w http.ResponseWriter, r *http.Request) bool {
+    if r.Method != "PUT" { return false }
+    b, _ := ioutil.ReadAll(r.Body)
+    sent = string(b)
+    r.Body = ioutil.NopCloser(bytes.NewReader(b))
+    return false
+  })
+  if _, err = apply_resource(t, resourceRestApi(), state, config, client); err != nil { t.Fatalf("resource_api_object_test.go: %s", err) }
+  if sent == "" || strings.Contains(sent, "updated_at") { t.Fatalf("resource_api_object_test.go: Expected an update without updated_at but sent '%s'", sent) }
+}
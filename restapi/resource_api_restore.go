@@ -0,0 +1,132 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "time"
+)
+
+func resourceRestApiRestore() *schema.Resource {
+  return &schema.Resource{
+    Create: resourceRestApiRestoreCreate,
+    Read:   resourceRestApiRestoreRead,
+    Delete: resourceRestApiRestoreDelete,
+
+    Timeouts: &schema.ResourceTimeout{
+      Create: schema.DefaultTimeout(20 * time.Minute),
+    },
+
+    Schema: map[string]*schema.Schema{
+      "snapshot": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "A snapshot as produced by the restapi_snapshot data source (for example, file(\"backup.json\")). Every object in it is created or updated on the API.",
+        Required:    true,
+        ForceNew:    true,
+      },
+      "path": &schema.Schema{
+        Type:        schema.TypeString,
+        Description: "The collection path to restore the objects into. Defaults to the path the snapshot was taken from.",
+        Optional:    true,
+        ForceNew:    true,
+      },
+      "debug": &schema.Schema{
+        Type:        schema.TypeBool,
+        Description: "Whether to emit verbose debug output while restoring objects.",
+        Optional:    true,
+        ForceNew:    true,
+      },
+      "created_ids": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "The ids of the objects that did not exist and were created.",
+        Computed:    true,
+      },
+      "updated_ids": &schema.Schema{
+        Type:        schema.TypeList,
+        Elem:        &schema.Schema{ Type: schema.TypeString },
+        Description: "The ids of the objects that already existed and were updated.",
+        Computed:    true,
+      },
+    }, /* End schema */
+
+  }
+}
+
+/* A restore is a one-shot replay: every object in the snapshot is
+   PUT if it exists and POSTed if it does not. The first failure
+   stops the restore, so it can be retried once the problem is fixed */
+func resourceRestApiRestoreCreate(d *schema.ResourceData, meta interface{}) error {
+  client := meta.(*APIClient)
+  debug := d.Get("debug").(bool)
+
+  snapshot := api_snapshot{}
+  if err := json.Unmarshal([]byte(d.Get("snapshot").(string)), &snapshot); err != nil {
+    return fmt.Errorf("resource_api_restore.go: snapshot is not valid: %s", err)
+  }
+  path := d.Get("path").(string)
+  if path == "" { path = snapshot.Path }
+  if path == "" { return errors.New("resource_api_restore.go: path is not set and the snapshot does not say where it was taken from") }
+
+  ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+  defer cancel()
+
+  log_info("resource_api_restore.go", "Restoring snapshot", "path", path, "count", len(snapshot.Objects), "timestamp", snapshot.Timestamp)
+
+  created := make([]string, 0)
+  updated := make([]string, 0)
+  for i, o := range snapshot.Objects {
+    data, ok := o.(map[string]interface{})
+    if !ok { return fmt.Errorf("resource_api_restore.go: Object %d in the snapshot is not a JSON object", i) }
+    b, err := json.Marshal(data)
+    if err != nil { return err }
+
+    obj, err := NewAPIObject(client, &APIObjectOpt{
+      Path: path,
+      Data: string(b),
+      Debug: debug,
+      Context: ctx,
+    })
+    if err != nil { return fmt.Errorf("resource_api_restore.go: Object %d in the snapshot cannot be restored: %s", i, err) }
+
+    exists := false
+    if obj.id != "" {
+      var api_err *APIError
+      err = obj.ReadObject()
+      if err == nil {
+        exists = true
+      } else if !errors.As(err, &api_err) || api_err.StatusCode != 404 {
+        return fmt.Errorf("resource_api_restore.go: Could not check if '%s' exists: %s", obj.id, err)
+      }
+    }
+
+    if exists {
+      if err := obj.UpdateObject(); err != nil { return fmt.Errorf("resource_api_restore.go: Could not update '%s': %s", obj.id, err) }
+      updated = append(updated, obj.id)
+    } else {
+      if err := obj.CreateObject(); err != nil { return fmt.Errorf("resource_api_restore.go: Could not create object %d: %s", i, err) }
+      created = append(created, obj.id)
+    }
+    if debug { log_debug("resource_api_restore.go", "Restored object", "id", obj.id, "existed", exists) }
+  }
+
+  log_info("resource_api_restore.go", "Restore finished", "path", path, "created", len(created), "updated", len(updated))
+  d.SetId(fmt.Sprintf("%s@%s", path, snapshot.Timestamp))
+  d.Set("created_ids", created)
+  d.Set("updated_ids", updated)
+  return nil
+}
+
+/* Nothing to refresh - the restore happened at a point in time */
+func resourceRestApiRestoreRead(d *schema.ResourceData, meta interface{}) error {
+  return nil
+}
+
+/* Restored objects are deliberately left alone. Removing the
+   resource only forgets that the restore happened */
+func resourceRestApiRestoreDelete(d *schema.ResourceData, meta interface{}) error {
+  d.SetId("")
+  return nil
+}
@@ -0,0 +1,37 @@
+package restapi
+
+import (
+  "github.com/TrurlMcByte/terraform-provider-restapi/fakeserver"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestRestore(t *testing.T) {
+  objects := map[string]map[string]interface{}{
+    "1": { "id": "1", "name": "changed since the snapshot" },
+  }
+  svr := fakeserver.NewFakeServer(8082, objects, true, false)
+  defer svr.Shutdown()
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8082", Timeout: 5, IDAttribute: "id", WriteReturnsObject: true })
+  if err != nil { t.Fatalf("resource_api_restore_test.go: %s", err) }
+
+  /* 1 is still there and is put back as it was. 2 was deleted since */
+  snapshot := `{ "path": "/api/objects", "timestamp": "2026-10-01T00:00:00Z", "objects": [ { "id": "1", "name": "web" }, { "id": "2", "name": "db" } ] }`
+  state, err := apply_resource(t, resourceRestApiRestore(), nil, map[string]interface{}{ "snapshot": snapshot }, client)
+  if err != nil { t.Fatalf("resource_api_restore_test.go: %s", err) }
+  if state.ID != "/api/objects@2026-10-01T00:00:00Z" { t.Fatalf("resource_api_restore_test.go: Unexpected id '%s'", state.ID) }
+  d := resourceRestApiRestore().Data(state)
+  if ids := d.Get("updated_ids"); !reflect.DeepEqual(ids, []interface{}{ "1" }) { t.Fatalf("resource_api_restore_test.go: Unexpected updated_ids %v", ids) }
+  if ids := d.Get("created_ids"); !reflect.DeepEqual(ids, []interface{}{ "2" }) { t.Fatalf("resource_api_restore_test.go: Unexpected created_ids %v", ids) }
+
+  for id, name := range map[string]string{ "1": "web", "2": "db" } {
+    res, err := client.SendRequest("GET", "/api/objects/" + id, "")
+    if err != nil { t.Fatalf("resource_api_restore_test.go: Object '%s' was not restored: %s", id, err) }
+    if !strings.Contains(res, `"name":"` + name + `"`) { t.Fatalf("resource_api_restore_test.go: Object '%s' was restored as %s", id, res) }
+  }
+
+  /* Without a path of its own, the snapshot has to say where it is from */
+  _, err = apply_resource(t, resourceRestApiRestore(), nil, map[string]interface{}{ "snapshot": `{ "objects": [] }` }, client)
+  if err == nil { t.Fatalf("resource_api_restore_test.go: A restore with nowhere to go did not fail") }
+}
@@ -0,0 +1,68 @@
+package restapi
+
+import (
+  "sync"
+  "time"
+)
+
+/* Successful GET responses, kept for ttl so refreshing hundreds of
+   objects does not fetch the same URL over and over. Anything that
+   could change the API throws the whole cache away, since there is
+   no telling which URLs a write affects */
+type response_cache struct {
+  ttl        time.Duration
+  mutex      sync.Mutex
+  entries    map[string]response_cache_entry
+  /* Bumped by every clear, so a GET that was already in flight
+     when something was written does not cache what it got */
+  generation uint64
+}
+
+type response_cache_entry struct {
+  response *api_response
+  expires  time.Time
+}
+
+func new_response_cache(ttl time.Duration) *response_cache {
+  return &response_cache{
+    ttl: ttl,
+    entries: make(map[string]response_cache_entry),
+  }
+}
+
+func (c *response_cache) get(key string) *api_response {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  entry, ok := c.entries[key]
+  if !ok { return nil }
+  if time.Now().After(entry.expires) {
+    delete(c.entries, key)
+    return nil
+  }
+  /* Every caller gets headers of its own to do with as it likes */
+  response := *entry.response
+  response.headers = entry.response.headers.Clone()
+  return &response
+}
+
+/* The generation to pass to put for a request about to be sent */
+func (c *response_cache) current() uint64 {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  return c.generation
+}
+
+func (c *response_cache) put(key string, response *api_response, generation uint64) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  if generation != c.generation { return }
+  c.entries[key] = response_cache_entry{ response: response, expires: time.Now().Add(c.ttl) }
+}
+
+func (c *response_cache) clear() {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  c.entries = make(map[string]response_cache_entry)
+  c.generation++
+}
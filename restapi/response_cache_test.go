@@ -0,0 +1,50 @@
+package restapi
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+)
+
+func TestResponseCache(t *testing.T) {
+  cache := new_response_cache(time.Hour)
+  cache.put("/things", &api_response{ status: 200, body: "[]" }, cache.current())
+  if res := cache.get("/things"); res == nil || res.body != "[]" { t.Fatalf("response_cache_test.go: Cached response was not returned") }
+
+  cache.clear()
+  if cache.get("/things") != nil { t.Fatalf("response_cache_test.go: Cache was not cleared") }
+
+  expired := new_response_cache(-time.Second)
+  expired.put("/things", &api_response{ status: 200, body: "[]" }, expired.current())
+  if expired.get("/things") != nil { t.Fatalf("response_cache_test.go: Expired response was returned") }
+
+  /* A read that started before a write must not be cached after it */
+  generation := cache.current()
+  cache.clear()
+  cache.put("/things", &api_response{ status: 200, body: "stale" }, generation)
+  if cache.get("/things") != nil { t.Fatalf("response_cache_test.go: Response read before a write was cached") }
+
+  cache.put("/things", &api_response{ status: 200, headers: http.Header{ "Etag": []string{ "a" } }, body: "[]" }, cache.current())
+  cache.get("/things").headers.Set("Etag", "b")
+  if cache.get("/things").headers.Get("Etag") != "a" { t.Fatalf("response_cache_test.go: Changing a cached response's headers changed the cache") }
+}
+
+func TestResponseCacheKey(t *testing.T) {
+  requests := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    requests++
+    w.Write([]byte(r.Header.Get("X-Tenant")))
+  }))
+  defer server.Close()
+  client, err := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, CacheTTL: 60 })
+  if err != nil { t.Fatalf("response_cache_test.go: %s", err) }
+
+  for _, tenant := range []string{ "a", "b", "a" } {
+    res, err := client.send_request(context.Background(), "GET", "/things", "", map[string]string{ "X-Tenant": tenant })
+    if err != nil { t.Fatalf("response_cache_test.go: %s", err) }
+    if res.body != tenant { t.Fatalf("response_cache_test.go: A read with X-Tenant %s got the response for %s", tenant, res.body) }
+  }
+  if requests != 2 { t.Fatalf("response_cache_test.go: Expected 2 requests but %d were made", requests) }
+}
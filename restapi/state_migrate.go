@@ -0,0 +1,95 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/terraform"
+  "fmt"
+  "net/url"
+  "strconv"
+  "strings"
+)
+
+/* Attributes only the upstream Mastercard/restapi provider has. Their
+   values are either already elsewhere in the state (object_id is the
+   id, create_response is api_response) or only change what refreshes
+   do, which is this provider's drift_detection */
+var mastercard_only_attributes = []string{ "object_id", "create_response", "read_data", "ignore_all_server_changes", "ignore_server_additions" }
+
+/* Version 0 is both this provider's state from before there were
+   versions and the upstream Mastercard/restapi provider's, which names
+   and shapes a few attributes differently. This provider's state has
+   none of those, so it comes through unchanged */
+func resourceRestApiMigrateState(version int, state *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+  switch version {
+  case 0:
+    if state == nil || state.Attributes == nil { return state, nil }
+    return migrate_mastercard_state(state)
+  }
+  return nil, fmt.Errorf("state_migrate.go: Unknown state version %d", version)
+}
+
+func migrate_mastercard_state(state *terraform.InstanceState) (*terraform.InstanceState, error) {
+  attrs := state.Attributes
+  migrated := false
+
+  /* query_string was a single string, such as "a=1&b=2" */
+  if query, ok := attrs["query_string"]; ok {
+    delete(attrs, "query_string")
+    if err := set_flat_query(attrs, "query_string", query); err != nil { return nil, err }
+    migrated = true
+  }
+
+  /* read_search was a map rather than a block, and took a query_string
+     of its own for the search */
+  if _, ok := attrs["read_search.%"]; ok {
+    search := make(map[string]string)
+    for k, v := range attrs {
+      if !strings.HasPrefix(k, "read_search.") { continue }
+      search[strings.TrimPrefix(k, "read_search.")] = v
+      delete(attrs, k)
+    }
+    if search["search_key"] != "" {
+      attrs["read_search.#"] = "1"
+      for _, key := range []string{ "search_key", "search_value", "results_key" } {
+        attrs["read_search.0." + key] = search[key]
+      }
+      attrs["read_search.0.search_path"] = ""
+    }
+    if query := search["query_string"]; query != "" && attrs["read_query_string.%"] == "" {
+      if err := set_flat_query(attrs, "read_query_string", query); err != nil { return nil, err }
+    }
+    migrated = true
+  }
+
+  /* ignore_changes_to named keys of api_data to leave alone, as
+     ignore_keys does */
+  if count, ok := attrs["ignore_changes_to.#"]; ok {
+    if _, exists := attrs["ignore_keys.#"]; !exists {
+      attrs["ignore_keys.#"] = count
+      n, _ := strconv.Atoi(count)
+      for i := 0; i < n; i++ { attrs[fmt.Sprintf("ignore_keys.%d", i)] = attrs[fmt.Sprintf("ignore_changes_to.%d", i)] }
+    }
+    for k := range attrs {
+      if strings.HasPrefix(k, "ignore_changes_to.") { delete(attrs, k) }
+    }
+    migrated = true
+  }
+
+  for _, name := range mastercard_only_attributes {
+    if _, ok := attrs[name]; ok {
+      delete(attrs, name)
+      migrated = true
+    }
+  }
+
+  if migrated { log_info("state_migrate.go", "Migrated state written by the Mastercard/restapi provider", "id", state.ID) }
+  return state, nil
+}
+
+/* Sets a map attribute in flatmap form from a query string */
+func set_flat_query(attrs map[string]string, name string, query string) error {
+  values, err := url.ParseQuery(strings.TrimPrefix(query, "?"))
+  if err != nil { return fmt.Errorf("state_migrate.go: Cannot migrate %s '%s': %s", name, query, err) }
+  attrs[name + ".%"] = strconv.Itoa(len(values))
+  for k, v := range values { attrs[name + "." + k] = strings.Join(v, ",") }
+  return nil
+}
@@ -0,0 +1,60 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/terraform"
+  "reflect"
+  "testing"
+)
+
+func TestMigrateMastercardState(t *testing.T) {
+  state := &terraform.InstanceState{
+    ID: "1",
+    Attributes: map[string]string{
+      "id": "1",
+      "path": "/api/objects",
+      "data": `{"id":"1"}`,
+      "id_attribute": "id",
+      "create_method": "PUT",
+      "object_id": "1",
+      "create_response": `{"id":"1"}`,
+      "ignore_all_server_changes": "false",
+      "query_string": "api_version=2&expand=all",
+      "read_search.%": "3",
+      "read_search.search_key": "name",
+      "read_search.search_value": "web",
+      "read_search.query_string": "limit=100",
+      "ignore_changes_to.#": "1",
+      "ignore_changes_to.0": "updated_at",
+    },
+  }
+  migrated, err := resourceRestApiMigrateState(0, state, nil)
+  if err != nil { t.Fatalf("state_migrate_test.go: %s", err) }
+
+  expected := map[string]string{
+    "id": "1",
+    "path": "/api/objects",
+    "data": `{"id":"1"}`,
+    "id_attribute": "id",
+    "create_method": "PUT",
+    "query_string.%": "2",
+    "query_string.api_version": "2",
+    "query_string.expand": "all",
+    "read_search.#": "1",
+    "read_search.0.search_key": "name",
+    "read_search.0.search_value": "web",
+    "read_search.0.results_key": "",
+    "read_search.0.search_path": "",
+    "read_query_string.%": "1",
+    "read_query_string.limit": "100",
+    "ignore_keys.#": "1",
+    "ignore_keys.0": "updated_at",
+  }
+  if !reflect.DeepEqual(migrated.Attributes, expected) { t.Fatalf("state_migrate_test.go: Unexpected attributes %v", migrated.Attributes) }
+
+  /* This provider's own state is left as it is */
+  own := map[string]string{ "id": "1", "path": "/api/objects", "query_string.%": "1", "query_string.v": "2", "read_search.#": "0" }
+  state = &terraform.InstanceState{ ID: "1", Attributes: map[string]string{} }
+  for k, v := range own { state.Attributes[k] = v }
+  if migrated, err = resourceRestApiMigrateState(0, state, nil); err != nil { t.Fatalf("state_migrate_test.go: %s", err) }
+  if !reflect.DeepEqual(migrated.Attributes, own) { t.Fatalf("state_migrate_test.go: This provider's state was changed to %v", migrated.Attributes) }
+}
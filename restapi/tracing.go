@@ -0,0 +1,275 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "bytes"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+/* Spans are shipped to the collector in batches of this many, or
+   after flush_interval, whichever comes first */
+const trace_batch_size = 50
+const trace_flush_interval = time.Second
+
+/* A tiny OpenTelemetry exporter speaking OTLP/HTTP with JSON
+   encoding. It only knows about the client spans sent for each
+   API call, which is all the provider needs */
+type tracer struct {
+  endpoint string
+  headers  map[string]string
+  service  string
+  client   *http.Client
+  mutex    sync.Mutex
+  spans    []otlp_span
+  flushing bool
+  /* Exports under way, and signalled when one finishes */
+  exporting int
+  exported  *sync.Cond
+}
+
+type otlp_span struct {
+  TraceID    string          `json:"traceId"`
+  SpanID     string          `json:"spanId"`
+  Name       string          `json:"name"`
+  Kind       int             `json:"kind"`
+  Start      string          `json:"startTimeUnixNano"`
+  End        string          `json:"endTimeUnixNano"`
+  Attributes []otlp_attribute `json:"attributes"`
+  Status     otlp_status     `json:"status"`
+}
+
+type otlp_attribute struct {
+  Key   string                 `json:"key"`
+  Value map[string]interface{} `json:"value"`
+}
+
+type otlp_status struct {
+  Code    int    `json:"code"`
+  Message string `json:"message,omitempty"`
+}
+
+/* One in-flight API call */
+type trace_span struct {
+  tracer *tracer
+  span   otlp_span
+  start  time.Time
+}
+
+func new_tracer(endpoint string, headers map[string]string, service string) (*tracer, error) {
+  u, err := url.Parse(endpoint)
+  if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+    return nil, fmt.Errorf("Invalid otlp_endpoint '%s': must be an http or https URL", endpoint)
+  }
+  /* Like the OTel SDKs, a bare endpoint gets the signal path added */
+  if u.Path == "" || u.Path == "/" { u.Path = "/v1/traces" }
+  if service == "" { service = "terraform-provider-restapi" }
+
+  t := &tracer{
+    endpoint: u.String(),
+    headers: headers,
+    service: service,
+    client: &http.Client{ Timeout: 10 * time.Second },
+  }
+  t.exported = sync.NewCond(&t.mutex)
+  return t, nil
+}
+
+func (t *tracer) start(method string, full_uri string) *trace_span {
+  span := &trace_span{
+    tracer: t,
+    start: time.Now(),
+    span: otlp_span{
+      TraceID: random_hex(16),
+      SpanID: random_hex(8),
+      Name: method,
+      Kind: 3, /* SPAN_KIND_CLIENT */
+    },
+  }
+
+  span.attribute("http.request.method", "stringValue", method)
+  span.attribute("url.full", "stringValue", full_uri)
+  if u, err := url.Parse(full_uri); err == nil {
+    span.attribute("url.path", "stringValue", u.Path)
+    span.attribute("server.address", "stringValue", u.Hostname())
+  }
+  return span
+}
+
+/* W3C trace context so the API can attach its own spans to ours */
+func (s *trace_span) traceparent() string {
+  return fmt.Sprintf("00-%s-%s-01", s.span.TraceID, s.span.SpanID)
+}
+
+func (s *trace_span) attribute(key string, kind string, value interface{}) {
+  s.span.Attributes = append(s.span.Attributes, otlp_attribute{ Key: key, Value: map[string]interface{}{ kind: value } })
+}
+
+/* res and err are whatever send_request returned */
+func (s *trace_span) end(res *api_response, err error) {
+  end := time.Now()
+  s.span.Start = strconv.FormatInt(s.start.UnixNano(), 10)
+  s.span.End = strconv.FormatInt(end.UnixNano(), 10)
+
+  status := 0
+  var api_err *APIError
+  if res != nil {
+    status = res.status
+  } else if errors.As(err, &api_err) {
+    status = api_err.StatusCode
+  }
+  if status != 0 {
+    /* OTLP JSON carries 64 bit integers as strings */
+    s.attribute("http.response.status_code", "intValue", strconv.Itoa(status))
+  }
+
+  if err != nil {
+    s.span.Status = otlp_status{ Code: 2, Message: err.Error() }
+  } else {
+    s.span.Status = otlp_status{ Code: 1 }
+  }
+  s.tracer.add(s.span)
+}
+
+func (t *tracer) add(span otlp_span) {
+  t.mutex.Lock()
+  defer t.mutex.Unlock()
+
+  t.spans = append(t.spans, span)
+  if len(t.spans) >= trace_batch_size {
+    batch := t.spans
+    t.spans = nil
+    t.exporting++
+    go t.export_counted(batch)
+  } else if !t.flushing {
+    t.flushing = true
+    time.AfterFunc(trace_flush_interval, t.flush)
+  }
+}
+
+func (t *tracer) flush() {
+  t.mutex.Lock()
+  batch := t.spans
+  t.spans = nil
+  t.flushing = false
+  if len(batch) > 0 { t.exporting++ }
+  t.mutex.Unlock()
+
+  if len(batch) > 0 { t.export_counted(batch) }
+}
+
+/* Terraform kills the plugin as soon as it has what it asked for, so
+   spans still batched (or on their way) when an operation returns
+   would be lost. Sends what is batched and waits for every export */
+func (t *tracer) flush_wait() {
+  t.flush()
+  t.mutex.Lock()
+  defer t.mutex.Unlock()
+  for t.exporting > 0 { t.exported.Wait() }
+}
+
+/* For exports counted in exporting before they were started */
+func (t *tracer) export_counted(spans []otlp_span) {
+  t.export(spans)
+  t.mutex.Lock()
+  t.exporting--
+  t.exported.Broadcast()
+  t.mutex.Unlock()
+}
+
+/* Has every operation of r wait for its spans to be exported before
+   returning to terraform (see flush_wait) */
+func flush_traces(r *schema.Resource) *schema.Resource {
+  flush := func(meta interface{}) {
+    if client, ok := meta.(*APIClient); ok && client.tracer != nil { client.tracer.flush_wait() }
+  }
+  wrap := func(f func(*schema.ResourceData, interface{}) error) func(*schema.ResourceData, interface{}) error {
+    if f == nil { return nil }
+    return func(d *schema.ResourceData, meta interface{}) error {
+      defer flush(meta)
+      return f(d, meta)
+    }
+  }
+
+  r.Create = wrap(r.Create)
+  r.Read = wrap(r.Read)
+  r.Update = wrap(r.Update)
+  r.Delete = wrap(r.Delete)
+  if exists := r.Exists; exists != nil {
+    r.Exists = func(d *schema.ResourceData, meta interface{}) (bool, error) {
+      defer flush(meta)
+      return exists(d, meta)
+    }
+  }
+  if r.Importer != nil && r.Importer.State != nil {
+    state := r.Importer.State
+    r.Importer.State = func(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+      defer flush(meta)
+      return state(d, meta)
+    }
+  }
+  return r
+}
+
+/* Tracing must never get in the way of an apply, so failures
+   to export are only logged */
+func (t *tracer) export(spans []otlp_span) {
+  payload := map[string]interface{}{
+    "resourceSpans": []interface{}{
+      map[string]interface{}{
+        "resource": map[string]interface{}{
+          "attributes": []otlp_attribute{
+            otlp_attribute{ Key: "service.name", Value: map[string]interface{}{ "stringValue": t.service } },
+          },
+        },
+        "scopeSpans": []interface{}{
+          map[string]interface{}{
+            "scope": map[string]interface{}{ "name": "github.com/TrurlMcByte/terraform-provider-restapi" },
+            "spans": spans,
+          },
+        },
+      },
+    },
+  }
+
+  b, err := json.Marshal(payload)
+  if err != nil {
+    log_warn("tracing.go", "Could not encode spans", "count", len(spans), "error", err)
+    return
+  }
+
+  req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(b))
+  if err != nil {
+    log_warn("tracing.go", "Could not build export request", "endpoint", t.endpoint, "error", err)
+    return
+  }
+  req.Header.Set("Content-Type", "application/json")
+  for name, value := range t.headers { req.Header.Set(name, value) }
+
+  resp, err := t.client.Do(req)
+  if err != nil {
+    log_warn("tracing.go", "Could not export spans", "endpoint", t.endpoint, "count", len(spans), "error", err)
+    return
+  }
+  body, _ := ioutil.ReadAll(resp.Body)
+  resp.Body.Close()
+  if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+    log_warn("tracing.go", "Collector rejected spans", "endpoint", t.endpoint, "count", len(spans), "status", resp.StatusCode, "body", strings.TrimSpace(string(body)))
+  }
+}
+
+func random_hex(n int) string {
+  b := make([]byte, n)
+  rand.Read(b)
+  return hex.EncodeToString(b)
+}
@@ -0,0 +1,80 @@
+package restapi
+
+import (
+  "github.com/hashicorp/terraform/helper/schema"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "sync"
+  "testing"
+  "time"
+)
+
+func TestTracerExport(t *testing.T) {
+  received := make(chan map[string]interface{}, 1)
+  collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != "/v1/traces" { t.Errorf("tracing_test.go: Spans were sent to '%s'", r.URL.Path) }
+    b, _ := ioutil.ReadAll(r.Body)
+    payload := make(map[string]interface{})
+    json.Unmarshal(b, &payload)
+    received <- payload
+  }))
+  defer collector.Close()
+
+  tr, err := new_tracer(collector.URL, nil, "")
+  if err != nil { t.Fatalf("tracing_test.go: %s", err) }
+
+  span := tr.start("GET", "http://api.local/api/objects/1")
+  if len(span.traceparent()) != 55 { t.Fatalf("tracing_test.go: Malformed traceparent '%s'", span.traceparent()) }
+  span.end(&api_response{ status: 200 }, nil)
+  tr.flush()
+
+  payload := <-received
+  spans := payload["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+  if len(spans) != 1 { t.Fatalf("tracing_test.go: Expected 1 span but got %d", len(spans)) }
+
+  attributes := make(map[string]interface{})
+  for _, a := range spans[0].(map[string]interface{})["attributes"].([]interface{}) {
+    attr := a.(map[string]interface{})
+    for _, v := range attr["value"].(map[string]interface{}) { attributes[attr["key"].(string)] = v }
+  }
+  if attributes["url.path"] != "/api/objects/1" || attributes["http.response.status_code"] != "200" {
+    t.Fatalf("tracing_test.go: Unexpected span attributes: %v", attributes)
+  }
+}
+
+func TestTracerFlushWait(t *testing.T) {
+  var mutex sync.Mutex
+  exported := 0
+  collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    b, _ := ioutil.ReadAll(r.Body)
+    payload := make(map[string]interface{})
+    json.Unmarshal(b, &payload)
+    spans := payload["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+    /* The batch sent in the background is slow, so it is still on its
+       way when the rest is flushed unless it is waited for */
+    if len(spans) == trace_batch_size { time.Sleep(300 * time.Millisecond) }
+    mutex.Lock()
+    exported += len(spans)
+    mutex.Unlock()
+  }))
+  defer collector.Close()
+
+  client, err := NewAPIClient(&APIClientOpt{ URI: "http://127.0.0.1:8080", OTLPEndpoint: collector.URL })
+  if err != nil { t.Fatalf("tracing_test.go: %s", err) }
+
+  /* A full batch goes out in the background, the rest stays batched */
+  read := func(d *schema.ResourceData, meta interface{}) error {
+    for i := 0; i < trace_batch_size + 2; i++ {
+      client.tracer.start("GET", "http://127.0.0.1:8080/things").end(&api_response{ status: 200 }, nil)
+    }
+    return nil
+  }
+  r := flush_traces(&schema.Resource{ Read: read, Schema: map[string]*schema.Schema{} })
+  if err := r.Read(r.TestResourceData(), client); err != nil { t.Fatalf("tracing_test.go: %s", err) }
+
+  mutex.Lock()
+  defer mutex.Unlock()
+  if exported != trace_batch_size + 2 { t.Fatalf("tracing_test.go: %d of %d spans were exported when the operation returned", exported, trace_batch_size + 2) }
+}
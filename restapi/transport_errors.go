@@ -0,0 +1,92 @@
+package restapi
+
+import (
+  "context"
+  "crypto/x509"
+  "errors"
+  "fmt"
+  "io"
+  "net"
+  "strings"
+  "syscall"
+)
+
+/* Why a request never got a response. Some of these are the network
+   having a bad moment and go away when asked again, others (a wrong
+   certificate, a name that does not exist) never will */
+const (
+  transport_dns_temporary = "dns_temporary"
+  transport_dns           = "dns"
+  transport_refused       = "connection_refused"
+  transport_reset         = "connection_reset"
+  transport_eof           = "eof"
+  transport_tls_timeout   = "tls_handshake_timeout"
+  transport_certificate   = "certificate"
+  transport_tls_refused   = "tls_refused"
+  transport_timeout       = "timeout"
+  transport_other         = "other"
+)
+
+/* A request that failed before the API answered */
+type transport_error struct {
+  kind   string
+  method string
+  path   string
+  err    error
+}
+
+func (e *transport_error) Error() string {
+  switch e.kind {
+  case transport_certificate:
+    return fmt.Sprintf("The API's TLS certificate was not accepted for %s '%s': %s. Check uri (or tls_server_name) and that the certificate is signed by an authority this machine trusts. Set insecure only for testing", e.method, e.path, e.err)
+  case transport_tls_refused:
+    return fmt.Sprintf("The API refused the TLS connection for %s '%s': %s. It may require a client certificate or a different TLS version", e.method, e.path, e.err)
+  case transport_dns:
+    return fmt.Sprintf("The API's host could not be found for %s '%s': %s. Check uri (and host_overrides)", e.method, e.path, e.err)
+  }
+  return fmt.Sprintf("%s '%s' failed (%s): %s", e.method, e.path, e.kind, e.err)
+}
+
+func (e *transport_error) Unwrap() error { return e.err }
+
+/* retryable says asking again may work. sent says the request may
+   have reached the server, so retrying a create could make two */
+func classify_transport_error(err error) (kind string, retryable bool, sent bool) {
+  if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) { return transport_timeout, false, true }
+
+  var unknown_authority x509.UnknownAuthorityError
+  var hostname x509.HostnameError
+  var invalid x509.CertificateInvalidError
+  if errors.As(err, &unknown_authority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+    return transport_certificate, false, false
+  }
+
+  var dns_err *net.DNSError
+  if errors.As(err, &dns_err) {
+    if dns_err.IsTemporary || dns_err.IsTimeout { return transport_dns_temporary, true, false }
+    return transport_dns, false, false
+  }
+
+  if errors.Is(err, syscall.ECONNREFUSED) { return transport_refused, true, false }
+  if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) { return transport_reset, true, true }
+  if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) { return transport_eof, true, true }
+
+  /* crypto/tls does not export these */
+  message := err.Error()
+  if strings.Contains(message, "TLS handshake timeout") { return transport_tls_timeout, true, false }
+  if strings.Contains(message, "remote error: tls:") { return transport_tls_refused, false, false }
+  if strings.Contains(message, "x509:") { return transport_certificate, false, false }
+
+  var net_err net.Error
+  if errors.As(err, &net_err) && net_err.Timeout() { return transport_timeout, false, true }
+  return transport_other, false, true
+}
+
+/* Methods that can be sent twice without doing two things */
+func idempotent_method(method string) bool {
+  switch method {
+  case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+    return true
+  }
+  return false
+}
@@ -0,0 +1,75 @@
+package restapi
+
+import (
+  "context"
+  "errors"
+  "io"
+  "net"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync/atomic"
+  "syscall"
+  "testing"
+)
+
+func TestClassifyTransportError(t *testing.T) {
+  cases := []struct {
+    err       error
+    kind      string
+    retryable bool
+    sent      bool
+  }{
+    { &net.OpError{ Op: "read", Err: syscall.ECONNRESET }, transport_reset, true, true },
+    { &net.OpError{ Op: "dial", Err: syscall.ECONNREFUSED }, transport_refused, true, false },
+    { io.ErrUnexpectedEOF, transport_eof, true, true },
+    { &net.DNSError{ Err: "server misbehaving", Name: "api", IsTemporary: true }, transport_dns_temporary, true, false },
+    { &net.DNSError{ Err: "no such host", Name: "api", IsNotFound: true }, transport_dns, false, false },
+    { errors.New("net/http: TLS handshake timeout"), transport_tls_timeout, true, false },
+    { errors.New("remote error: tls: certificate required"), transport_tls_refused, false, false },
+    { context.DeadlineExceeded, transport_timeout, false, true },
+  }
+  for _, c := range cases {
+    kind, retryable, sent := classify_transport_error(c.err)
+    if kind != c.kind || retryable != c.retryable || sent != c.sent {
+      t.Fatalf("transport_errors_test.go: '%s' was classified as %s (retryable %t, sent %t)", c.err, kind, retryable, sent)
+    }
+  }
+}
+
+func TestTransportRetries(t *testing.T) {
+  /* The first two connections are dropped without an answer */
+  var attempts int32
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if atomic.AddInt32(&attempts, 1) <= 2 {
+      conn, _, _ := w.(http.Hijacker).Hijack()
+      conn.Close()
+      return
+    }
+    w.Write([]byte(`{ "id": "1" }`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, TransportRetries: 2, DisableKeepAlives: true })
+  if _, err := client.send_request(context.Background(), "GET", "/things/1", "", nil); err != nil { t.Fatalf("transport_errors_test.go: %s", err) }
+  if n := atomic.LoadInt32(&attempts); n != 3 { t.Fatalf("transport_errors_test.go: Expected 3 attempts but got %d", n) }
+
+  /* The create may have been received, so it is not sent again */
+  atomic.StoreInt32(&attempts, 0)
+  _, err := client.send_request(context.Background(), "POST", "/things", `{ "id": "1" }`, nil)
+  if n := atomic.LoadInt32(&attempts); err == nil || n != 1 { t.Fatalf("transport_errors_test.go: Expected the POST to fail after 1 attempt but got '%v' after %d", err, n) }
+}
+
+func TestCertificateError(t *testing.T) {
+  server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(`{}`))
+  }))
+  defer server.Close()
+
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, TransportRetries: 3 })
+  _, err := client.send_request(context.Background(), "GET", "/things/1", "", nil)
+  var transport_err *transport_error
+  if !errors.As(err, &transport_err) || transport_err.kind != transport_certificate || !strings.Contains(err.Error(), "certificate was not accepted") {
+    t.Fatalf("transport_errors_test.go: Expected a certificate error but got '%v'", err)
+  }
+}
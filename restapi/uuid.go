@@ -0,0 +1,30 @@
+package restapi
+
+import (
+  "crypto/rand"
+  "crypto/sha1"
+  "fmt"
+)
+
+/* A random (version 4) UUID */
+func new_uuid() (string, error) {
+  b := make([]byte, 16)
+  if _, err := rand.Read(b); err != nil { return "", err }
+  b[6] = (b[6] & 0x0f) | 0x40
+  b[8] = (b[8] & 0x3f) | 0x80
+  return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+/* The RFC 4122 namespace for names that are URLs */
+var uuid_namespace_url = []byte{ 0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8 }
+
+/* A name-based (version 5) UUID: the same name always gives the same one */
+func name_uuid(name string) string {
+  h := sha1.New()
+  h.Write(uuid_namespace_url)
+  h.Write([]byte(name))
+  b := h.Sum(nil)[:16]
+  b[6] = (b[6] & 0x0f) | 0x50
+  b[8] = (b[8] & 0x3f) | 0x80
+  return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,175 @@
+package restapi
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "os"
+  "strings"
+  "sync"
+  "unicode/utf8"
+)
+
+/* Record/replay of every HTTP interaction with the API. Recording
+   passes requests through and writes them to the cassette as they
+   happen; replaying answers from the cassette without touching the
+   network, so plans can be tested and debugged deterministically */
+type vcr_transport struct {
+  mode     string
+  cassette string
+  next     http.RoundTripper
+  mutex    sync.Mutex
+  tape     []vcr_interaction
+  used     []bool
+}
+
+/* Request headers are deliberately not recorded - they hold the
+   credentials - and take no part in matching. Response headers and
+   query parameters named like credentials (Set-Cookie, api_key and
+   so on) are hidden, and so are the secrets the provider knows about
+   (see add_log_redactions), such as the values of ${env:NAME}.
+   Requests being replayed are redacted the same way so they still
+   match what was recorded. Bodies that are not text, or are still
+   compressed, are kept in base64 */
+type vcr_interaction struct {
+  Method         string      `json:"method"`
+  URL            string      `json:"url"`
+  Body           string      `json:"body,omitempty"`
+  BodyBase64     []byte      `json:"body_base64,omitempty"`
+  Status         int         `json:"status"`
+  Header         http.Header `json:"header"`
+  Response       string      `json:"response"`
+  ResponseBase64 []byte      `json:"response_base64,omitempty"`
+}
+
+func new_vcr_transport(mode string, cassette string, next http.RoundTripper) (*vcr_transport, error) {
+  if cassette == "" { return nil, fmt.Errorf("vcr_cassette must be set when vcr_mode is '%s'", mode) }
+  v := &vcr_transport{ mode: mode, cassette: cassette, next: next }
+
+  switch mode {
+  case "record":
+    /* Every run records a fresh cassette */
+    if err := v.save(); err != nil { return nil, err }
+  case "replay":
+    b, err := ioutil.ReadFile(cassette)
+    if err != nil { return nil, fmt.Errorf("Could not read vcr_cassette: %s", err) }
+    if err := json.Unmarshal(b, &v.tape); err != nil { return nil, fmt.Errorf("vcr_cassette '%s' is not valid: %s", cassette, err) }
+    v.used = make([]bool, len(v.tape))
+  default:
+    return nil, fmt.Errorf("Unsupported vcr_mode '%s'. Must be record or replay", mode)
+  }
+  return v, nil
+}
+
+func (v *vcr_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+  body := []byte{}
+  if req.Body != nil {
+    var err error
+    if body, err = ioutil.ReadAll(req.Body); err != nil { return nil, err }
+    req.Body.Close()
+    req.Body = ioutil.NopCloser(bytes.NewReader(body))
+  }
+  interaction := vcr_interaction{ Method: req.Method, URL: redact_url(req.URL.String()) }
+  if utf8.Valid(body) {
+    interaction.Body = redact(string(body))
+  } else {
+    interaction.BodyBase64 = body
+  }
+
+  if v.mode == "replay" { return v.replay(req, interaction) }
+
+  resp, err := v.next.RoundTrip(req)
+  if err != nil { return nil, err }
+  response, err := ioutil.ReadAll(resp.Body)
+  resp.Body.Close()
+  if err != nil { return nil, err }
+  resp.Body = ioutil.NopCloser(bytes.NewReader(response))
+
+  interaction.Status = resp.StatusCode
+  interaction.Header = redact_headers(resp.Header)
+  if utf8.Valid(response) {
+    interaction.Response = redact(string(response))
+  } else {
+    interaction.ResponseBase64 = response
+  }
+
+  v.mutex.Lock()
+  defer v.mutex.Unlock()
+  v.tape = append(v.tape, interaction)
+  if err := v.save(); err != nil { return nil, err }
+  return resp, nil
+}
+
+/* Identical requests are answered in the order they were recorded */
+func (v *vcr_transport) replay(req *http.Request, want vcr_interaction) (*http.Response, error) {
+  v.mutex.Lock()
+  defer v.mutex.Unlock()
+
+  for i, recorded := range v.tape {
+    if v.used[i] || recorded.Method != want.Method || recorded.URL != want.URL ||
+      recorded.Body != want.Body || !bytes.Equal(recorded.BodyBase64, want.BodyBase64) {
+      continue
+    }
+    v.used[i] = true
+    response := []byte(recorded.Response)
+    if recorded.ResponseBase64 != nil { response = recorded.ResponseBase64 }
+    return &http.Response{
+      Status: fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+      StatusCode: recorded.Status,
+      Proto: "HTTP/1.1",
+      ProtoMajor: 1,
+      ProtoMinor: 1,
+      Header: recorded.Header,
+      Body: ioutil.NopCloser(bytes.NewReader(response)),
+      ContentLength: int64(len(response)),
+      Request: req,
+    }, nil
+  }
+  return nil, fmt.Errorf("vcr_cassette '%s' has no (unused) recording of %s %s", v.cassette, want.Method, want.URL)
+}
+
+/* A copy, since the response still needs the real values */
+func redact_headers(header http.Header) http.Header {
+  out := make(http.Header, len(header))
+  for name, values := range header {
+    for _, value := range values {
+      out[name] = append(out[name], redact(redact_header(name, value)))
+    }
+  }
+  return out
+}
+
+/* Query parameters are judged by the same words as headers, with
+   api_key spelled the way headers spell it */
+func redact_url(raw string) string {
+  u, err := url.Parse(raw)
+  if err != nil { return redact(raw) }
+  query := u.Query()
+  changed := false
+  for name, values := range query {
+    for i, value := range values {
+      if hidden := redact_header(strings.Replace(name, "_", "-", -1), value); hidden != value {
+        values[i] = hidden
+        changed = true
+      }
+    }
+  }
+  /* Left alone otherwise, so the order of parameters is kept */
+  if changed { u.RawQuery = query.Encode() }
+  return redact(u.String())
+}
+
+func (v *vcr_transport) save() error {
+  tape := v.tape
+  if tape == nil { tape = []vcr_interaction{} }
+  b, err := json.MarshalIndent(tape, "", "  ")
+  if err != nil { return err }
+
+  /* Write then rename so a crash mid-run never leaves half a cassette */
+  tmp := v.cassette + ".tmp"
+  if err := ioutil.WriteFile(tmp, b, 0600); err != nil { return fmt.Errorf("Could not write vcr_cassette: %s", err) }
+  return os.Rename(tmp, v.cassette)
+}
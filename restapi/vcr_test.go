@@ -0,0 +1,113 @@
+package restapi
+
+import (
+  "bytes"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+func TestVCRRecordReplay(t *testing.T) {
+  hits := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    hits++
+    w.Write([]byte(`{"id": "1", "hits": ` + strconv.Itoa(hits) + `}`))
+  }))
+  defer server.Close()
+  cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+  recorder, err := NewAPIClient(&APIClientOpt{ URI: server.URL, VCRMode: "record", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  first, _ := recorder.SendRequest("GET", "/things/1", "")
+  second, _ := recorder.SendRequest("GET", "/things/1", "")
+
+  player, err := NewAPIClient(&APIClientOpt{ URI: server.URL, VCRMode: "replay", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  replayed_first, err := player.SendRequest("GET", "/things/1", "")
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  replayed_second, _ := player.SendRequest("GET", "/things/1", "")
+
+  if hits != 2 { t.Fatalf("vcr_test.go: Replay reached the server (%d hits)", hits) }
+  if replayed_first != first || replayed_second != second {
+    t.Fatalf("vcr_test.go: Replayed '%s', '%s' but recorded '%s', '%s'", replayed_first, replayed_second, first, second)
+  }
+  if _, err := player.SendRequest("GET", "/things/1", ""); err == nil {
+    t.Fatalf("vcr_test.go: Request beyond the recording did not fail")
+  }
+}
+
+func TestVCRRedactsEnvInterpolation(t *testing.T) {
+  os.Setenv("REST_API_TEST_VCR_SECRET", "vcr-s3cret")
+  defer os.Unsetenv("REST_API_TEST_VCR_SECRET")
+
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    b, _ := ioutil.ReadAll(r.Body)
+    w.Write(b)
+  }))
+  defer server.Close()
+  cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+  data := `{"token":"${env:REST_API_TEST_VCR_SECRET}"}`
+  recorder, err := NewAPIClient(&APIClientOpt{ URI: server.URL, EnvInterpolation: true, VCRMode: "record", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if _, err := recorder.SendRequest("POST", "/things", data); err != nil { t.Fatalf("vcr_test.go: %s", err) }
+
+  b, err := ioutil.ReadFile(cassette)
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if strings.Contains(string(b), "vcr-s3cret") { t.Fatalf("vcr_test.go: The interpolated secret was recorded:\n%s", b) }
+
+  player, err := NewAPIClient(&APIClientOpt{ URI: server.URL, EnvInterpolation: true, VCRMode: "replay", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if _, err := player.SendRequest("POST", "/things", data); err != nil { t.Fatalf("vcr_test.go: The redacted request was not replayed: %s", err) }
+}
+
+func TestVCRBinaryResponses(t *testing.T) {
+  binary := []byte{ 0x1f, 0x8b, 0x08, 0x00, 0xff, 0xfe }
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write(binary)
+  }))
+  defer server.Close()
+  cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+  recorder, err := NewAPIClient(&APIClientOpt{ URI: server.URL, VCRMode: "record", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if _, err := recorder.SendRequest("GET", "/things/1", ""); err != nil { t.Fatalf("vcr_test.go: %s", err) }
+
+  player, err := NewAPIClient(&APIClientOpt{ URI: server.URL, VCRMode: "replay", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  res, err := player.SendRequest("GET", "/things/1", "")
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if !bytes.Equal([]byte(res), binary) { t.Fatalf("vcr_test.go: Replayed %v but recorded %v", []byte(res), binary) }
+}
+
+func TestVCRRedactsCredentials(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Set-Cookie", "session=cookie-s3cret")
+    w.Header().Set("X-Request-Id", "abc")
+    w.Write([]byte("{}"))
+  }))
+  defer server.Close()
+  cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+  recorder, err := NewAPIClient(&APIClientOpt{ URI: server.URL, VCRMode: "record", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if _, err := recorder.SendRequest("GET", "/things?api_key=query-s3cret&page=2", ""); err != nil { t.Fatalf("vcr_test.go: %s", err) }
+
+  b, err := ioutil.ReadFile(cassette)
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  for _, secret := range []string{ "cookie-s3cret", "query-s3cret" } {
+    if strings.Contains(string(b), secret) { t.Fatalf("vcr_test.go: '%s' was recorded:\n%s", secret, b) }
+  }
+  for _, kept := range []string{ "X-Request-Id", "page=2" } {
+    if !strings.Contains(string(b), kept) { t.Fatalf("vcr_test.go: '%s' was not recorded:\n%s", kept, b) }
+  }
+
+  player, err := NewAPIClient(&APIClientOpt{ URI: server.URL, VCRMode: "replay", VCRCassette: cassette })
+  if err != nil { t.Fatalf("vcr_test.go: %s", err) }
+  if _, err := player.SendRequest("GET", "/things?api_key=query-s3cret&page=2", ""); err != nil { t.Fatalf("vcr_test.go: The redacted request was not replayed: %s", err) }
+}
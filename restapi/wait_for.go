@@ -0,0 +1,47 @@
+package restapi
+
+import (
+  "fmt"
+  "strings"
+  "time"
+)
+
+// WaitForValues reads the object until WaitForKey is one of
+// WaitForValues, for APIs that report success on writes long before
+// the object is ready. The first check is made against what was last
+// read, so an object that is ready right away costs no extra request
+func (obj *APIObject) WaitForValues() error {
+  if obj.wait_for_key == "" { return nil }
+
+  key := obj.wait_for_key
+  /* Only the simplest JSONPath is understood: $.status.phase */
+  if strings.HasPrefix(key, "$.") { key = key[2:] }
+
+  var deadline time.Time
+  if obj.wait_for_timeout > 0 { deadline = time.Now().Add(obj.wait_for_timeout) }
+  for {
+    value := ""
+    if v, ok := object_value(map[string]interface{}(obj.api_data), key); ok { value = fmt.Sprintf("%v", v) }
+    for _, want := range obj.wait_for_values {
+      if value == want { return nil }
+    }
+
+    if !deadline.IsZero() && time.Now().Add(obj.wait_for_interval).After(deadline) {
+      return fmt.Errorf("Gave up after %s waiting for '%s' of '%s' to be one of %v. It is '%s'", obj.wait_for_timeout, obj.wait_for_key, obj.id, obj.wait_for_values, value)
+    }
+    log_info("wait_for.go", "Waiting for the object to be ready", "id", obj.id, "key", obj.wait_for_key, "value", value, "wait", obj.wait_for_interval)
+    if err := sleep_context(obj.ctx, obj.wait_for_interval); err != nil {
+      return fmt.Errorf("Gave up waiting for '%s' of '%s' to be one of %v. It is '%s': %w", obj.wait_for_key, obj.id, obj.wait_for_values, value, err)
+    }
+
+    /* The response cache would keep answering with the same object */
+    res, err := obj.poll(add_query(obj.op_path(obj.read_path), obj.read_query_string()))
+    if err != nil { return err }
+    obj.etag = res.headers.Get("ETag")
+    body := res.body
+    if obj.page_list_key != "" {
+      if body, err = obj.read_pages(res); err != nil { return err }
+    }
+    if err := obj.update_state(body); err != nil { return err }
+  }
+}
@@ -0,0 +1,50 @@
+package restapi
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestWaitForValues(t *testing.T) {
+  reads := 0
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "POST" {
+      w.Write([]byte(`{ "id": "1", "status": { "phase": "provisioning" } }`))
+      return
+    }
+    reads++
+    w.Write([]byte(`{ "id": "1", "status": { "phase": "ready" } }`))
+  }))
+  defer server.Close()
+
+  /* The cache must not hide the change */
+  client, _ := NewAPIClient(&APIClientOpt{ URI: server.URL, Timeout: 5, WriteReturnsObject: true, CacheTTL: 60 })
+  opt := &APIObjectOpt{
+    Path: "/clusters",
+    Data: `{ "name": "a" }`,
+    WaitForKey: "$.status.phase",
+    WaitForValues: []string{ "ready", "degraded" },
+    WaitForInterval: 1,
+  }
+  obj, err := NewAPIObject(client, opt)
+  if err != nil { t.Fatalf("wait_for_test.go: %s", err) }
+  if err := obj.CreateObject(); err != nil { t.Fatalf("wait_for_test.go: %s", err) }
+  if err := obj.WaitForValues(); err != nil { t.Fatalf("wait_for_test.go: %s", err) }
+  if reads != 1 { t.Fatalf("wait_for_test.go: Expected one read until the object was ready but got %d", reads) }
+
+  /* Already ready is not read again */
+  if err := obj.WaitForValues(); err != nil || reads != 1 { t.Fatalf("wait_for_test.go: Expected no more reads but got %d (%v)", reads, err) }
+
+  opt.WaitForValues = []string{ "deleted" }
+  opt.WaitForTimeout = 1
+  obj, _ = NewAPIObject(client, opt)
+  if err := obj.CreateObject(); err != nil { t.Fatalf("wait_for_test.go: %s", err) }
+  if err := obj.WaitForValues(); err == nil || !strings.Contains(err.Error(), "It is 'provisioning'") {
+    t.Fatalf("wait_for_test.go: Expected the wait to time out but got '%v'", err)
+  }
+
+  opt.WaitForValues = nil
+  if _, err := NewAPIObject(client, opt); err == nil { t.Fatalf("wait_for_test.go: wait_for without values was accepted") }
+}